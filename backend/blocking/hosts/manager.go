@@ -129,6 +129,21 @@ func Unblock() error {
 	return nil
 }
 
+// IsBlocked reports whether our section is present in the hosts file.
+func IsBlocked() (bool, error) {
+	content, err := os.ReadFile(getHostsPath())
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == startMarker {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func ensureWritable(path string) error {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -2,13 +2,11 @@ package bridge
 
 import (
 	"context"
-	"focus-lock/backend/blocking/hosts"
 	"focus-lock/backend/obfuscation"
 	"focus-lock/backend/scheduler"
 	"focus-lock/backend/storage"
 	"focus-lock/backend/watchdog"
 	"os"
-	"sort"
 	"time"
 )
 
@@ -21,6 +19,7 @@ type App struct {
 // NewApp creates a new App application struct
 func NewApp() *App {
 	store, _ := storage.NewStore()
+	store.SetSource(storage.SourceUI)
 	store.Load() // Ignore error, defaults are fine
 	return &App{
 		Store: store,
@@ -33,26 +32,21 @@ func (a *App) Startup(ctx context.Context) {
 
 	// Startup Cleanup / Sanity Check
 	a.Store.Load()
-	manualActive := !a.Store.Data.LockEndTime.IsZero() && time.Now().Before(a.Store.Data.LockEndTime)
-	scheduleActive := watchdog.IsScheduleActive(a.Store.Data.Schedules)
+	config := a.Store.Snapshot()
+	state := watchdog.Evaluate(config, a.now())
 
 	// Check if any schedule is enabled (not just currently active)
-	hasEnabledSchedules := false
-	for _, s := range a.Store.Data.Schedules {
-		if s.Enabled {
-			hasEnabledSchedules = true
-			break
-		}
-	}
+	hasEnabledSchedules := anyScheduleEnabled(config.Schedules)
 
-	if !manualActive && !scheduleActive && !hasEnabledSchedules {
+	if !state.SessionActive && !hasEnabledSchedules {
 		// No active lock and no enabled schedules. Force cleanup.
-		_ = hosts.Unblock()
-		if a.Store.Data.GhostTaskName != "" {
-			_ = scheduler.DisablePersistence(a.Store.Data.GhostTaskName)
-			a.Store.Data.GhostTaskName = ""
-			a.Store.Data.GhostExePath = ""
-			a.Store.Save()
+		_ = watchdog.UnblockSites(a.Store, a.now())
+		if config.GhostTaskName != "" {
+			_ = scheduler.DisablePersistence(config.GhostTaskName)
+			a.Store.UpdateAtomic(func(cfg *storage.Config) {
+				cfg.GhostTaskName = ""
+				cfg.GhostExePath = ""
+			})
 		}
 	} else if hasEnabledSchedules {
 		// Check if Ghost is actually running (it may have exited or never started after reboot)
@@ -62,22 +56,23 @@ func (a *App) Startup(ctx context.Context) {
 			// Ghost is NOT running. We need to spawn one.
 			// Check if Ghost executable exists (it may have been deleted/cleaned up)
 			ghostExeExists := false
-			if a.Store.Data.GhostExePath != "" {
-				if _, err := os.Stat(a.Store.Data.GhostExePath); err == nil {
+			if config.GhostExePath != "" {
+				if _, err := os.Stat(config.GhostExePath); err == nil {
 					ghostExeExists = true
 				}
 			}
 
-			if a.Store.Data.GhostTaskName == "" || !ghostExeExists {
+			if config.GhostTaskName == "" || !ghostExeExists {
 				// No Ghost was ever set up OR the exe is missing. Create a new one.
 				currentExe, err := os.Executable()
 				if err == nil {
 					taskName := obfuscation.GenerateTaskName()
 					ghostExe, err := obfuscation.SetupGhostExecutable(currentExe, taskName)
 					if err == nil {
-						a.Store.Data.GhostTaskName = taskName
-						a.Store.Data.GhostExePath = ghostExe
-						a.Store.Save()
+						a.Store.UpdateAtomic(func(cfg *storage.Config) {
+							cfg.GhostTaskName = taskName
+							cfg.GhostExePath = ghostExe
+						})
 						_ = scheduler.EnablePersistence(ghostExe, taskName)
 						_ = spawnGhost(ghostExe, taskName)
 					}
@@ -85,18 +80,62 @@ func (a *App) Startup(ctx context.Context) {
 			} else {
 				// Ghost was set up before (e.g., before reboot) but isn't running.
 				// Re-spawn it using the existing task.
-				_ = spawnGhost(a.Store.Data.GhostExePath, a.Store.Data.GhostTaskName)
+				_ = spawnGhost(config.GhostExePath, config.GhostTaskName)
 			}
 		}
 	}
 
+	// Push config changes to the frontend
+	go a.forwardConfigChanges()
+	go a.forwardNotifications()
+
 	// Start the Enforcer in the background of the UI process
 	go watchdog.StartEnforcer(a.Store, false)
 }
 
+// Shutdown is called when the app is closing. The enforcer writes kills in
+// batches; the ones it has not written yet would be lost with the process.
+func (a *App) Shutdown(ctx context.Context) {
+	_ = a.Store.FlushKills()
+}
+
+// ConfigView is the configuration as the frontend sees it: the stored config
+// plus the lists of the active profile, which the app and site pages edit.
+type ConfigView struct {
+	storage.Config
+	BlockedApps    []string          `json:"blocked_apps"` // Name rules only
+	AppRules       []storage.AppRule `json:"app_rules"`
+	BlockedSites   []string          `json:"blocked_sites"`
+	BlockCommonVPN bool              `json:"block_common_vpn"`
+}
+
 // GetConfig returns the current configuration
-func (a *App) GetConfig() storage.Config {
+func (a *App) GetConfig() ConfigView {
 	a.Store.Load()
-	sort.Strings(a.Store.Data.BlockedApps)
-	return a.Store.Data
+	config := a.Store.Snapshot()
+	profile := config.ActiveProfile()
+	profile.Normalize()
+	return ConfigView{
+		Config:         config,
+		BlockedApps:    profile.BlockedAppNames(),
+		AppRules:       profile.AppRules,
+		BlockedSites:   profile.BlockedSites,
+		BlockCommonVPN: profile.BlockCommonVPN,
+	}
+}
+
+// now is the current time on the store's clock.
+func (a *App) now() time.Time {
+	return a.Store.Clock().Now()
+}
+
+// anyScheduleEnabled reports whether any schedule is enabled, i.e. whether
+// the ghost must stay installed for future windows.
+func anyScheduleEnabled(schedules []storage.Schedule) bool {
+	for _, s := range schedules {
+		if s.Enabled {
+			return true
+		}
+	}
+	return false
 }
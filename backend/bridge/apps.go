@@ -2,11 +2,11 @@ package bridge
 
 import (
 	"errors"
+	"fmt"
+	"focus-lock/backend/storage"
 	"focus-lock/backend/sysinfo"
-	"focus-lock/backend/watchdog"
 	"sort"
 	"strings"
-	"time"
 )
 
 // GetInstalledApps returns a list of installed applications
@@ -14,51 +14,174 @@ func (a *App) GetInstalledApps() ([]sysinfo.AppInfo, error) {
 	return sysinfo.GetInstalledApps()
 }
 
-// AddApp adds an app to the blocked list
+// AddApp adds an app to the active profile's blocked list
 func (a *App) AddApp(appName string) error {
 	appName = strings.TrimSpace(appName)
 	if appName == "" {
 		return errors.New("app name cannot be empty")
 	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		// Duplicates are skipped
+		cfg.ActiveProfile().AddRule(storage.NameRule(appName))
+		return nil
+	})
+}
+
+// RemoveApp removes an app from the active profile's blocked list
+func (a *App) RemoveApp(appName string) error {
+	return a.RemoveAppRule(string(storage.RuleName), appName)
+}
+
+// GetAppRules returns the active profile's app rules of every type
+func (a *App) GetAppRules() []storage.AppRule {
 	a.Store.Load()
-	// Check duplicate
-	for _, existing := range a.Store.Data.BlockedApps {
-		if existing == appName {
-			return nil
-		}
+	config := a.Store.Snapshot()
+	return config.ActiveProfile().AppRules
+}
+
+// AddAppRule adds a rule to the active profile: "name", "path_glob",
+// "path_regex" or "sha256" with the value to match.
+func (a *App) AddAppRule(ruleType, value string) error {
+	rule, err := storage.NewAppRule(storage.RuleType(ruleType), value)
+	if err != nil {
+		return err
 	}
-	a.Store.Data.BlockedApps = append(a.Store.Data.BlockedApps, appName)
-	sort.Strings(a.Store.Data.BlockedApps)
-	return a.Store.Save()
+	return a.Store.Update(func(cfg *storage.Config) error {
+		cfg.ActiveProfile().AddRule(rule)
+		return nil
+	})
 }
 
-// RemoveApp removes an app from the blocked list
-func (a *App) RemoveApp(appName string) error {
+// RemoveAppRule removes a rule from the active profile
+func (a *App) RemoveAppRule(ruleType, value string) error {
+	return a.Store.Update(func(cfg *storage.Config) error {
+		// Check if a session enforces this profile - prevent removal during it
+		if activeProfileLocked(cfg, a.now()) {
+			return errors.New("cannot remove apps during an active focus session")
+		}
+
+		cfg.ActiveProfile().RemoveRule(storage.RuleType(ruleType), value)
+		return nil
+	})
+}
+
+// GetRuleTermination returns how processes matched by a rule of the active
+// profile are ended
+func (a *App) GetRuleTermination(ruleType, value string) storage.Termination {
 	a.Store.Load()
+	config := a.Store.Snapshot()
+	if rule := config.ActiveProfile().Rule(storage.RuleType(ruleType), value); rule != nil {
+		return rule.Ladder()
+	}
+	return storage.DefaultTermination()
+}
+
+// SetRuleTermination sets how processes matched by a rule of the active
+// profile are ended: force-killed, or asked to close and killed after
+// graceSeconds.
+func (a *App) SetRuleTermination(ruleType, value string, graceful bool, graceSeconds int) error {
+	if graceful && (graceSeconds <= 0 || graceSeconds > storage.MaxGraceSeconds) {
+		return fmt.Errorf("grace period must be between 1 and %d seconds", storage.MaxGraceSeconds)
+	}
+	term := storage.Termination{Graceful: graceful, GraceSeconds: graceSeconds}
+	if !graceful {
+		term.GraceSeconds = 0
+	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		rule := cfg.ActiveProfile().Rule(storage.RuleType(ruleType), value)
+		if rule == nil {
+			return fmt.Errorf("no %s rule for %q", ruleType, value)
+		}
+		// A longer grace period is more time with the app
+		if term.GracePeriod() > rule.Ladder().GracePeriod() && activeProfileLocked(cfg, a.now()) {
+			return errors.New("cannot lengthen the grace period during an active focus session")
+		}
+		rule.Termination = &term
+		return nil
+	})
+}
 
-	// Check if session is active - prevent removal during active session
-	manualActive := !a.Store.Data.LockEndTime.IsZero() && time.Now().Before(a.Store.Data.LockEndTime)
-	scheduleActive := watchdog.IsScheduleActive(a.Store.Data.Schedules)
-	if manualActive || scheduleActive {
-		return errors.New("cannot remove apps during an active focus session")
+// SetRuleMatch sets how a name rule of the active profile is compared with
+// version metadata: "exact", "prefix", "word" or "contains".
+func (a *App) SetRuleMatch(ruleType, value, mode string) error {
+	match := storage.MatchMode(mode)
+	if !storage.ValidMatchMode(match) {
+		return fmt.Errorf("unknown match mode %q", mode)
 	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		rule := cfg.ActiveProfile().Rule(storage.RuleType(ruleType), value)
+		if rule == nil {
+			return fmt.Errorf("no %s rule for %q", ruleType, value)
+		}
+		// Every other mode matches less than contains
+		if match != storage.MatchContains && match != rule.EffectiveMatch() && activeProfileLocked(cfg, a.now()) {
+			return errors.New("cannot narrow a rule during an active focus session")
+		}
+		rule.Match = match
+		return nil
+	})
+}
 
-	newApps := []string{}
-	for _, existing := range a.Store.Data.BlockedApps {
-		if existing != appName {
-			newApps = append(newApps, existing)
+// SetRuleScope sets which processes around a match a rule of the active
+// profile ends: "process", "tree" (it and everything it launched) or
+// "launched" (only what it launched).
+func (a *App) SetRuleScope(ruleType, value, scope string) error {
+	ruleScope := storage.RuleScope(scope)
+	if !storage.ValidScope(ruleScope) {
+		return fmt.Errorf("unknown rule scope %q", scope)
+	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		rule := cfg.ActiveProfile().Rule(storage.RuleType(ruleType), value)
+		if rule == nil {
+			return fmt.Errorf("no %s rule for %q", ruleType, value)
+		}
+		// Every other scope ends less than tree
+		if ruleScope != storage.ScopeTree && ruleScope != rule.EffectiveScope() && activeProfileLocked(cfg, a.now()) {
+			return errors.New("cannot narrow a rule during an active focus session")
 		}
+		rule.Scope = ruleScope
+		return nil
+	})
+}
+
+// actionRank orders actions by how much they keep the user from an app.
+var actionRank = map[storage.Action]int{
+	storage.ActionLog:     0,
+	storage.ActionNotify:  1,
+	storage.ActionSuspend: 2,
+	storage.ActionKill:    3,
+}
+
+// SetRuleAction sets what is done with processes a rule of the active
+// profile matches: "kill", "suspend" (until the session ends), "notify",
+// "log", or "" for the profile's action.
+func (a *App) SetRuleAction(ruleType, value, action string) error {
+	ruleAction := storage.Action(action)
+	if !storage.ValidAction(ruleAction) {
+		return fmt.Errorf("unknown action %q", action)
 	}
-	a.Store.Data.BlockedApps = newApps
-	return a.Store.Save()
+	return a.Store.Update(func(cfg *storage.Config) error {
+		profile := cfg.ActiveProfile()
+		rule := profile.Rule(storage.RuleType(ruleType), value)
+		if rule == nil {
+			return fmt.Errorf("no %s rule for %q", ruleType, value)
+		}
+		next := *rule
+		next.Action = ruleAction
+		if actionRank[profile.RuleAction(next)] < actionRank[profile.RuleAction(*rule)] && activeProfileLocked(cfg, a.now()) {
+			return errors.New("cannot soften a rule's action during an active focus session")
+		}
+		rule.Action = ruleAction
+		return nil
+	})
 }
 
-// SetBlockedApps updates the entire list of blocked apps at once.
+// SetBlockedApps updates the active profile's entire list of blocked apps at
+// once. Rules of other types are kept.
 func (a *App) SetBlockedApps(apps []string) error {
-	a.Store.Load()
-	sort.Strings(apps)
-	a.Store.Data.BlockedApps = apps
-	return a.Store.Save()
+	return a.Store.UpdateAtomic(func(cfg *storage.Config) {
+		cfg.ActiveProfile().SetBlockedAppNames(apps)
+	})
 }
 
 // GetTopBlockedApps returns the top 5 most blocked apps by duration
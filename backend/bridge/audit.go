@@ -0,0 +1,21 @@
+package bridge
+
+import (
+	"focus-lock/backend/storage"
+	"time"
+)
+
+// GetAuditLog returns the matches acted on without killing in the last
+// days: suspended, notified, and logged by rules on trial
+func (a *App) GetAuditLog(days int) ([]storage.AuditEntry, error) {
+	var from time.Time
+	if days > 0 {
+		from = a.now().AddDate(0, 0, -days)
+	}
+	return a.Store.Audit().Entries(from)
+}
+
+// GetSuspendedProcesses returns the processes frozen until the session ends
+func (a *App) GetSuspendedProcesses() ([]storage.SuspendedProcess, error) {
+	return a.Store.Suspended().List()
+}
@@ -0,0 +1,29 @@
+package bridge
+
+import (
+	"errors"
+	"focus-lock/backend/storage"
+	"focus-lock/backend/watchdog"
+)
+
+// GetEncryptAtRest reports whether config.json is stored encrypted
+func (a *App) GetEncryptAtRest() bool {
+	a.Store.Load()
+	return a.Store.Snapshot().EncryptAtRest
+}
+
+// SetEncryptAtRest turns encryption of config.json on or off. The file is
+// rewritten in the new format right away; turning it on also seals what the
+// previous generation, the journal and the session history kept in
+// plaintext. Turning it off is refused during
+// an active session, since that would reveal when enforcement ends.
+func (a *App) SetEncryptAtRest(enabled bool) error {
+	return a.Store.Update(func(cfg *storage.Config) error {
+		if !enabled && watchdog.Evaluate(*cfg, a.now()).SessionActive {
+			return errors.New("cannot turn off encryption during an active focus session")
+		}
+
+		cfg.EncryptAtRest = enabled
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package bridge
+
+import (
+	"focus-lock/backend/storage"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ConfigChangedEvent is emitted to the frontend with a storage.ChangeEvent
+// whenever the config changes, whether saved here or by the ghost.
+const ConfigChangedEvent = "config:changed"
+
+// forwardConfigChanges relays store change events to the frontend so it can
+// refresh instead of polling. Runs until the app context ends.
+func (a *App) forwardConfigChanges() {
+	changes, cancel := a.Store.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case ev := <-changes:
+			runtime.EventsEmit(a.ctx, ConfigChangedEvent, ev)
+		}
+	}
+}
+
+// NotifyEvent is emitted to the frontend with a storage.AuditEntry when a
+// rule with the notify action matches, so the user can be told.
+const NotifyEvent = "enforcement:notify"
+
+// WarningEvent is emitted to the frontend with a storage.AuditEntry when the
+// enforcer raises a warning, e.g. about an app caught in a relaunch loop.
+const WarningEvent = "enforcement:warning"
+
+// forwardNotifications relays notify-only matches and warnings found by
+// this process's enforcer to the frontend. The UI's enforcer sees every
+// match the ghost does, so nothing is missed while the window is open.
+func (a *App) forwardNotifications() {
+	entries, cancel := a.Store.Audit().Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case e := <-entries:
+			switch e.Action {
+			case storage.ActionNotify:
+				runtime.EventsEmit(a.ctx, NotifyEvent, e)
+			case storage.ActionWarn:
+				runtime.EventsEmit(a.ctx, WarningEvent, e)
+			}
+		}
+	}
+}
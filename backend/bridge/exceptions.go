@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"errors"
+	"focus-lock/backend/storage"
+	"focus-lock/backend/watchdog"
+)
+
+// GetExceptions returns the processes that are never ended, whatever rule
+// matches them
+func (a *App) GetExceptions() []storage.AppRule {
+	a.Store.Load()
+	config := a.Store.Snapshot()
+	if config.Exceptions == nil {
+		return []storage.AppRule{}
+	}
+	return config.Exceptions
+}
+
+// AddException exempts the processes matched by a rule of the given type
+// from enforcement. Refused during a session, as it would unblock apps.
+func (a *App) AddException(ruleType, value string) error {
+	rule, err := storage.NewAppRule(storage.RuleType(ruleType), value)
+	if err != nil {
+		return err
+	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		if watchdog.Evaluate(*cfg, a.now()).SessionActive {
+			return errors.New("cannot add exceptions during an active focus session")
+		}
+		for _, existing := range cfg.Exceptions {
+			if existing.Key() == rule.Key() {
+				return nil
+			}
+		}
+		cfg.Exceptions = append(cfg.Exceptions, rule)
+		return nil
+	})
+}
+
+// RemoveException removes an exception. This only blocks more, so it is
+// allowed during a session.
+func (a *App) RemoveException(ruleType, value string) error {
+	key := storage.AppRule{Type: storage.RuleType(ruleType), Value: value}.Key()
+	return a.Store.Update(func(cfg *storage.Config) error {
+		kept := []storage.AppRule{}
+		for _, existing := range cfg.Exceptions {
+			if existing.Key() != key {
+				kept = append(kept, existing)
+			}
+		}
+		cfg.Exceptions = kept
+		return nil
+	})
+}
@@ -2,24 +2,30 @@ package bridge
 
 import (
 	"fmt"
-	"focus-lock/backend/blocking/hosts"
 	"focus-lock/backend/obfuscation"
 	"focus-lock/backend/scheduler"
+	"focus-lock/backend/storage"
+	"focus-lock/backend/watchdog"
 	"os"
 	"time"
 )
 
-// StartFocus starts a focus session for the given duration
-func (a *App) StartFocus(seconds int) error {
+// StartFocus starts a focus session for the given duration, enforcing the
+// given profile (or the active profile if profileID is empty)
+func (a *App) StartFocus(seconds int, profileID string) error {
 	a.Store.Load()
+	config := a.Store.Snapshot()
+	if profileID != "" && config.Profile(profileID) == nil {
+		return storage.ErrProfileNotFound
+	}
 
 	var taskName, ghostExe string
 
 	// Check if a Ghost already exists (e.g., from a schedule)
-	if a.Store.Data.GhostTaskName != "" && a.Store.Data.GhostExePath != "" {
+	if config.GhostTaskName != "" && config.GhostExePath != "" {
 		// Reuse existing Ghost - just update the lock time
-		taskName = a.Store.Data.GhostTaskName
-		ghostExe = a.Store.Data.GhostExePath
+		taskName = config.GhostTaskName
+		ghostExe = config.GhostExePath
 	} else {
 		// 1. Setup Obfuscation (Copy executable first so path is known)
 		currentExe, err := os.Executable()
@@ -35,18 +41,34 @@ func (a *App) StartFocus(seconds int) error {
 	}
 
 	// 2. Update ALL config fields BEFORE spawning Ghost
-	a.Store.Data.LockEndTime = time.Now().Add(time.Duration(seconds) * time.Second)
-	a.Store.Data.RemainingDuration = time.Duration(seconds) * time.Second
-	a.Store.Data.EmergencyUnlocksUsed = 0
-	a.Store.Data.GhostTaskName = taskName
-	a.Store.Data.GhostExePath = ghostExe
-	a.Store.UpdateBlockedStats(a.Store.Data.BlockedApps, seconds)
-
 	// **CRITICAL**: Save BEFORE spawning Ghost so it sees the correct LockEndTime
-	if err := a.Store.Save(); err != nil {
+	now := a.now()
+	lockEnd := now.Add(time.Duration(seconds) * time.Second)
+	var profile storage.Profile
+	err := a.Store.UpdateAtomic(func(cfg *storage.Config) {
+		profile = *cfg.ResolveProfile(profileID)
+		cfg.SessionProfileID = profile.ID
+		cfg.LockEndTime = lockEnd
+		cfg.RemainingDuration = time.Duration(seconds) * time.Second
+		cfg.EmergencyUnlocksUsed = 0
+		cfg.GhostTaskName = taskName
+		cfg.GhostExePath = ghostExe
+	})
+	if err != nil {
 		return err
 	}
 
+	// Record the session. Blocked time is credited when it ends, so a
+	// session stopped early only counts the time it actually ran.
+	a.endManualSessions(now)
+	_, _ = a.Store.Sessions().Begin(storage.Session{
+		Trigger:    storage.TriggerManual,
+		ProfileID:  profile.ID,
+		Apps:       profile.BlockedAppNames(),
+		Start:      now,
+		PlannedEnd: lockEnd,
+	})
+
 	// 3. Enable Persistence (so reboot works)
 	_ = scheduler.EnablePersistence(ghostExe, taskName)
 
@@ -67,24 +89,18 @@ func (a *App) StopFocus() error {
 	// Only allow if time expired?
 	// For V1 debug, we allow manual stop.
 	a.Store.Load()
+	config := a.Store.Snapshot()
 
 	// Check if any schedule is enabled - we'll preserve Ghost if so
-	hasEnabledSchedules := false
-	for _, s := range a.Store.Data.Schedules {
-		if s.Enabled {
-			hasEnabledSchedules = true
-			break
-		}
-	}
+	hasEnabledSchedules := anyScheduleEnabled(config.Schedules)
 
-	// Unblock sites (only for manual lock end, schedules will re-block)
-	_ = hosts.Unblock()
+	a.endManualSessions(a.now())
 
 	// Only cleanup Ghost if NO enabled schedules exist
 	// This preserves the scheduled task for future schedule activations
 	if !hasEnabledSchedules {
-		taskName := a.Store.Data.GhostTaskName
-		exePath := a.Store.Data.GhostExePath
+		taskName := config.GhostTaskName
+		exePath := config.GhostExePath
 
 		if taskName != "" {
 			_ = scheduler.DisablePersistence(taskName)
@@ -92,31 +108,44 @@ func (a *App) StopFocus() error {
 		if exePath != "" {
 			obfuscation.CleanupGhostExecutable(exePath)
 		}
-
-		a.Store.Data.GhostTaskName = ""
-		a.Store.Data.GhostExePath = ""
 	}
-	// If schedules exist, keep GhostTaskName and GhostExePath so Ghost continues running
 
-	a.Store.Data.LockEndTime = time.Time{} // Reset manual lock
-	a.Store.Data.RemainingDuration = 0
+	err := a.Store.UpdateAtomic(func(cfg *storage.Config) {
+		// If schedules exist, keep GhostTaskName and GhostExePath so Ghost continues running
+		if !hasEnabledSchedules {
+			cfg.GhostTaskName = ""
+			cfg.GhostExePath = ""
+		}
 
-	if err := a.Store.Save(); err != nil {
+		cfg.LockEndTime = time.Time{} // Reset manual lock
+		cfg.RemainingDuration = 0
+		cfg.SessionProfileID = ""
+	})
+	if err != nil {
 		return err
 	}
+
+	// Unblock sites, unless a schedule window still wants them
+	_ = watchdog.UnblockSites(a.Store, a.now())
 	return nil
 }
 
 // EmergencyUnlock temporarily pauses enforcement (limited uses per session)
 func (a *App) EmergencyUnlock() error {
-	a.Store.Load()
+	now := a.now()
+	err := a.Store.Update(func(cfg *storage.Config) error {
+		if cfg.EmergencyUnlocksUsed >= storage.MaxEmergencyUnlocks {
+			return fmt.Errorf("emergency unlock limit reached (%d/%d)", storage.MaxEmergencyUnlocks, storage.MaxEmergencyUnlocks)
+		}
 
-	if a.Store.Data.EmergencyUnlocksUsed >= 2 {
-		return fmt.Errorf("emergency unlock limit reached (2/2)")
+		cfg.PausedUntil = now.Add(1 * time.Minute)
+		cfg.EmergencyUnlocksUsed++
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	a.Store.Data.PausedUntil = time.Now().Add(1 * time.Minute)
-	a.Store.Data.EmergencyUnlocksUsed++
-
-	return a.Store.Save()
+	_ = a.Store.Sessions().RecordEmergencyUnlock(now)
+	return nil
 }
@@ -3,13 +3,15 @@
 package bridge
 
 import (
+	"focus-lock/backend/datadir"
+
 	"golang.org/x/sys/windows"
 )
 
 // isGhostProcessRunning checks if the Ghost process is currently running
 // by attempting to acquire its mutex. If the mutex already exists, a Ghost is running.
 func isGhostProcessRunning() bool {
-	mutexName, err := windows.UTF16PtrFromString("Global\\FocusLockGhost")
+	mutexName, err := windows.UTF16PtrFromString("Global\\FocusLockGhost" + datadir.InstanceSuffix())
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,31 @@
+package bridge
+
+import (
+	"errors"
+	"focus-lock/backend/storage"
+)
+
+// GetConfigHistory returns the config change journal, newest first.
+// If the journal has been tampered with, the entries are still returned
+// along with the error so the UI can show both.
+func (a *App) GetConfigHistory() ([]storage.JournalEntry, error) {
+	entries, err := a.Store.JournalEntries()
+	if entries == nil {
+		return []storage.JournalEntry{}, err
+	}
+
+	reversed := make([]storage.JournalEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		reversed = append(reversed, entries[i])
+	}
+	return reversed, err
+}
+
+// RollbackConfig restores settings to how they were after journal entry seq.
+func (a *App) RollbackConfig(seq int) error {
+	err := a.Store.RollbackTo(seq)
+	if errors.Is(err, storage.ErrLockActive) {
+		return errors.New("cannot roll back settings during an active focus session")
+	}
+	return err
+}
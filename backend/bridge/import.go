@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"focus-lock/backend/storage"
 	"focus-lock/backend/sysinfo"
-	"sort"
+	"focus-lock/backend/watchdog"
 	"strings"
 
 	"github.com/google/uuid"
@@ -13,14 +13,85 @@ import (
 
 // ImportData represents the JSON structure for importing settings
 type ImportData struct {
-	Blocked   BlockedItems     `json:"blocked"`
+	Blocked   BlockedItems     `json:"blocked"` // Merged into the active profile
+	Profiles  []ImportProfile  `json:"profiles,omitempty"`
 	Schedules []ImportSchedule `json:"schedules"`
 }
 
-// BlockedItems represents the blocked apps and sites in import format
+// ImportProfile represents a named profile in import format
+type ImportProfile struct {
+	Name           string       `json:"name"`
+	Blocked        BlockedItems `json:"blocked"`
+	BlockCommonVPN *bool        `json:"blockCommonVPN,omitempty"`
+	Action         string       `json:"action,omitempty"` // kill, suspend, notify or log, for rules without their own
+}
+
+// BlockedItems represents the blocked apps and sites in import format.
+// Apps are executable names; Rules carry the other rule types and any
+// name rule with settings of its own.
 type BlockedItems struct {
-	Apps  []string `json:"apps"`
-	Sites []string `json:"sites"`
+	Apps  []string     `json:"apps"`
+	Rules []ImportRule `json:"rules,omitempty"`
+	Sites []string     `json:"sites"`
+}
+
+// ImportRule represents an app rule in import format
+type ImportRule struct {
+	Type         string `json:"type"` // name, path_glob, path_regex or sha256
+	Value        string `json:"value"`
+	Match        string `json:"match,omitempty"`  // exact, prefix, word or contains; name rules only
+	Scope        string `json:"scope,omitempty"`  // process, tree or launched
+	Action       string `json:"action,omitempty"` // kill, suspend, notify or log; empty follows the profile
+	Graceful     *bool  `json:"graceful,omitempty"`
+	GraceSeconds int    `json:"graceSeconds,omitempty"`
+}
+
+// appRules validates the imported rules.
+func (items BlockedItems) appRules() ([]storage.AppRule, error) {
+	rules := make([]storage.AppRule, 0, len(items.Rules))
+	for _, ir := range items.Rules {
+		rule, err := storage.NewAppRule(storage.RuleType(ir.Type), ir.Value)
+		if err != nil {
+			return nil, err
+		}
+		rule.Match = storage.MatchMode(ir.Match)
+		rule.Scope = storage.RuleScope(ir.Scope)
+		rule.Action = storage.Action(ir.Action)
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if ir.Graceful != nil {
+			rule.Termination = &storage.Termination{Graceful: *ir.Graceful, GraceSeconds: ir.GraceSeconds}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// exportedItems splits a profile's rules into plain app names and the
+// rules that need the long form.
+func exportedItems(profile *storage.Profile) BlockedItems {
+	items := BlockedItems{Apps: []string{}, Sites: profile.BlockedSites}
+	for _, rule := range profile.AppRules {
+		if rule.Type == storage.RuleName && rule.Match == "" && rule.Scope == "" && rule.Action == "" && rule.Termination == nil {
+			items.Apps = append(items.Apps, rule.Value)
+			continue
+		}
+		ir := ImportRule{
+			Type:   string(rule.Type),
+			Value:  rule.Value,
+			Match:  string(rule.Match),
+			Scope:  string(rule.Scope),
+			Action: string(rule.Action),
+		}
+		if rule.Termination != nil {
+			graceful := rule.Termination.Graceful
+			ir.Graceful = &graceful
+			ir.GraceSeconds = rule.Termination.GraceSeconds
+		}
+		items.Rules = append(items.Rules, ir)
+	}
+	return items
 }
 
 // ImportSchedule represents a schedule in import format
@@ -29,6 +100,7 @@ type ImportSchedule struct {
 	ActiveDays []string `json:"activeDays"`
 	StartTime  string   `json:"startTime"`
 	EndTime    string   `json:"endTime"`
+	Profile    string   `json:"profile,omitempty"` // Profile name; empty follows the active profile
 }
 
 // resolveAppName attempts to match an imported app name to an installed application
@@ -78,75 +150,137 @@ func (a *App) ImportSettings(jsonContent string) error {
 		return fmt.Errorf("invalid JSON format: %w", err)
 	}
 
-	a.Store.Load()
-
 	// Get installed apps for fuzzy matching
 	installedApps, err := sysinfo.GetInstalledApps()
 	if err != nil {
 		installedApps = []sysinfo.AppInfo{} // Continue without matching if error
 	}
 
-	// Merge blocked apps (avoid duplicates) with fuzzy matching
-	existingApps := make(map[string]bool)
-	for _, app := range a.Store.Data.BlockedApps {
-		existingApps[strings.ToLower(app)] = true
+	// Reject the whole import if any rule is invalid
+	activeRules, err := importData.Blocked.appRules()
+	if err != nil {
+		return err
+	}
+	profileRules := make([][]storage.AppRule, len(importData.Profiles))
+	for i, importProf := range importData.Profiles {
+		if profileRules[i], err = importProf.Blocked.appRules(); err != nil {
+			return fmt.Errorf("profile %q: %w", importProf.Name, err)
+		}
+		if !storage.ValidAction(storage.Action(importProf.Action)) {
+			return fmt.Errorf("profile %q: unknown action %q", importProf.Name, importProf.Action)
+		}
+	}
+
+	return a.Store.UpdateAtomic(func(cfg *storage.Config) {
+		mergeBlocked(cfg.ActiveProfile(), importData.Blocked, activeRules, installedApps)
+		state := watchdog.Evaluate(*cfg, a.now())
+
+		// Merge named profiles, creating the ones that do not exist yet
+		for i, importProf := range importData.Profiles {
+			profile := importedProfile(cfg, importProf.Name)
+			if profile == nil {
+				continue
+			}
+			mergeBlocked(profile, importProf.Blocked, profileRules[i], installedApps)
+			if importProf.BlockCommonVPN != nil {
+				profile.BlockCommonVPN = *importProf.BlockCommonVPN
+			}
+			// A running session keeps the action it started with
+			if importProf.Action != "" && !state.CoversProfile(profile.ID) {
+				profile.Action = storage.Action(importProf.Action)
+			}
+		}
+
+		// Convert and append schedules
+		for _, importSched := range importData.Schedules {
+			schedule := storage.Schedule{
+				ID:        uuid.New().String(),
+				Name:      importSched.Name,
+				Days:      importSched.ActiveDays, // Map activeDays -> days
+				StartTime: importSched.StartTime,
+				EndTime:   importSched.EndTime,
+				Enabled:   true, // Enable by default
+			}
+			if profile := importedProfile(cfg, importSched.Profile); profile != nil {
+				schedule.ProfileID = profile.ID
+			}
+			cfg.Schedules = append(cfg.Schedules, schedule)
+		}
+	})
+}
+
+// importedProfile returns the profile called name, creating it if needed.
+// It returns nil for an empty name.
+func importedProfile(cfg *storage.Config, name string) *storage.Profile {
+	if strings.TrimSpace(name) == "" {
+		return nil
 	}
-	for _, app := range importData.Blocked.Apps {
-		resolvedApp := resolveAppName(app, installedApps)
-		if !existingApps[strings.ToLower(resolvedApp)] {
-			a.Store.Data.BlockedApps = append(a.Store.Data.BlockedApps, resolvedApp)
-			existingApps[strings.ToLower(resolvedApp)] = true
+	if profile := cfg.ProfileByName(name); profile != nil {
+		return profile
+	}
+	cfg.Profiles = append(cfg.Profiles, storage.NewProfile(name))
+	return &cfg.Profiles[len(cfg.Profiles)-1]
+}
+
+// mergeBlocked adds the imported rules, apps (with fuzzy matching) and sites
+// to profile, skipping duplicates. Rules go first, so a name rule's settings
+// win over the same name in the plain list.
+func mergeBlocked(profile *storage.Profile, items BlockedItems, rules []storage.AppRule, installedApps []sysinfo.AppInfo) {
+	for _, rule := range rules {
+		profile.AddRule(rule)
+	}
+	for _, app := range items.Apps {
+		if resolvedApp := resolveAppName(app, installedApps); strings.TrimSpace(resolvedApp) != "" {
+			profile.AddRule(storage.NameRule(resolvedApp))
 		}
 	}
-	sort.Strings(a.Store.Data.BlockedApps)
 
-	// Merge blocked sites (avoid duplicates)
 	existingSites := make(map[string]bool)
-	for _, site := range a.Store.Data.BlockedSites {
+	for _, site := range profile.BlockedSites {
 		existingSites[site] = true
 	}
-	for _, site := range importData.Blocked.Sites {
+	for _, site := range items.Sites {
 		if !existingSites[site] {
-			a.Store.Data.BlockedSites = append(a.Store.Data.BlockedSites, site)
+			profile.BlockedSites = append(profile.BlockedSites, site)
 			existingSites[site] = true
 		}
 	}
-	sort.Strings(a.Store.Data.BlockedSites)
-
-	// Convert and append schedules
-	for _, importSched := range importData.Schedules {
-		schedule := storage.Schedule{
-			ID:        uuid.New().String(),
-			Name:      importSched.Name,
-			Days:      importSched.ActiveDays, // Map activeDays -> days
-			StartTime: importSched.StartTime,
-			EndTime:   importSched.EndTime,
-			Enabled:   true, // Enable by default
-		}
-		a.Store.Data.Schedules = append(a.Store.Data.Schedules, schedule)
-	}
-
-	return a.Store.Save()
+	profile.Normalize()
 }
 
 // ExportSettings exports current settings to JSON format for sharing
 func (a *App) ExportSettings() (string, error) {
 	a.Store.Load()
+	config := a.Store.Snapshot()
 
+	active := config.ActiveProfile()
 	exportData := ImportData{
-		Blocked: BlockedItems{
-			Apps:  a.Store.Data.BlockedApps,
-			Sites: a.Store.Data.BlockedSites,
-		},
-		Schedules: make([]ImportSchedule, 0, len(a.Store.Data.Schedules)),
+		Blocked:   exportedItems(active),
+		Profiles:  make([]ImportProfile, 0, len(config.Profiles)),
+		Schedules: make([]ImportSchedule, 0, len(config.Schedules)),
 	}
 
-	for _, sched := range a.Store.Data.Schedules {
+	for _, profile := range config.Profiles {
+		vpn := profile.BlockCommonVPN
+		exportData.Profiles = append(exportData.Profiles, ImportProfile{
+			Name:           profile.Name,
+			Blocked:        exportedItems(&profile),
+			BlockCommonVPN: &vpn,
+			Action:         string(profile.Action),
+		})
+	}
+
+	for _, sched := range config.Schedules {
+		var profileName string
+		if profile := config.Profile(sched.ProfileID); profile != nil {
+			profileName = profile.Name
+		}
 		exportData.Schedules = append(exportData.Schedules, ImportSchedule{
 			Name:       sched.Name,
 			ActiveDays: sched.Days,
 			StartTime:  sched.StartTime,
 			EndTime:    sched.EndTime,
+			Profile:    profileName,
 		})
 	}
 
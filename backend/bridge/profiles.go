@@ -0,0 +1,141 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"focus-lock/backend/storage"
+	"focus-lock/backend/watchdog"
+	"strings"
+	"time"
+)
+
+// GetProfiles returns all blocking profiles
+func (a *App) GetProfiles() []storage.Profile {
+	a.Store.Load()
+	config := a.Store.Snapshot()
+	if config.Profiles == nil {
+		return []storage.Profile{}
+	}
+	return config.Profiles
+}
+
+// GetActiveProfile returns the profile currently selected in the UI
+func (a *App) GetActiveProfile() storage.Profile {
+	a.Store.Load()
+	config := a.Store.Snapshot()
+	return *config.ActiveProfile()
+}
+
+// CreateProfile adds an empty profile with the given name
+func (a *App) CreateProfile(name string) (storage.Profile, error) {
+	profile := storage.NewProfile(name)
+	if profile.Name == "" {
+		return storage.Profile{}, errors.New("profile name cannot be empty")
+	}
+	err := a.Store.Update(func(cfg *storage.Config) error {
+		if cfg.ProfileByName(profile.Name) != nil {
+			return fmt.Errorf("a profile named %q already exists", profile.Name)
+		}
+		cfg.Profiles = append(cfg.Profiles, profile)
+		return nil
+	})
+	return profile, err
+}
+
+// RenameProfile changes the name of a profile
+func (a *App) RenameProfile(id, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("profile name cannot be empty")
+	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		profile := cfg.Profile(id)
+		if profile == nil {
+			return storage.ErrProfileNotFound
+		}
+		if other := cfg.ProfileByName(name); other != nil && other.ID != id {
+			return fmt.Errorf("a profile named %q already exists", name)
+		}
+		profile.Name = name
+		return nil
+	})
+}
+
+// DeleteProfile removes a profile that no session or schedule uses
+func (a *App) DeleteProfile(id string) error {
+	return a.Store.Update(func(cfg *storage.Config) error {
+		if cfg.Profile(id) == nil {
+			return storage.ErrProfileNotFound
+		}
+		if len(cfg.Profiles) == 1 {
+			return storage.ErrLastProfile
+		}
+		if watchdog.Evaluate(*cfg, a.now()).CoversProfile(id) {
+			return errors.New("cannot delete a profile during its focus session")
+		}
+		for _, s := range cfg.Schedules {
+			if s.ProfileID == id {
+				return fmt.Errorf("profile is used by schedule %q", s.Name)
+			}
+		}
+
+		profiles := []storage.Profile{}
+		for _, p := range cfg.Profiles {
+			if p.ID != id {
+				profiles = append(profiles, p)
+			}
+		}
+		cfg.Profiles = profiles
+		if cfg.ActiveProfileID == id {
+			cfg.ActiveProfileID = profiles[0].ID
+		}
+		return nil
+	})
+}
+
+// SetActiveProfile selects the profile that the app and site methods edit
+// and that sessions use when no profile is given
+func (a *App) SetActiveProfile(id string) error {
+	return a.Store.Update(func(cfg *storage.Config) error {
+		if cfg.Profile(id) == nil {
+			return storage.ErrProfileNotFound
+		}
+		// Schedules without a profile follow the active one, so switching
+		// would change what a running schedule blocks
+		for _, s := range watchdog.Evaluate(*cfg, a.now()).ActiveSchedules {
+			if cfg.Profile(s.ProfileID) == nil && cfg.ActiveProfileID != id {
+				return errors.New("cannot switch profiles while a schedule using the active profile is running")
+			}
+		}
+		cfg.ActiveProfileID = id
+		return nil
+	})
+}
+
+// SetProfileAction sets what is done with processes matched by a profile's
+// rules that have no action of their own: "kill", "suspend", "notify" or
+// "log".
+func (a *App) SetProfileAction(id, action string) error {
+	profileAction := storage.Action(action)
+	if !storage.ValidAction(profileAction) {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		profile := cfg.Profile(id)
+		if profile == nil {
+			return storage.ErrProfileNotFound
+		}
+		next := storage.Profile{Action: profileAction}
+		if actionRank[next.EffectiveAction()] < actionRank[profile.EffectiveAction()] && watchdog.Evaluate(*cfg, a.now()).CoversProfile(id) {
+			return errors.New("cannot soften a profile's action during its focus session")
+		}
+		profile.Action = profileAction
+		return nil
+	})
+}
+
+// activeProfileLocked refuses removals from the active profile while a
+// session enforces it. Other profiles stay editable.
+func activeProfileLocked(cfg *storage.Config, now time.Time) bool {
+	return watchdog.Evaluate(*cfg, now).CoversProfile(cfg.ActiveProfile().ID)
+}
@@ -0,0 +1,125 @@
+package bridge
+
+import (
+	"errors"
+	"focus-lock/backend/clock"
+	"focus-lock/backend/storage"
+	"testing"
+	"time"
+)
+
+// testApp returns an App on a store in a temp dir, on a fake clock.
+func testApp(t *testing.T, clk *clock.Fake) *App {
+	t.Helper()
+	store, err := storage.NewStoreWithBackup(t.TempDir(), storage.NewMemoryBackupStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetClock(clk)
+	return &App{Store: store}
+}
+
+func TestProfileCRUD(t *testing.T) {
+	a := testApp(t, clock.NewFake(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)))
+	def := a.GetActiveProfile()
+
+	work, err := a.CreateProfile(" Work ")
+	if err != nil || work.Name != "Work" {
+		t.Fatalf("CreateProfile = %+v, %v", work, err)
+	}
+	if _, err := a.CreateProfile("work"); err == nil {
+		t.Error("created a second profile named work")
+	}
+	if _, err := a.CreateProfile("  "); err == nil {
+		t.Error("created a profile without a name")
+	}
+	if got := a.GetProfiles(); len(got) != 2 {
+		t.Fatalf("profiles = %+v, want 2", got)
+	}
+
+	if err := a.RenameProfile(work.ID, "Study"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RenameProfile(work.ID, def.Name); err == nil {
+		t.Error("renamed a profile to the name of another")
+	}
+	if err := a.RenameProfile("missing", "Other"); !errors.Is(err, storage.ErrProfileNotFound) {
+		t.Errorf("rename of an unknown profile: err = %v", err)
+	}
+
+	if err := a.SetActiveProfile(work.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.GetActiveProfile(); got.ID != work.ID || got.Name != "Study" {
+		t.Fatalf("active profile = %+v, want the renamed one", got)
+	}
+
+	// Deleting the active profile selects another
+	if err := a.DeleteProfile(work.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.GetActiveProfile(); got.ID != def.ID {
+		t.Fatalf("active profile = %+v after delete, want %s", got, def.ID)
+	}
+	if err := a.DeleteProfile(def.ID); !errors.Is(err, storage.ErrLastProfile) {
+		t.Errorf("delete of the last profile: err = %v", err)
+	}
+	if err := a.DeleteProfile(work.ID); !errors.Is(err, storage.ErrProfileNotFound) {
+		t.Errorf("second delete: err = %v", err)
+	}
+}
+
+func TestRunningSessionProfileLocked(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC))
+	a := testApp(t, clk)
+	work, err := a.CreateProfile("Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := a.CreateProfile("Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetActiveProfile(work.ID); err != nil {
+		t.Fatal(err)
+	}
+	err = a.Store.UpdateAtomic(func(cfg *storage.Config) {
+		cfg.Profile(work.ID).BlockedSites = []string{"reddit.com"}
+		cfg.SessionProfileID = work.ID
+		cfg.LockEndTime = clk.Now().Add(time.Hour)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refused := []struct {
+		name string
+		edit func() error
+	}{
+		{"delete", func() error { return a.DeleteProfile(work.ID) }},
+		{"remove a site", func() error { return a.RemoveBlockedSite("reddit.com") }},
+		{"soften the action", func() error { return a.SetProfileAction(work.ID, string(storage.ActionLog)) }},
+	}
+	for _, tt := range refused {
+		if err := tt.edit(); err == nil {
+			t.Errorf("%s: allowed during the profile's session", tt.name)
+		}
+	}
+	if cfg := a.Store.Snapshot(); cfg.Profile(work.ID) == nil || len(cfg.Profile(work.ID).BlockedSites) != 1 {
+		t.Fatalf("profile changed during its session: %+v", cfg.Profile(work.ID))
+	}
+
+	// Other profiles stay editable
+	if err := a.SetProfileAction(other.ID, string(storage.ActionLog)); err != nil {
+		t.Errorf("editing another profile: %v", err)
+	}
+	if err := a.DeleteProfile(other.ID); err != nil {
+		t.Errorf("deleting another profile: %v", err)
+	}
+
+	// And this one once the session is over
+	clk.Advance(2 * time.Hour)
+	if err := a.DeleteProfile(work.ID); err != nil {
+		t.Errorf("delete after the session: %v", err)
+	}
+}
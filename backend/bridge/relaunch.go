@@ -0,0 +1,33 @@
+package bridge
+
+import (
+	"errors"
+	"focus-lock/backend/storage"
+	"focus-lock/backend/watchdog"
+)
+
+// GetRelaunchPolicy returns how apps that keep being relaunched are dealt with
+func (a *App) GetRelaunchPolicy() storage.RelaunchPolicy {
+	a.Store.Load()
+	return a.Store.Snapshot().RelaunchPolicy
+}
+
+// SetRelaunchPolicy updates the relaunch loop escalation. During an active
+// session it can only be made stricter.
+func (a *App) SetRelaunchPolicy(policy storage.RelaunchPolicy) error {
+	return a.Store.Update(func(cfg *storage.Config) error {
+		current := cfg.RelaunchPolicy
+		weaker := (current.EndParent && !policy.EndParent) || (current.Quarantine && !policy.Quarantine)
+		if weaker && watchdog.Evaluate(*cfg, a.now()).SessionActive {
+			return errors.New("cannot relax the relaunch policy during an active focus session")
+		}
+
+		cfg.RelaunchPolicy = policy
+		return nil
+	})
+}
+
+// GetQuarantinedFiles returns the executables renamed until the session ends
+func (a *App) GetQuarantinedFiles() ([]storage.QuarantinedFile, error) {
+	return a.Store.Quarantine().List()
+}
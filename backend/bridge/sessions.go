@@ -0,0 +1,42 @@
+package bridge
+
+import (
+	"focus-lock/backend/storage"
+	"time"
+)
+
+// GetSessionHistory returns the lock sessions that overlap the given range,
+// newest first. Bounds are Unix seconds; 0 leaves that side open.
+func (a *App) GetSessionHistory(from, to int64) ([]storage.Session, error) {
+	var fromTime, toTime time.Time
+	if from > 0 {
+		fromTime = time.Unix(from, 0)
+	}
+	if to > 0 {
+		toTime = time.Unix(to, 0)
+	}
+
+	sessions, err := a.Store.Sessions().Query(fromTime, toTime)
+	if err != nil {
+		return []storage.Session{}, err
+	}
+
+	reversed := make([]storage.Session, 0, len(sessions))
+	for i := len(sessions) - 1; i >= 0; i-- {
+		reversed = append(reversed, sessions[i])
+	}
+	return reversed, nil
+}
+
+// endManualSessions closes any running manual session at end.
+func (a *App) endManualSessions(end time.Time) {
+	open, err := a.Store.Sessions().OpenSessions()
+	if err != nil {
+		return
+	}
+	for _, sess := range open {
+		if sess.Trigger == storage.TriggerManual {
+			_ = a.Store.EndSession(sess.ID, end)
+		}
+	}
+}
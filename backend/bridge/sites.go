@@ -4,136 +4,150 @@ import (
 	"errors"
 	"fmt"
 	"focus-lock/backend/blocking/hosts"
-	"focus-lock/backend/watchdog"
+	"focus-lock/backend/storage"
 	"sort"
-	"time"
 )
 
-// GetBlockedSites returns the list of blocked websites
+// GetBlockedSites returns the active profile's list of blocked websites
 func (a *App) GetBlockedSites() []string {
 	a.Store.Load()
-	sort.Strings(a.Store.Data.BlockedSites)
-	return a.Store.Data.BlockedSites
+	config := a.Store.Snapshot()
+	profile := config.ActiveProfile()
+	sort.Strings(profile.BlockedSites)
+	return profile.BlockedSites
 }
 
-// AddBlockedSite adds a website to the blocked list
+// AddBlockedSite adds a website to the active profile's blocked list
 func (a *App) AddBlockedSite(url string) error {
-	a.Store.Load()
-	// Simple duplicate check
-	for _, existing := range a.Store.Data.BlockedSites {
-		if existing == url {
-			return nil
+	added := false
+	err := a.Store.Update(func(cfg *storage.Config) error {
+		profile := cfg.ActiveProfile()
+		// Simple duplicate check
+		for _, existing := range profile.BlockedSites {
+			if existing == url {
+				return nil
+			}
 		}
+		profile.BlockedSites = append(profile.BlockedSites, url)
+		sort.Strings(profile.BlockedSites)
+		added = true
+		return nil
+	})
+	if err != nil || !added {
+		return err
 	}
-	a.Store.Data.BlockedSites = append(a.Store.Data.BlockedSites, url)
-	sort.Strings(a.Store.Data.BlockedSites)
 
 	// Try to update hosts immediately (best effort)
 	// If it fails (User mode), ignore it. Ghost will handle it.
-	if err := hosts.Block(a.Store.Data.BlockedSites); err != nil {
+	if err := a.blockActiveSites(); err != nil {
 		fmt.Println("Warning: Failed to block sites immediately (likely Permission Denied):", err)
 	}
-
-	return a.Store.Save()
+	return nil
 }
 
-// RemoveBlockedSite removes a website from the blocked list
+// RemoveBlockedSite removes a website from the active profile's blocked list
 func (a *App) RemoveBlockedSite(url string) error {
-	a.Store.Load()
-
-	// Check if session is active - prevent removal during active session
-	manualActive := !a.Store.Data.LockEndTime.IsZero() && time.Now().Before(a.Store.Data.LockEndTime)
-	scheduleActive := watchdog.IsScheduleActive(a.Store.Data.Schedules)
-	if manualActive || scheduleActive {
-		return errors.New("cannot remove sites during an active focus session")
-	}
+	err := a.Store.Update(func(cfg *storage.Config) error {
+		// Check if a session enforces this profile - prevent removal during it
+		if activeProfileLocked(cfg, a.now()) {
+			return errors.New("cannot remove sites during an active focus session")
+		}
 
-	newSites := []string{}
-	for _, existing := range a.Store.Data.BlockedSites {
-		if existing != url {
-			newSites = append(newSites, existing)
+		profile := cfg.ActiveProfile()
+		newSites := []string{}
+		for _, existing := range profile.BlockedSites {
+			if existing != url {
+				newSites = append(newSites, existing)
+			}
 		}
+		profile.BlockedSites = newSites
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	a.Store.Data.BlockedSites = newSites
 
 	// Try to update hosts immediately (best effort)
-	if err := hosts.Block(a.Store.Data.BlockedSites); err != nil {
+	if err := a.blockActiveSites(); err != nil {
 		fmt.Println("Warning: Failed to unblock sites immediately:", err)
 	}
-
-	return a.Store.Save()
+	return nil
 }
 
-// AddBlockedSites adds multiple websites to the blocked list
+// AddBlockedSites adds multiple websites to the active profile's blocked list
 func (a *App) AddBlockedSites(urls []string) error {
-	a.Store.Load()
-	existingMap := make(map[string]bool)
-	for _, s := range a.Store.Data.BlockedSites {
-		existingMap[s] = true
-	}
-
 	changed := false
-	for _, url := range urls {
-		if !existingMap[url] {
-			a.Store.Data.BlockedSites = append(a.Store.Data.BlockedSites, url)
-			existingMap[url] = true
-			changed = true
+	err := a.Store.Update(func(cfg *storage.Config) error {
+		profile := cfg.ActiveProfile()
+		existingMap := make(map[string]bool)
+		for _, s := range profile.BlockedSites {
+			existingMap[s] = true
 		}
-	}
 
-	if !changed {
+		for _, url := range urls {
+			if !existingMap[url] {
+				profile.BlockedSites = append(profile.BlockedSites, url)
+				existingMap[url] = true
+				changed = true
+			}
+		}
+		sort.Strings(profile.BlockedSites)
 		return nil
+	})
+	if err != nil || !changed {
+		return err
 	}
-	sort.Strings(a.Store.Data.BlockedSites)
 
 	// Try to update hosts immediately (best effort)
-	if err := hosts.Block(a.Store.Data.BlockedSites); err != nil {
+	if err := a.blockActiveSites(); err != nil {
 		fmt.Println("Warning: Failed to block sites immediately:", err)
 	}
-
-	return a.Store.Save()
+	return nil
 }
 
-// RemoveBlockedSites removes multiple websites from the blocked list
+// RemoveBlockedSites removes multiple websites from the active profile's blocked list
 func (a *App) RemoveBlockedSites(urls []string) error {
-	a.Store.Load()
-
-	// Check if session is active - prevent removal during active session
-	manualActive := !a.Store.Data.LockEndTime.IsZero() && time.Now().Before(a.Store.Data.LockEndTime)
-	scheduleActive := watchdog.IsScheduleActive(a.Store.Data.Schedules)
-	if manualActive || scheduleActive {
-		return errors.New("cannot remove sites during an active focus session")
-	}
-
-	toRemove := make(map[string]bool)
-	for _, url := range urls {
-		toRemove[url] = true
-	}
+	return a.Store.Update(func(cfg *storage.Config) error {
+		// Check if a session enforces this profile - prevent removal during it
+		if activeProfileLocked(cfg, a.now()) {
+			return errors.New("cannot remove sites during an active focus session")
+		}
 
-	newSites := []string{}
-	for _, existing := range a.Store.Data.BlockedSites {
-		if !toRemove[existing] {
-			newSites = append(newSites, existing)
+		toRemove := make(map[string]bool)
+		for _, url := range urls {
+			toRemove[url] = true
 		}
-	}
 
-	if len(newSites) == len(a.Store.Data.BlockedSites) {
+		profile := cfg.ActiveProfile()
+		newSites := []string{}
+		for _, existing := range profile.BlockedSites {
+			if !toRemove[existing] {
+				newSites = append(newSites, existing)
+			}
+		}
+		profile.BlockedSites = newSites
 		return nil
-	}
-
-	a.Store.Data.BlockedSites = newSites
-	return a.Store.Save()
+	})
 }
 
-// SetBlockCommonVPN enables or disables blocking of common VPN sites
+// SetBlockCommonVPN enables or disables blocking of common VPN sites in the active profile
 func (a *App) SetBlockCommonVPN(enabled bool) error {
-	a.Store.Load()
-	a.Store.Data.BlockCommonVPN = enabled
-	return a.Store.Save()
+	return a.Store.UpdateAtomic(func(cfg *storage.Config) {
+		cfg.ActiveProfile().BlockCommonVPN = enabled
+	})
 }
 
-// GetBlockCommonVPN returns whether common VPN blocking is enabled
+// GetBlockCommonVPN returns whether the active profile blocks common VPNs
 func (a *App) GetBlockCommonVPN() bool {
 	a.Store.Load()
-	return a.Store.Data.BlockCommonVPN
+	config := a.Store.Snapshot()
+	return config.ActiveProfile().BlockCommonVPN
+}
+
+// blockActiveSites writes the active profile's sites to the hosts file,
+// under the store's lock so that it does not race the enforcer's writes.
+func (a *App) blockActiveSites() error {
+	return a.Store.UpdateHosts(func(cfg *storage.Config, _ bool) (bool, error) {
+		return true, hosts.Block(cfg.ActiveProfile().BlockedSites)
+	})
 }
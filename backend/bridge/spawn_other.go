@@ -4,12 +4,13 @@ package bridge
 
 import (
 	"fmt"
+	"focus-lock/backend/datadir"
 	"os/exec"
 )
 
 func spawnGhost(exePath, taskName string) error {
 	// On non-Windows platforms, just spawn directly without special process attributes
 	fmt.Println("Spawning Ghost process (non-Windows mode).")
-	cmd := exec.Command(exePath, "--enforce")
+	cmd := exec.Command(exePath, append([]string{"--enforce"}, datadir.ChildArgs()...)...)
 	return cmd.Start()
 }
@@ -4,6 +4,7 @@ package bridge
 
 import (
 	"fmt"
+	"focus-lock/backend/datadir"
 	"os/exec"
 	"syscall"
 )
@@ -20,7 +21,7 @@ func spawnGhost(exePath, taskName string) error {
 	// 2. Fallback: Direct spawn (User Mode)
 	// This won't be able to block websites, but will handle other logic or fail gracefully.
 	fmt.Println("Warning: Failed to run Scheduled Task (falling back to User Mode spawn). Blocking may fail.")
-	cmd := exec.Command(exePath, "--enforce")
+	cmd := exec.Command(exePath, append([]string{"--enforce"}, datadir.ChildArgs()...)...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		HideWindow:    true,
 		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | 0x00000008 | 0x01000000,
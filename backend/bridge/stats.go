@@ -0,0 +1,49 @@
+package bridge
+
+import (
+	"errors"
+	"focus-lock/backend/storage"
+	"time"
+)
+
+// GetStatsRollup returns usage statistics in buckets of the given
+// granularity ("hour", "day" or "week"), oldest first. Bounds are Unix
+// seconds; 0 leaves that side open.
+func (a *App) GetStatsRollup(granularity string, from, to int64) ([]storage.StatsBucket, error) {
+	g := storage.Granularity(granularity)
+	if g != storage.Hourly && g != storage.Daily && g != storage.Weekly {
+		return []storage.StatsBucket{}, errors.New("granularity must be hour, day or week")
+	}
+
+	var fromTime, toTime time.Time
+	if from > 0 {
+		fromTime = time.Unix(from, 0)
+	}
+	if to > 0 {
+		toTime = time.Unix(to, 0)
+	}
+
+	buckets, err := a.Store.Stats().Rollup(g, fromTime, toTime)
+	if err != nil {
+		return []storage.StatsBucket{}, err
+	}
+	return buckets, nil
+}
+
+// GetStatsRetention returns how long each stats resolution is kept
+func (a *App) GetStatsRetention() storage.StatsRetention {
+	a.Store.Load()
+	return a.Store.Snapshot().StatsRetention
+}
+
+// SetStatsRetention updates the stats retention. Shorter retention only
+// coarsens history; all-time totals are kept.
+func (a *App) SetStatsRetention(retention storage.StatsRetention) error {
+	if retention.RawHours < 0 || retention.HourlyDays < 0 || retention.DailyDays < 0 || retention.WeeklyWeeks < 0 {
+		return errors.New("retention cannot be negative")
+	}
+
+	return a.Store.UpdateAtomic(func(cfg *storage.Config) {
+		cfg.StatsRetention = retention
+	})
+}
@@ -0,0 +1,50 @@
+package bridge
+
+import (
+	"errors"
+	"focus-lock/backend/storage"
+	"focus-lock/backend/watchdog"
+)
+
+// GetTamperEvents returns recorded tamper incidents, newest first
+func (a *App) GetTamperEvents() ([]storage.TamperEvent, error) {
+	events, err := a.Store.TamperEvents()
+	if err != nil {
+		return []storage.TamperEvent{}, err
+	}
+
+	reversed := make([]storage.TamperEvent, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		reversed = append(reversed, events[i])
+	}
+	return reversed, nil
+}
+
+// GetTamperPolicy returns the penalty applied when tampering is detected
+func (a *App) GetTamperPolicy() storage.TamperPolicy {
+	a.Store.Load()
+	return a.Store.Snapshot().TamperPolicy
+}
+
+// SetTamperPolicy updates the tamper penalty. It cannot be changed during an
+// active session, otherwise it could be switched off right before tampering.
+func (a *App) SetTamperPolicy(policy storage.TamperPolicy) error {
+	if policy.ExtendLockMinutes < 0 {
+		return errors.New("lock extension cannot be negative")
+	}
+
+	return a.Store.Update(func(cfg *storage.Config) error {
+		if watchdog.Evaluate(*cfg, a.now()).SessionActive {
+			return errors.New("cannot change tamper policy during an active focus session")
+		}
+
+		cfg.TamperPolicy = policy
+		return nil
+	})
+}
+
+// RotateSigningKey replaces the config signing key, e.g. after a suspected
+// leak. Signatures made with the old key stay valid for a grace window.
+func (a *App) RotateSigningKey() error {
+	return a.Store.RotateKey()
+}
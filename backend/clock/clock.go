@@ -0,0 +1,75 @@
+// Package clock abstracts the wall clock so that schedule boundaries, pause
+// expiry and lock expiry can be tested without waiting in real time.
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time and makes tickers.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the part of time.Ticker the enforcer uses.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the system clock.
+type Real struct{}
+
+var _ Clock = Real{}
+
+func (Real) Now() time.Time { return time.Now() }
+
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// holder lets atomic.Value store Clocks of different concrete types.
+type holder struct {
+	c Clock
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(holder{Real{}})
+}
+
+// SetDefault replaces the clock behind Default, e.g. with an NTP-corrected
+// one once it is available. Stores and enforcers created earlier pick it up
+// too, since Default forwards every call.
+func SetDefault(c Clock) {
+	if c == nil {
+		c = Real{}
+	}
+	current.Store(holder{c})
+}
+
+// Default returns the process-wide clock. It is Real unless SetDefault was
+// called.
+func Default() Clock {
+	return defaultClock{}
+}
+
+type defaultClock struct{}
+
+func (defaultClock) Now() time.Time {
+	return current.Load().(holder).c.Now()
+}
+
+func (defaultClock) NewTicker(d time.Duration) Ticker {
+	return current.Load().(holder).c.NewTicker(d)
+}
@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when told to. Tickers made from it fire
+// as Advance or Set passes their due times. Meant for tests.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+var _ Clock = (*Fake)(nil)
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(f.now.Add(d))
+}
+
+// Set moves the clock to t. Moving backwards (like a user changing the
+// system time) is allowed; tickers then wait until their due time again.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(t)
+}
+
+func (f *Fake) setLocked(t time.Time) {
+	f.now = t
+	for _, tk := range f.tickers {
+		tk.fire(t)
+	}
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tk := &fakeTicker{
+		ch:     make(chan time.Time, 1),
+		period: d,
+		next:   f.now.Add(d),
+	}
+	f.tickers = append(f.tickers, tk)
+	return tk
+}
+
+type fakeTicker struct {
+	mu      sync.Mutex
+	ch      chan time.Time
+	period  time.Duration
+	next    time.Time
+	stopped bool
+}
+
+// fire delivers a tick if now has reached the due time. Like time.Ticker it
+// drops ticks the reader is too slow for rather than queueing them.
+func (tk *fakeTicker) fire(now time.Time) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	if tk.stopped || now.Before(tk.next) {
+		return
+	}
+	select {
+	case tk.ch <- now:
+	default:
+	}
+	for !now.Before(tk.next) {
+		tk.next = tk.next.Add(tk.period)
+	}
+}
+
+func (tk *fakeTicker) C() <-chan time.Time { return tk.ch }
+
+func (tk *fakeTicker) Stop() {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	tk.stopped = true
+}
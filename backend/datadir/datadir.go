@@ -0,0 +1,224 @@
+// Package datadir resolves the directory that holds the config, logs, stats
+// and the ghost executable. Every subsystem gets its paths from here so that
+// several isolated instances can run side by side.
+package datadir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	// EnvHome overrides the data directory, like the --data-dir flag.
+	EnvHome = "FOCUSLOCK_HOME"
+
+	// FlagDataDir selects the data directory on the command line.
+	FlagDataDir = "--data-dir"
+	// FlagPortable keeps all data next to the executable.
+	FlagPortable = "--portable"
+
+	// PortableMarker next to the executable turns on portable mode without a flag.
+	PortableMarker = "portable"
+
+	defaultDirName  = "FocusLock"
+	portableDirName = "data"
+)
+
+// Mode says where the data directory came from.
+type Mode string
+
+const (
+	ModeDefault  Mode = "default"  // os.UserConfigDir()/FocusLock
+	ModeFlag     Mode = "flag"     // --data-dir
+	ModeEnv      Mode = "env"      // FOCUSLOCK_HOME
+	ModePortable Mode = "portable" // <exe dir>/data
+)
+
+var (
+	mu           sync.Mutex
+	flagDir      string
+	flagPortable bool
+	envIgnored   bool
+	resolved     string
+	resolvedMode Mode
+)
+
+// ParseArgs consumes --data-dir and --portable from args and returns the
+// remaining arguments in order. It must run before the first call to Dir.
+func ParseArgs(args []string) ([]string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == FlagPortable:
+			flagPortable = true
+		case arg == FlagDataDir:
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("%s needs a directory", FlagDataDir)
+			}
+			i++
+			flagDir = args[i]
+		case strings.HasPrefix(arg, FlagDataDir+"="):
+			flagDir = strings.TrimPrefix(arg, FlagDataDir+"=")
+			if flagDir == "" {
+				return nil, fmt.Errorf("%s needs a directory", FlagDataDir)
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	resolved, resolvedMode = "", ""
+	return rest, nil
+}
+
+// IgnoreEnv makes Dir skip FOCUSLOCK_HOME. The ghost calls it: it is always
+// told its directory on the command line, and a variable in its environment
+// must not point it at another, unlocked config.
+func IgnoreEnv() {
+	mu.Lock()
+	defer mu.Unlock()
+	envIgnored = true
+	resolved, resolvedMode = "", ""
+}
+
+// Dir returns the data directory, creating it if needed. The order is
+// --data-dir, --portable, FOCUSLOCK_HOME, a portable marker next to the
+// executable, and finally the user's config directory.
+func Dir() (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if resolved != "" {
+		return resolved, nil
+	}
+
+	dir, mode, err := resolve()
+	if err != nil {
+		return "", err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", err
+	}
+	// Children of the default installation are passed its directory
+	if def, err := defaultDir(); err == nil && sameDir(dir, def) {
+		mode = ModeDefault
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	resolved, resolvedMode = dir, mode
+	return dir, nil
+}
+
+func resolve() (string, Mode, error) {
+	if flagDir != "" {
+		return flagDir, ModeFlag, nil
+	}
+	if flagPortable {
+		dir, err := portableDir()
+		return dir, ModePortable, err
+	}
+	if env := os.Getenv(EnvHome); env != "" && !envIgnored {
+		return env, ModeEnv, nil
+	}
+	if dir, err := portableDir(); err == nil {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dir), PortableMarker)); err == nil {
+			return dir, ModePortable, nil
+		}
+	}
+
+	dir, err := defaultDir()
+	return dir, ModeDefault, err
+}
+
+// defaultDir is the directory of the normal per-user installation.
+func defaultDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config dir: %w", err)
+	}
+	return filepath.Join(configDir, defaultDirName), nil
+}
+
+// sameDir compares two absolute directories the way the file system does.
+func sameDir(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// portableDir is the data directory used in portable mode.
+func portableDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolvedExe, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolvedExe
+	}
+	return filepath.Join(filepath.Dir(exe), portableDirName), nil
+}
+
+// Path joins elem onto the data directory.
+func Path(elem ...string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{dir}, elem...)...), nil
+}
+
+// CurrentMode reports where the data directory came from.
+func CurrentMode() Mode {
+	if _, err := Dir(); err != nil {
+		return ModeDefault
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return resolvedMode
+}
+
+// IsDefault reports whether this is the normal per-user installation, as
+// opposed to an isolated instance with its own directory.
+func IsDefault() bool {
+	return CurrentMode() == ModeDefault
+}
+
+// ChildArgs returns the arguments a spawned process (the ghost, or its
+// scheduled task) needs to resolve the same directory. The ghost runs from
+// a copy in Bin, so portable mode cannot be rediscovered from its location.
+// The default directory is passed too, so that the ghost never falls back
+// to FOCUSLOCK_HOME; it still counts as the default installation there.
+func ChildArgs() []string {
+	dir, err := Dir()
+	if err != nil {
+		return nil
+	}
+	return []string{FlagDataDir, dir}
+}
+
+// InstanceSuffix distinguishes named objects such as mutexes between
+// instances. It is empty for the default installation so that existing
+// names stay unchanged.
+func InstanceSuffix() string {
+	if IsDefault() {
+		return ""
+	}
+	dir, err := Dir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return "-" + hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,103 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reset forgets the parsed flags and the resolved directory.
+func reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	flagDir, flagPortable, envIgnored = "", false, false
+	resolved, resolvedMode = "", ""
+}
+
+func TestDirPrecedence(t *testing.T) {
+	// Keep the default directory out of the real profile
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("APPDATA", home)
+	t.Setenv("HOME", home)
+	def, err := defaultDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	portable, err := portableDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(filepath.Dir(portable), PortableMarker)
+	flag, env := t.TempDir(), t.TempDir()
+
+	tests := []struct {
+		name      string
+		args      []string
+		env       string
+		marker    bool
+		ignoreEnv bool
+		wantDir   string
+		wantMode  Mode
+	}{
+		{"flag first", []string{FlagDataDir, flag, FlagPortable}, env, true, false, flag, ModeFlag},
+		{"flag with =", []string{FlagDataDir + "=" + flag}, env, false, false, flag, ModeFlag},
+		{"portable flag over env", []string{FlagPortable}, env, true, false, portable, ModePortable},
+		{"env over marker", nil, env, true, false, env, ModeEnv},
+		{"marker over default", nil, "", true, false, portable, ModePortable},
+		{"default", nil, "", false, false, def, ModeDefault},
+		{"env ignored", nil, env, false, true, def, ModeDefault},
+		{"flag naming the default", []string{FlagDataDir, def}, env, false, false, def, ModeDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			t.Cleanup(reset)
+			t.Setenv(EnvHome, tt.env)
+			if tt.marker {
+				if err := os.WriteFile(marker, nil, 0644); err != nil {
+					t.Skipf("cannot write next to the test binary: %v", err)
+				}
+				t.Cleanup(func() {
+					os.Remove(marker)
+					os.RemoveAll(portable)
+				})
+			}
+			rest, err := ParseArgs(append(tt.args, "--enforce"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) != 1 || rest[0] != "--enforce" {
+				t.Fatalf("remaining args = %q, want [--enforce]", rest)
+			}
+			if tt.ignoreEnv {
+				IgnoreEnv()
+			}
+
+			dir, err := Dir()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameDir(dir, tt.wantDir) || CurrentMode() != tt.wantMode {
+				t.Fatalf("Dir = %s (%s), want %s (%s)", dir, CurrentMode(), tt.wantDir, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestParseArgsNeedsDirectory(t *testing.T) {
+	t.Cleanup(reset)
+	for _, args := range [][]string{
+		{FlagDataDir + "="},
+		{FlagDataDir, ""},
+		{FlagDataDir},
+	} {
+		reset()
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%q) accepted an empty directory", args)
+		}
+		if flagDir != "" {
+			t.Errorf("ParseArgs(%q) set the directory to %q", args, flagDir)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package obfuscation
 
 import (
 	"fmt"
+	"focus-lock/backend/datadir"
 	"io"
 	"os"
 	"path/filepath"
@@ -14,15 +15,12 @@ func GenerateTaskName() string {
 
 // SetupGhostExecutable duplicates the current executable to a hidden location with a new name
 func SetupGhostExecutable(originalPath, taskName string) (string, error) {
-	configDir, err := os.UserConfigDir()
+	// Use a subdirectory of the data directory (AppData/Roaming/FocusLock by
+	// default) to avoid permission issues with system folders
+	binDir, err := datadir.Path("Bin")
 	if err != nil {
-		return "", fmt.Errorf("failed to get user config dir: %w", err)
+		return "", fmt.Errorf("failed to get data dir: %w", err)
 	}
-
-	// Use a subdirectory in AppData/Roaming to look legit but be writable
-	// e.g. AppData/Roaming/Microsoft/Windows/Templates/Cache
-	// Using our own hidden folder for now to avoid permission issues with system folders
-	binDir := filepath.Join(configDir, "FocusLock", "Bin")
 	if err := os.MkdirAll(binDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create bin dir: %w", err)
 	}
@@ -4,8 +4,8 @@ package protection
 
 import (
 	"fmt"
+	"focus-lock/backend/datadir"
 	"os"
-	"path/filepath"
 	"time"
 	"unsafe"
 
@@ -23,9 +23,10 @@ var (
 func setCritical(enable bool) error {
 	// Debug logging helper
 	logErr := func(msg string) {
-		configDir, _ := os.UserConfigDir()
-		logPath := filepath.Join(configDir, "FocusLock", "protection_error.log")
-		_ = os.MkdirAll(filepath.Dir(logPath), 0755)
+		logPath, err := datadir.Path("protection_error.log")
+		if err != nil {
+			return
+		}
 		f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		defer f.Close()
 		f.WriteString(fmt.Sprintf("%s: %s\n", time.Now().Format(time.RFC3339), msg))
@@ -2,12 +2,14 @@ package scheduler
 
 import (
 	"fmt"
+	"focus-lock/backend/datadir"
 	"os/exec"
+	"strings"
 )
 
 // EnablePersistence registers the enforcement task securely.
 func EnablePersistence(exePath, taskName string) error {
-	// Command: <exePath> --enforce
+	// Command: <exePath> --enforce [--data-dir <dir>]
 	// /SC ONLOGON : Run when user logs on
 	// /RL HIGHEST : Run with highest privileges (Admin)
 	// /F : Force create
@@ -15,7 +17,7 @@ func EnablePersistence(exePath, taskName string) error {
 	args := []string{
 		"/create",
 		"/tn", taskName,
-		"/tr", fmt.Sprintf("\"%s\" --enforce", exePath),
+		"/tr", taskCommand(exePath),
 		"/sc", "ONLOGON",
 		"/rl", "HIGHEST",
 		"/f",
@@ -31,3 +33,45 @@ func DisablePersistence(taskName string) error {
 	}
 	return exec.Command("schtasks", "/delete", "/tn", taskName, "/f").Run()
 }
+
+// taskCommand is the command line the task runs. The data directory is
+// passed along, since the ghost runs from a copy elsewhere.
+func taskCommand(exePath string) string {
+	parts := []string{fmt.Sprintf("\"%s\"", exePath), "--enforce"}
+	for _, arg := range datadir.ChildArgs() {
+		parts = append(parts, quoteArg(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteArg quotes arg so that the ghost's command line parser (the
+// CommandLineToArgvW rules) gives it back unchanged: quotes are escaped,
+// and so are the backslashes in front of them or of the closing quote.
+func quoteArg(arg string) string {
+	if arg == "" {
+		return `""`
+	}
+	if !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\':
+			slashes++
+		case '"':
+			b.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		b.WriteByte(c)
+	}
+	b.WriteString(strings.Repeat(`\`, slashes))
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"focus-lock/backend/datadir"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuoteArg(t *testing.T) {
+	tests := []struct {
+		arg, want string
+	}{
+		{`C:\FocusLock`, `C:\FocusLock`},
+		{``, `""`},
+		{`C:\My Data`, `"C:\My Data"`},
+		{"tab\there", "\"tab\there\""},
+		{`C:\My Data\`, `"C:\My Data\\"`},
+		{`/tmp/say "hi"`, `"/tmp/say \"hi\""`},
+		{`a\"b`, `"a\\\"b"`},
+		{`a\\b c`, `"a\\b c"`}, // Backslashes not before a quote stay as they are
+	}
+	for _, tt := range tests {
+		if got := quoteArg(tt.arg); got != tt.want {
+			t.Errorf("quoteArg(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestTaskCommandQuotesDataDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), `my "focus" data`)
+	if _, err := datadir.ParseArgs([]string{datadir.FlagDataDir, dir}); err != nil {
+		t.Fatal(err)
+	}
+	got := taskCommand(`C:\Bin\ghost.exe`)
+	want := `"C:\Bin\ghost.exe" --enforce --data-dir "` + strings.ReplaceAll(dir, `"`, `\"`) + `"`
+	if got != want {
+		t.Fatalf("taskCommand = %s, want %s", got, want)
+	}
+}
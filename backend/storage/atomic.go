@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	sigSuffix     = ".sig"
+	pendingSuffix = ".tmp"
+	prevSuffix    = ".prev"
+)
+
+// Returned by readGeneration when config files exist on disk but none of them
+// can be verified (tamper or corruption).
+var (
+	errSignatureMismatch = errors.New("no config generation with a valid signature")
+	errMissingSignature  = errors.New("config present but signature file missing")
+)
+
+// generation is one config/signature pair on disk.
+//
+// A save writes the "pending" pair first, rotates the "current" pair to
+// "previous", and finally renames "pending" into place. Whatever step a
+// crash interrupts, at least one complete, correctly signed pair survives.
+type generation struct {
+	cfgPath string
+	sigPath string
+}
+
+// commitStep is a point between the file operations of commitGeneration.
+type commitStep int
+
+const (
+	stepPendingConfig commitStep = iota + 1
+	stepPendingSig
+	stepRotateConfig
+	stepRotateSig
+	stepPromoteConfig
+	stepPromoteSig
+)
+
+// afterCommitStep is called after each step of commitGeneration; an error
+// stops the commit right there. Tests use it to simulate a crash.
+var afterCommitStep = func(commitStep) error { return nil }
+
+func (s *Store) pendingGeneration() generation {
+	return generation{s.filePath + pendingSuffix, s.filePath + pendingSuffix + sigSuffix}
+}
+
+func (s *Store) currentGeneration() generation {
+	return generation{s.filePath, s.filePath + sigSuffix}
+}
+
+func (s *Store) previousGeneration() generation {
+	return generation{s.filePath + prevSuffix, s.filePath + prevSuffix + sigSuffix}
+}
+
+// readGeneration returns the newest config body that verifies against one of
+// the signature files on disk. fromPrevious reports that only the previous
+// generation could be verified, i.e. the latest save was lost.
+//
+// Config and signature files are cross-matched because a crash between the
+// two final renames leaves the new config next to the pending signature.
+func (s *Store) readGeneration() (data []byte, fromPrevious bool, err error) {
+	pending, current, previous := s.pendingGeneration(), s.currentGeneration(), s.previousGeneration()
+
+	var sigs []string
+	for _, p := range []string{pending.sigPath, current.sigPath, previous.sigPath} {
+		if sig, err := readFileRetry(p); err == nil {
+			sigs = append(sigs, string(sig))
+		}
+	}
+
+	anyFound := false
+	for _, p := range []string{pending.cfgPath, current.cfgPath, previous.cfgPath} {
+		body, err := readFileRetry(p)
+		if err != nil {
+			continue
+		}
+		anyFound = true
+		for _, sig := range sigs {
+			if s.verify(body, sig) {
+				return body, p == previous.cfgPath, nil
+			}
+		}
+	}
+
+	if !anyFound {
+		return nil, false, os.ErrNotExist
+	}
+	if len(sigs) == 0 {
+		return nil, false, errMissingSignature
+	}
+	return nil, false, errSignatureMismatch
+}
+
+// currentGenerationErr explains why the current pair failed to verify.
+func (s *Store) currentGenerationErr() error {
+	current := s.currentGeneration()
+	if _, err := os.Stat(current.cfgPath); err != nil {
+		return err
+	}
+	if _, err := os.Stat(current.sigPath); err != nil {
+		return errMissingSignature
+	}
+	return errSignatureMismatch
+}
+
+// commitGeneration atomically replaces the current config/signature pair.
+// The current pair is kept as the previous generation only if it still
+// verifies, so a corrupt file never pushes out the last good one.
+func (s *Store) commitGeneration(data []byte, sig string) error {
+	pending, current, previous := s.pendingGeneration(), s.currentGeneration(), s.previousGeneration()
+
+	// 1. Write the new pair next to the live one
+	if err := writeFileSync(pending.cfgPath, data, 0644); err != nil {
+		return err
+	}
+	if err := afterCommitStep(stepPendingConfig); err != nil {
+		return err
+	}
+	if err := writeFileSync(pending.sigPath, []byte(sig), 0644); err != nil {
+		return err
+	}
+	if err := afterCommitStep(stepPendingSig); err != nil {
+		return err
+	}
+
+	// 2. Rotate the current pair to previous (only if it is a good one)
+	if s.generationValid(current) {
+		if err := os.Rename(current.cfgPath, previous.cfgPath); err != nil {
+			return err
+		}
+		if err := afterCommitStep(stepRotateConfig); err != nil {
+			return err
+		}
+		if err := os.Rename(current.sigPath, previous.sigPath); err != nil {
+			return err
+		}
+		if err := afterCommitStep(stepRotateSig); err != nil {
+			return err
+		}
+	}
+
+	// 3. Promote pending to current
+	if err := os.Rename(pending.cfgPath, current.cfgPath); err != nil {
+		return err
+	}
+	if err := afterCommitStep(stepPromoteConfig); err != nil {
+		return err
+	}
+	if err := os.Rename(pending.sigPath, current.sigPath); err != nil {
+		return err
+	}
+	if err := afterCommitStep(stepPromoteSig); err != nil {
+		return err
+	}
+
+	syncDir(filepath.Dir(s.filePath))
+	return nil
+}
+
+func (s *Store) generationValid(g generation) bool {
+	body, err := os.ReadFile(g.cfgPath)
+	if err != nil {
+		return false
+	}
+	sig, err := os.ReadFile(g.sigPath)
+	if err != nil {
+		return false
+	}
+	return s.verify(body, string(sig))
+}
+
+// readFileRetry retries briefly to ride out sharing violations
+// (e.g. antivirus or the other process holding the file).
+func readFileRetry(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	maxRetries := 3
+
+	for i := 0; i < maxRetries; i++ {
+		data, err = os.ReadFile(path)
+		if err == nil || os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return data, err
+}
+
+// writeFileSync writes data and flushes it to stable storage before returning.
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes directory entries so the renames survive power loss.
+// Best effort: Windows does not allow syncing a directory handle.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
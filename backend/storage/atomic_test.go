@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+var errCrash = errors.New("simulated crash")
+
+// saveMarker commits a config whose GhostTaskName is marker.
+func saveMarker(t *testing.T, s *Store, marker string) error {
+	t.Helper()
+	return s.UpdateAtomic(func(cfg *Config) {
+		cfg.GhostTaskName = marker
+	})
+}
+
+// readMarker reopens dir as a fresh process would and returns the marker of
+// the generation readGeneration recovers.
+func readMarker(t *testing.T, dir string, backup BackupStore) string {
+	t.Helper()
+	s, err := NewStoreWithBackup(dir, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := s.readGeneration()
+	if err != nil {
+		t.Fatalf("readGeneration: %v", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if events, _ := s.TamperEvents(); len(events) > 0 {
+		t.Fatalf("an interrupted save was reported as tampering: %+v", events)
+	}
+	return cfg.GhostTaskName
+}
+
+func TestCommitGenerationSurvivesCrashAtEveryStep(t *testing.T) {
+	tests := []struct {
+		step commitStep
+		want string
+	}{
+		{stepPendingConfig, "old"}, // New signature not written yet
+		{stepPendingSig, "new"},    // Complete pending pair
+		{stepRotateConfig, "new"},
+		{stepRotateSig, "new"},
+		{stepPromoteConfig, "new"}, // New config next to the pending signature
+		{stepPromoteSig, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want+"@"+stepName(tt.step), func(t *testing.T) {
+			dir, backup := t.TempDir(), NewMemoryBackupStore()
+			s, err := NewStoreWithBackup(dir, backup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Two saves, so that there are a current and a previous pair
+			if err := saveMarker(t, s, "older"); err != nil {
+				t.Fatal(err)
+			}
+			if err := saveMarker(t, s, "old"); err != nil {
+				t.Fatal(err)
+			}
+
+			afterCommitStep = func(step commitStep) error {
+				if step == tt.step {
+					return errCrash
+				}
+				return nil
+			}
+			err = saveMarker(t, s, "new")
+			afterCommitStep = func(commitStep) error { return nil }
+			if !errors.Is(err, errCrash) {
+				t.Fatalf("save did not stop at the step: %v", err)
+			}
+
+			if got := readMarker(t, dir, backup); got != tt.want {
+				t.Fatalf("recovered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitGenerationSurvivesTornPendingWrite(t *testing.T) {
+	dir, backup := t.TempDir(), NewMemoryBackupStore()
+	s, err := NewStoreWithBackup(dir, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveMarker(t, s, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The crash hit while the pending config was being written
+	pending := s.pendingGeneration()
+	if err := os.WriteFile(pending.cfgPath, []byte(`{"schema_version": 5, "ghost_ta`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readMarker(t, dir, backup); got != "old" {
+		t.Fatalf("recovered %q, want %q", got, "old")
+	}
+}
+
+func stepName(step commitStep) string {
+	return [...]string{"", "pending-config", "pending-sig", "rotate-config", "rotate-sig", "promote-config", "promote-sig"}[step]
+}
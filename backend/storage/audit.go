@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	auditFile = "audit.jsonl"
+
+	// maxAuditEntries bounds the audit log. Once it holds twice as many,
+	// it is cut back to the newest maxAuditEntries.
+	maxAuditEntries = 1000
+)
+
+// AuditEntry is one process a rule matched that was not killed: suspended,
+// reported to the user, or only logged because the rule is on trial.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Action    Action    `json:"action"`
+	App       string    `json:"app"`
+	PID       uint32    `json:"pid"`
+	StartTime time.Time `json:"start_time,omitempty"` // Tells a reused PID apart; zero if unknown
+	Path      string    `json:"path,omitempty"`
+	Reason    string    `json:"reason"` // The rule and what it matched
+}
+
+// sameProcess reports whether e and other are about the same action on the
+// same process, e.g. seen by both the UI and the ghost.
+func (e AuditEntry) sameProcess(other AuditEntry) bool {
+	return e.Action == other.Action && e.PID == other.PID && e.StartTime.Equal(other.StartTime)
+}
+
+// AuditStore is the log of enforcement actions other than kills, next to
+// config.json. Entries are also delivered to subscribers in this process,
+// which is how the UI learns about notify-only matches.
+type AuditStore struct {
+	mu   sync.Mutex
+	path string
+
+	subsMu sync.Mutex
+	subs   map[chan AuditEntry]struct{}
+}
+
+// NewAuditStore opens the audit log in dir.
+func NewAuditStore(dir string) *AuditStore {
+	return &AuditStore{path: filepath.Join(dir, auditFile)}
+}
+
+// Record appends e unless the other process already recorded the same
+// action on the same process, and passes it to this process's subscribers
+// either way.
+func (as *AuditStore) Record(e AuditEntry) error {
+	err := as.record(e)
+	as.publish(e)
+	return err
+}
+
+func (as *AuditStore) record(e AuditEntry) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	fl, err := acquireFileLock(as.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	entries, err := as.read()
+	if err != nil {
+		return err
+	}
+	for _, existing := range entries {
+		if existing.sameProcess(e) {
+			return nil
+		}
+	}
+
+	entries = append(entries, e)
+	if len(entries) >= 2*maxAuditEntries {
+		return as.rewrite(entries[len(entries)-maxAuditEntries:])
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(as.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite replaces the log with entries.
+func (as *AuditStore) rewrite(entries []AuditEntry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	tmp := as.path + pendingSuffix
+	if err := writeFileSync(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, as.path)
+}
+
+// read returns every entry, oldest first. Unreadable lines are skipped.
+func (as *AuditStore) read() ([]AuditEntry, error) {
+	f, err := os.Open(as.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(bytes.TrimSpace(scanner.Bytes()), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Entries returns the recorded entries since from, oldest first. A zero
+// from returns all of them.
+func (as *AuditStore) Entries(from time.Time) ([]AuditEntry, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	fl, err := acquireFileLock(as.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer fl.release()
+
+	entries, err := as.read()
+	if err != nil {
+		return nil, err
+	}
+	result := []AuditEntry{}
+	for _, e := range entries {
+		if from.IsZero() || !e.Time.Before(from) {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// Subscribe returns a channel of the entries recorded by this process and
+// a function that ends the subscription. Entries that do not fit the
+// buffer are dropped; the log has them all.
+func (as *AuditStore) Subscribe() (<-chan AuditEntry, func()) {
+	ch := make(chan AuditEntry, subscriberBuffer)
+
+	as.subsMu.Lock()
+	if as.subs == nil {
+		as.subs = make(map[chan AuditEntry]struct{})
+	}
+	as.subs[ch] = struct{}{}
+	as.subsMu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			as.subsMu.Lock()
+			defer as.subsMu.Unlock()
+			delete(as.subs, ch)
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+func (as *AuditStore) publish(e AuditEntry) {
+	as.subsMu.Lock()
+	defer as.subsMu.Unlock()
+	for ch := range as.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
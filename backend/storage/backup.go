@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoBackup is returned by LoadBackup when nothing has been saved yet.
+var ErrNoBackup = errors.New("no backup saved")
+
+// BackupStore is the secondary store that lives outside the config directory.
+// It holds the HMAC secret, the encryption key and a signed copy of the whole config so that
+// deleting or editing config.json cannot end a session early or empty the
+// blocklists.
+type BackupStore interface {
+	// GetOrCreateSecret retrieves the HMAC secret key or creates a new one if missing.
+	GetOrCreateSecret() ([]byte, error)
+	// SaveBackup persists a snapshot of the config.
+	SaveBackup(snap Snapshot) error
+	// LoadBackup retrieves the snapshot written by SaveBackup.
+	LoadBackup() (Snapshot, error)
+	// SaveKeyring persists the serialized signing keyring.
+	SaveKeyring(data []byte) error
+	// LoadKeyring returns the keyring, or ErrNoBackup if none was saved yet.
+	LoadKeyring() ([]byte, error)
+	// SaveEncryptionKey persists the key config.json is encrypted with.
+	SaveEncryptionKey(key []byte) error
+	// LoadEncryptionKey returns the encryption key, or ErrNoBackup if none was saved yet.
+	LoadEncryptionKey() ([]byte, error)
+}
+
+// Snapshot is a complete copy of config.json as it was committed.
+type Snapshot struct {
+	Config    []byte `json:"config"`    // Exact bytes of config.json
+	Signature string `json:"signature"` // HMAC over Config
+}
+
+// LegacyBackup is what builds before full snapshots kept in the secondary
+// store: the lock times alone, unsigned.
+type LegacyBackup struct {
+	LockEndTime       time.Time
+	RemainingDuration time.Duration
+	PausedUntil       time.Time
+}
+
+// LegacyBackupStore is implemented by backends that may still hold a
+// LegacyBackup from before an upgrade. The store falls back to it until its
+// first snapshot is saved, then deletes it.
+type LegacyBackupStore interface {
+	// LoadLegacyBackup returns the old lock times, or ErrNoBackup.
+	LoadLegacyBackup() (LegacyBackup, error)
+	// DeleteLegacyBackup removes them. Nothing to delete is not an error.
+	DeleteLegacyBackup() error
+}
+
+// encodeSnapshot serializes a snapshot into a single blob so that backends
+// can store the body and its signature in one atomic write.
+func encodeSnapshot(snap Snapshot) ([]byte, error) {
+	return json.Marshal(snap)
+}
+
+func decodeSnapshot(blob []byte) (Snapshot, error) {
+	var snap Snapshot
+	err := json.Unmarshal(blob, &snap)
+	return snap, err
+}
+
+// NewDefaultBackupStore returns the platform's backup store:
+// the registry on Windows, a file under the XDG state directory elsewhere.
+func NewDefaultBackupStore() BackupStore {
+	return newDefaultBackupStore()
+}
+
+// MemoryBackupStore keeps everything in process memory. Meant for tests.
+type MemoryBackupStore struct {
+	mu      sync.Mutex
+	secret  []byte
+	blob    []byte
+	keyring []byte
+	encKey  []byte
+}
+
+var _ BackupStore = (*MemoryBackupStore)(nil)
+
+func NewMemoryBackupStore() *MemoryBackupStore {
+	return &MemoryBackupStore{}
+}
+
+func (m *MemoryBackupStore) GetOrCreateSecret() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.secret == nil {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		m.secret = secret
+	}
+	return m.secret, nil
+}
+
+func (m *MemoryBackupStore) SaveBackup(snap Snapshot) error {
+	blob, err := encodeSnapshot(snap)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blob = blob
+	return nil
+}
+
+func (m *MemoryBackupStore) LoadBackup() (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.blob == nil {
+		return Snapshot{}, ErrNoBackup
+	}
+	return decodeSnapshot(m.blob)
+}
+
+func (m *MemoryBackupStore) SaveKeyring(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keyring = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemoryBackupStore) LoadKeyring() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.keyring == nil {
+		return nil, ErrNoBackup
+	}
+	return m.keyring, nil
+}
+
+func (m *MemoryBackupStore) SaveEncryptionKey(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encKey = append([]byte(nil), key...)
+	return nil
+}
+
+func (m *MemoryBackupStore) LoadEncryptionKey() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.encKey == nil {
+		return nil, ErrNoBackup
+	}
+	return m.encKey, nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	backupSecretFile  = "secret"
+	backupStateFile   = "backup.json"
+	backupKeyringFile = "keyring.json"
+	backupEncKeyFile  = "config.key"
+)
+
+// DefaultStateDir returns $XDG_STATE_HOME/focuslock, falling back to
+// ~/.local/state/focuslock as the XDG spec prescribes.
+func DefaultStateDir() string {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" || !filepath.IsAbs(base) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "focuslock")
+}
+
+// instanceBackupDir is where the isolated instance in dataDir keeps its
+// secondary store. It must not be inside dataDir: the store holds the
+// signing and encryption keys, and keys next to the config they protect
+// protect nothing.
+func instanceBackupDir(dataDir string) string {
+	sum := sha256.Sum256([]byte(dataDir))
+	return filepath.Join(instanceBackupRoot(), hex.EncodeToString(sum[:6]))
+}
+
+// moveBackupDir moves the files of a FileBackupStore from one directory to
+// another, unless the target exists already. They are copied, since the two
+// may be on different file systems, into a temporary directory that is
+// renamed into place, so that a crash leaves either store whole.
+func moveBackupDir(from, to string) error {
+	if _, err := os.Stat(to); err == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(from)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp := to + pendingSuffix
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	staged := NewFileBackupStore(tmp)
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), pendingSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(from, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := staged.writePrivate(e.Name(), data); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp, to); err != nil {
+		return err
+	}
+	return os.RemoveAll(from)
+}
+
+// FileBackupStore keeps the backup in a private directory, readable only by
+// the owning user. It is the default on platforms without a registry.
+type FileBackupStore struct {
+	dir string
+}
+
+var _ BackupStore = (*FileBackupStore)(nil)
+
+func NewFileBackupStore(dir string) *FileBackupStore {
+	return &FileBackupStore{dir: dir}
+}
+
+func (f *FileBackupStore) ensureDir() error {
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return err
+	}
+	// MkdirAll leaves an existing directory's mode alone
+	return os.Chmod(f.dir, 0700)
+}
+
+// writePrivate replaces name atomically with an owner-only file.
+func (f *FileBackupStore) writePrivate(name string, data []byte) error {
+	if err := f.ensureDir(); err != nil {
+		return err
+	}
+	path := filepath.Join(f.dir, name)
+	if err := writeFileSync(path+pendingSuffix, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+pendingSuffix, path); err != nil {
+		return err
+	}
+	syncDir(f.dir)
+	return nil
+}
+
+// GetOrCreateSecret retrieves the HMAC secret key or creates a new one if missing.
+func (f *FileBackupStore) GetOrCreateSecret() ([]byte, error) {
+	path := filepath.Join(f.dir, backupSecretFile)
+
+	if val, err := os.ReadFile(path); err == nil {
+		if hexStr := strings.TrimSpace(string(val)); hexStr != "" {
+			return hex.DecodeString(hexStr)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("secret read failed: %w", err)
+	}
+
+	// Generate new secret
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+	if err := f.writePrivate(backupSecretFile, []byte(hex.EncodeToString(bytes))); err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+// SaveBackup persists the config snapshot to backup.json
+func (f *FileBackupStore) SaveBackup(snap Snapshot) error {
+	blob, err := encodeSnapshot(snap)
+	if err != nil {
+		return err
+	}
+	return f.writePrivate(backupStateFile, blob)
+}
+
+// LoadBackup retrieves the config snapshot from backup.json
+func (f *FileBackupStore) LoadBackup() (Snapshot, error) {
+	blob, err := os.ReadFile(filepath.Join(f.dir, backupStateFile))
+	if os.IsNotExist(err) {
+		return Snapshot{}, ErrNoBackup
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return decodeSnapshot(blob)
+}
+
+// SaveKeyring persists the signing keyring to keyring.json
+func (f *FileBackupStore) SaveKeyring(data []byte) error {
+	return f.writePrivate(backupKeyringFile, data)
+}
+
+// LoadKeyring retrieves the signing keyring from keyring.json
+func (f *FileBackupStore) LoadKeyring() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(f.dir, backupKeyringFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoBackup
+	}
+	return data, err
+}
+
+// SaveEncryptionKey persists the config encryption key to config.key
+func (f *FileBackupStore) SaveEncryptionKey(key []byte) error {
+	return f.writePrivate(backupEncKeyFile, key)
+}
+
+// LoadEncryptionKey retrieves the config encryption key from config.key
+func (f *FileBackupStore) LoadEncryptionKey() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(f.dir, backupEncKeyFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoBackup
+	}
+	return data, err
+}
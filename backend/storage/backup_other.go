@@ -0,0 +1,14 @@
+//go:build !windows
+
+package storage
+
+import "path/filepath"
+
+func newDefaultBackupStore() BackupStore {
+	return NewFileBackupStore(DefaultStateDir())
+}
+
+// instanceBackupRoot holds the secondary stores of isolated instances.
+func instanceBackupRoot() string {
+	return filepath.Join(DefaultStateDir(), "instances")
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// legacyMemoryBackup is a MemoryBackupStore upgraded from a build that
+// only backed up the lock times.
+type legacyMemoryBackup struct {
+	*MemoryBackupStore
+	legacy *LegacyBackup
+}
+
+func (m *legacyMemoryBackup) LoadLegacyBackup() (LegacyBackup, error) {
+	if m.legacy == nil {
+		return LegacyBackup{}, ErrNoBackup
+	}
+	return *m.legacy, nil
+}
+
+func (m *legacyMemoryBackup) DeleteLegacyBackup() error {
+	m.legacy = nil
+	return nil
+}
+
+func TestLegacyBackupRestoresLockUntilFirstSnapshot(t *testing.T) {
+	lockEnd := time.Now().Add(time.Hour).Truncate(time.Second)
+	backup := &legacyMemoryBackup{
+		MemoryBackupStore: NewMemoryBackupStore(),
+		legacy:            &LegacyBackup{LockEndTime: lockEnd, RemainingDuration: time.Hour},
+	}
+
+	// config.json deleted right after the upgrade, during the lock
+	s, err := NewStoreWithBackup(t.TempDir(), backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	// Restored, plus the tamper penalty for the deleted config
+	if s.Data.LockEndTime.Before(lockEnd) {
+		t.Fatalf("LockEndTime = %v, want at least %v from the old backup", s.Data.LockEndTime, lockEnd)
+	}
+
+	// The restore saved a snapshot, which replaces the old values
+	if backup.legacy != nil {
+		t.Fatal("old lock times kept after a snapshot was saved")
+	}
+	if _, err := backup.LoadBackup(); err != nil {
+		t.Fatalf("no snapshot saved: %v", err)
+	}
+}
+
+func TestFileBackupStoreRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	f := NewFileBackupStore(dir)
+
+	// Nothing saved yet
+	if _, err := f.LoadBackup(); !errors.Is(err, ErrNoBackup) {
+		t.Fatalf("LoadBackup: err = %v, want ErrNoBackup", err)
+	}
+	if _, err := f.LoadKeyring(); !errors.Is(err, ErrNoBackup) {
+		t.Fatalf("LoadKeyring: err = %v, want ErrNoBackup", err)
+	}
+	if _, err := f.LoadEncryptionKey(); !errors.Is(err, ErrNoBackup) {
+		t.Fatalf("LoadEncryptionKey: err = %v, want ErrNoBackup", err)
+	}
+
+	snap := Snapshot{Config: []byte(`{"a": 1}`), Signature: "sig"}
+	if err := f.SaveBackup(snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveKeyring([]byte("ring")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveEncryptionKey([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := f.GetOrCreateSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("secret = %d bytes, err = %v", len(secret), err)
+	}
+
+	// A fresh store on the same directory reads it all back
+	f = NewFileBackupStore(dir)
+	if got, err := f.LoadBackup(); err != nil || !bytes.Equal(got.Config, snap.Config) || got.Signature != snap.Signature {
+		t.Fatalf("LoadBackup = %+v, %v", got, err)
+	}
+	if got, err := f.LoadKeyring(); err != nil || string(got) != "ring" {
+		t.Fatalf("LoadKeyring = %q, %v", got, err)
+	}
+	if got, err := f.LoadEncryptionKey(); err != nil || string(got) != "key" {
+		t.Fatalf("LoadEncryptionKey = %q, %v", got, err)
+	}
+	if again, err := f.GetOrCreateSecret(); err != nil || !bytes.Equal(again, secret) {
+		t.Fatal("secret was not kept")
+	}
+}
+
+func TestFileBackupStoreIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are ACLs on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "backup")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFileBackupStore(dir)
+	if err := f.SaveEncryptionKey([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.GetOrCreateSecret(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Fatalf("directory mode = %o, want 700", perm)
+	}
+	for _, name := range []string{backupEncKeyFile, backupSecretFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Fatalf("%s mode = %o, want 600", name, perm)
+		}
+	}
+}
+
+func TestIsolatedBackupMovesOutOfDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	to := instanceBackupDir(dataDir)
+	if strings.HasPrefix(to, dataDir) {
+		t.Fatalf("backup dir %s is inside the data directory", to)
+	}
+
+	// Left in the data directory by an older build
+	old := NewFileBackupStore(filepath.Join(dataDir, isolatedBackupDir))
+	if err := old.SaveEncryptionKey([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveIsolatedBackup(dataDir, to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, isolatedBackupDir)); !os.IsNotExist(err) {
+		t.Fatalf("old backup still in the data directory: %v", err)
+	}
+	if got, err := NewFileBackupStore(to).LoadEncryptionKey(); err != nil || string(got) != "key" {
+		t.Fatalf("moved key = %q, %v", got, err)
+	}
+
+	// An existing store is never overwritten
+	if err := old.SaveEncryptionKey([]byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveIsolatedBackup(dataDir, to); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := NewFileBackupStore(to).LoadEncryptionKey(); string(got) != "key" {
+		t.Fatalf("key = %q, the existing store was replaced", got)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func newDefaultBackupStore() BackupStore {
+	return NewRegistryStore()
+}
+
+// instanceBackupRoot holds the secondary stores of isolated instances, in
+// the local (not roaming) application data.
+func instanceBackupRoot() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "FocusLock", "Instances")
+}
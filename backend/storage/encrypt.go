@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	encAlgorithm = "AES-256-GCM"
+
+	// encAAD binds ciphertexts to their use, so an encrypted journal value
+	// cannot be passed off as a config body or the other way round.
+	encAADConfig  = "focuslock config"
+	encAADJournal = "focuslock journal"
+	encAADSession = "focuslock session"
+
+	gcmNonceSize = 12
+)
+
+// ErrNoEncryptionKey means config.json is encrypted but the secondary store
+// does not have the key (it was wiped or belongs to another install).
+var ErrNoEncryptionKey = errors.New("config is encrypted and the key is missing")
+
+// encryptedBody is what config.json holds when encryption is on. The HMAC
+// signature is computed over these bytes (encrypt-then-MAC).
+type encryptedBody struct {
+	Enc   string `json:"enc"`
+	KeyID string `json:"kid"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// sealedValue replaces a journal value while encryption is on.
+type sealedValue struct {
+	Sealed []byte `json:"sealed"`
+}
+
+// encryptionKey returns the config encryption key, creating and storing one
+// if create is set. Called with the store lock held.
+func (s *Store) encryptionKey(create bool) ([]byte, error) {
+	if s.encKey != nil {
+		return s.encKey, nil
+	}
+
+	key, err := s.backup.LoadEncryptionKey()
+	if errors.Is(err, ErrNoBackup) && create {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		err = s.backup.SaveEncryptionKey(key)
+	}
+	if errors.Is(err, ErrNoBackup) {
+		return nil, ErrNoEncryptionKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key has %d bytes, want 32", len(key))
+	}
+
+	s.encKey = key
+	return key, nil
+}
+
+func encrypt(key, plain []byte, aad string) (nonce, ciphertext []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plain, []byte(aad)), nil
+}
+
+func decrypt(key, nonce, ciphertext []byte, aad string) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcmNonceSize {
+		return nil, errors.New("invalid nonce")
+	}
+	return gcm.Open(nil, nonce, ciphertext, []byte(aad))
+}
+
+// encodeBody returns what goes into config.json for the config body plain:
+// plain itself, or its encryption if the config asks for it.
+func (s *Store) encodeBody(plain []byte) ([]byte, error) {
+	if !s.Data.EncryptAtRest {
+		return plain, nil
+	}
+
+	key, err := s.encryptionKey(true)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := encrypt(key, plain, encAADConfig)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(encryptedBody{
+		Enc:   encAlgorithm,
+		KeyID: keyIDFor(key),
+		Nonce: nonce,
+		Data:  ciphertext,
+	}, "", "  ")
+}
+
+// decodeBody reverses encodeBody. Plaintext bodies (including every file
+// written before encryption existed) are returned unchanged.
+func (s *Store) decodeBody(data []byte) (plain []byte, encrypted bool, err error) {
+	var body encryptedBody
+	if json.Unmarshal(data, &body) != nil || body.Enc == "" {
+		return data, false, nil
+	}
+	if body.Enc != encAlgorithm {
+		return nil, true, fmt.Errorf("unsupported config encryption %q", body.Enc)
+	}
+
+	key, err := s.encryptionKey(false)
+	if err != nil {
+		return nil, true, err
+	}
+	if body.KeyID != keyIDFor(key) {
+		return nil, true, fmt.Errorf("config encrypted with unknown key %s", body.KeyID)
+	}
+	plain, err = decrypt(key, body.Nonce, body.Data, encAADConfig)
+	if err != nil {
+		return nil, true, fmt.Errorf("config decryption failed: %w", err)
+	}
+	return plain, true, nil
+}
+
+// isEncryptedBody reports whether data is a config body encrypted by
+// encodeBody.
+func isEncryptedBody(data []byte) bool {
+	var body encryptedBody
+	return json.Unmarshal(data, &body) == nil && body.Enc != ""
+}
+
+// sealHistory runs after a save with encryption on. The first time, the
+// previous generation and the side stores still hold in plaintext what
+// config.json now hides: body is committed again to rotate out the
+// plaintext generation, and the journal values and planned session ends
+// written so far are sealed. Called with the store lock held.
+func (s *Store) sealHistory(body []byte, sig string) error {
+	prev, err := os.ReadFile(s.previousGeneration().cfgPath)
+	if err != nil || isEncryptedBody(prev) {
+		return nil
+	}
+	if err := s.commitGeneration(body, sig); err != nil {
+		return err
+	}
+
+	key, err := s.encryptionKey(true)
+	if err != nil {
+		return err
+	}
+	return errors.Join(s.sealJournalHistory(), s.sessions.sealPlannedEnds(key))
+}
+
+// sealJournalHistory seals the values of entries journaled before
+// encryption was turned on. The entries are MACed again, so a chain that
+// does not verify is left alone and its tampering stays visible.
+func (s *Store) sealJournalHistory() error {
+	entries, err := s.readJournal()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	if s.verifyChain(entries) != nil {
+		return nil
+	}
+	for i := range entries {
+		if err := s.sealJournalValues(entries[i].Changes); err != nil {
+			return err
+		}
+	}
+	return s.rechainJournal(entries)
+}
+
+// isSealedValue reports whether a journal value was sealed by
+// sealJournalValues.
+func isSealedValue(v json.RawMessage) bool {
+	return bytes.HasPrefix(v, []byte(`{"sealed"`))
+}
+
+// sealJournalValues encrypts the old and new values of changes in place,
+// so that the journal does not give away what config.json hides. Values
+// that are already sealed are kept.
+func (s *Store) sealJournalValues(changes []FieldChange) error {
+	if !s.Data.EncryptAtRest {
+		return nil
+	}
+	key, err := s.encryptionKey(true)
+	if err != nil {
+		return err
+	}
+
+	sealValue := func(v json.RawMessage) (json.RawMessage, error) {
+		if isSealedValue(v) {
+			return v, nil
+		}
+		nonce, ciphertext, err := encrypt(key, v, encAADJournal)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(sealedValue{Sealed: append(nonce, ciphertext...)})
+	}
+	for i := range changes {
+		if changes[i].Old, err = sealValue(changes[i].Old); err != nil {
+			return err
+		}
+		if changes[i].New, err = sealValue(changes[i].New); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openJournalValues decrypts values sealed by sealJournalValues in place.
+// Call it after the hash chain is verified, which covers the sealed form.
+// Values that cannot be decrypted are left sealed and reported.
+func (s *Store) openJournalValues(entries []JournalEntry) error {
+	var key []byte
+	var failed error
+	openValue := func(v json.RawMessage) json.RawMessage {
+		if !isSealedValue(v) {
+			return v
+		}
+		var sv sealedValue
+		if err := json.Unmarshal(v, &sv); err != nil || len(sv.Sealed) < gcmNonceSize {
+			failed = errors.New("unreadable sealed journal value")
+			return v
+		}
+		if key == nil {
+			k, err := s.encryptionKey(false)
+			if err != nil {
+				failed = err
+				return v
+			}
+			key = k
+		}
+		plain, err := decrypt(key, sv.Sealed[:gcmNonceSize], sv.Sealed[gcmNonceSize:], encAADJournal)
+		if err != nil {
+			failed = fmt.Errorf("journal decryption failed: %w", err)
+			return v
+		}
+		return plain
+	}
+
+	for i := range entries {
+		for j := range entries[i].Changes {
+			c := &entries[i].Changes[j]
+			c.Old, c.New = openValue(c.Old), openValue(c.New)
+		}
+	}
+	return failed
+}
+
+// sessionKey gives the session history the key for planned session ends,
+// and whether new ones are sealed. The session store asks before it takes
+// its own lock, never while holding it. Without a key, sealed ends read as
+// zero.
+func (s *Store) sessionKey() (key []byte, seal bool, err error) {
+	if err := s.lock(); err != nil {
+		return nil, false, err
+	}
+	defer s.unlock()
+
+	seal = s.Data.EncryptAtRest
+	key, err = s.encryptionKey(seal)
+	if err != nil && !seal {
+		return nil, false, nil
+	}
+	return key, seal, err
+}
+
+// sealTime encrypts t for the session history.
+func sealTime(key []byte, t time.Time) ([]byte, error) {
+	plain, err := t.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := encrypt(key, plain, encAADSession)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, ciphertext...), nil
+}
+
+// openTime reverses sealTime.
+func openTime(key, sealed []byte) (time.Time, error) {
+	var t time.Time
+	if len(sealed) < gcmNonceSize {
+		return t, errors.New("invalid sealed time")
+	}
+	plain, err := decrypt(key, sealed[:gcmNonceSize], sealed[gcmNonceSize:], encAADSession)
+	if err != nil {
+		return t, err
+	}
+	return t, t.UnmarshalText(plain)
+}
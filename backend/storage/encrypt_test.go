@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEnablingEncryptionSealsHistory(t *testing.T) {
+	s, err := NewStoreWithBackup(t.TempDir(), NewMemoryBackupStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	const endText = "2030-01-02T03:04:05"
+
+	if err := s.UpdateAtomic(func(cfg *Config) { cfg.LockEndTime = end }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sessions().Begin(Session{Trigger: TriggerManual, Start: time.Now(), PlannedEnd: end}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateAtomic(func(cfg *Config) { cfg.EncryptAtRest = true }); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		s.currentGeneration().cfgPath,
+		s.previousGeneration().cfgPath,
+		s.journalPath(),
+		s.Sessions().path,
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(endText)) {
+			t.Errorf("%s shows the lock end in plaintext:\n%s", path, data)
+		}
+	}
+
+	// Everything still reads back
+	if err := s.VerifyJournal(); err != nil {
+		t.Fatalf("journal does not verify after sealing: %v", err)
+	}
+	open, err := s.Sessions().OpenSessions()
+	if err != nil || len(open) != 1 {
+		t.Fatalf("open sessions = %d, err = %v", len(open), err)
+	}
+	if !open[0].PlannedEnd.Equal(end) {
+		t.Fatalf("planned end = %s, want %s", open[0].PlannedEnd, end)
+	}
+	if err := s.Load(); err != nil || !s.Snapshot().LockEndTime.Equal(end) {
+		t.Fatalf("Load: lock end = %s, err = %v", s.Snapshot().LockEndTime, err)
+	}
+}
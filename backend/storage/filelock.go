@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	lockSuffix       = ".lock"
+	lockTimeout      = 5 * time.Second
+	lockPollInterval = 10 * time.Millisecond
+)
+
+// ErrLockTimeout is returned when the other process holds the config lock
+// for longer than lockTimeout.
+var ErrLockTimeout = errors.New("timed out waiting for config lock")
+
+// fileLock is an exclusive OS-level advisory lock held on a file next to
+// config.json. It serializes load/modify/save between the UI process and
+// the ghost; Store.mu only covers goroutines within one process.
+type fileLock struct {
+	f *os.File
+}
+
+// acquireFileLock polls for the lock until timeout. Polling (rather than a
+// blocking call) keeps the timeout portable across flock and LockFileEx.
+func acquireFileLock(path string, timeout time.Duration) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			return &fileLock{f: f}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func (l *fileLock) release() {
+	if l == nil {
+		return
+	}
+	unlockFile(l.f)
+	l.f.Close()
+}
+
+// lock takes the in-process mutex and then the cross-process file lock.
+// Every public Store method that touches the files goes through it.
+func (s *Store) lock() error {
+	s.mu.Lock()
+	fl, err := acquireFileLock(s.filePath+lockSuffix, lockTimeout)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.flock = fl
+	return nil
+}
+
+func (s *Store) unlock() {
+	s.flock.release()
+	s.flock = nil
+	s.mu.Unlock()
+}
@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package storage
+
+import "os"
+
+// No advisory locking available; Store.mu still covers this process.
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) {}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const (
+	stressChildEnv   = "FOCUSLOCK_STRESS_DIR"
+	stressProcesses  = 4
+	stressIncrements = 25
+)
+
+// stressStore opens the store the stress processes share, with a backup
+// every process can see.
+func stressStore(dir string) (*Store, error) {
+	return NewStoreWithBackup(dir, NewFileBackupStore(filepath.Join(dir, isolatedBackupDir)))
+}
+
+// TestStoreStressChild is the child side of TestStoreMultiProcessStress. It
+// does nothing unless started by it.
+func TestStoreStressChild(t *testing.T) {
+	dir := os.Getenv(stressChildEnv)
+	if dir == "" {
+		t.Skip("only run as a child of TestStoreMultiProcessStress")
+	}
+	s, err := stressStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < stressIncrements; i++ {
+		err := s.UpdateAtomic(func(cfg *Config) {
+			cfg.EmergencyUnlocksUsed++
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestStoreMultiProcessStress runs real processes that increment a counter
+// in the same config at once. With the file lock, no increment is lost and
+// every file stays correctly signed.
+func TestStoreMultiProcessStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("spawns processes")
+	}
+	dir := t.TempDir()
+	s, err := stressStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	failures := make(chan string, stressProcesses)
+	for i := 0; i < stressProcesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestStoreStressChild$", "-test.count=1")
+			cmd.Env = append(os.Environ(), stressChildEnv+"="+dir)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				failures <- fmt.Sprintf("child %d: %v\n%s", i, err, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(failures)
+	for f := range failures {
+		t.Error(f)
+	}
+	if t.Failed() {
+		return
+	}
+
+	// The current generation verifies: no process saw a half-written one
+	data, fromPrevious, err := s.readGeneration()
+	if err != nil || fromPrevious {
+		t.Fatalf("readGeneration: fromPrevious = %v, err = %v", fromPrevious, err)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := stressProcesses * stressIncrements
+	if got := s.Data.EmergencyUnlocksUsed; got != want {
+		t.Fatalf("counter = %d, want %d: updates were lost\n%s", got, want, data)
+	}
+
+	backup, ok := s.loadBackupConfig()
+	if !ok {
+		t.Fatal("backup snapshot does not verify")
+	}
+	if backup.EmergencyUnlocksUsed != want {
+		t.Fatalf("backup counter = %d, want %d", backup.EmergencyUnlocksUsed, want)
+	}
+
+	entries, err := s.JournalEntries()
+	if err != nil {
+		t.Fatalf("journal: %v", err)
+	}
+	if last := entries[len(entries)-1]; string(last.Changes[0].New) != strconv.Itoa(want) {
+		t.Fatalf("last journal entry = %s, want %d", last.Changes[0].New, want)
+	}
+	if events, _ := s.TamperEvents(); len(events) > 0 {
+		t.Fatalf("concurrent saves were reported as tampering: %+v", events)
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// hostsBlockedFile exists while the last hosts file write made under the
+// store's lock left our section in place.
+const hostsBlockedFile = "hosts.blocked"
+
+func (s *Store) hostsBlockedPath() string {
+	return filepath.Join(filepath.Dir(s.filePath), hostsBlockedFile)
+}
+
+// UpdateHosts runs write under the store's lock, so that the UI and the
+// enforcer do not write the hosts file over each other, and records what
+// it left behind. write gets the config as on disk and whether our section
+// should be in the hosts file, and returns whether it is after the write.
+// Nothing is recorded if write fails.
+func (s *Store) UpdateHosts(write func(cfg *Config, blocked bool) (bool, error)) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
+
+	if err := s.loadInternal(); err != nil {
+		return err
+	}
+	_, err := os.Stat(s.hostsBlockedPath())
+	blocked := err == nil
+
+	cfg := s.Data
+	now, err := write(&cfg, blocked)
+	if err != nil || now == blocked {
+		return err
+	}
+	if !now {
+		return os.Remove(s.hostsBlockedPath())
+	}
+	return writeFileSync(s.hostsBlockedPath(), nil, 0644)
+}
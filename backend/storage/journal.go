@@ -0,0 +1,647 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const journalSuffix = ".journal"
+
+// Journal sources identify which process wrote a change.
+const (
+	SourceUI      = "ui"
+	SourceGhost   = "ghost"
+	SourceUnknown = "unknown"
+)
+
+var (
+	// ErrJournalTampered means an entry no longer hashes to the value the next
+	// entry chained to (edited, removed or reordered lines).
+	ErrJournalTampered = errors.New("config journal hash chain is broken")
+	// ErrLockActive is returned for operations that are refused during a session.
+	ErrLockActive = errors.New("not allowed while a focus lock is active")
+	// ErrRollbackSchema is returned by RollbackTo for entries written before
+	// the config format was last upgraded; undoing them would write fields
+	// in the old format back.
+	ErrRollbackSchema = errors.New("cannot roll back past a config format upgrade")
+)
+
+// journalIgnoredFields change on every tick or kill and would flood the
+// journal. They are also left alone by RollbackTo.
+var journalIgnoredFields = map[string]bool{
+	"remaining_duration": true,
+	"stats":              true,
+}
+
+// rollbackPreservedFields describe the running session rather than the user's
+// settings, so rolling back must not resurrect old values.
+var rollbackPreservedFields = map[string]bool{
+	"schema_version":         true,
+	"lock_end_time":          true,
+	"session_profile_id":     true,
+	"paused_until":           true,
+	"emergency_unlocks_used": true,
+	"ghost_task_name":        true,
+	"ghost_exe_path":         true,
+	"journal_break":          true,
+}
+
+// chainBreak is the error for the first journal entry that does not verify.
+type chainBreak struct {
+	seq    int
+	hash   string // The entry's hash, or a digest of its line if unreadable
+	reason string
+}
+
+func (b *chainBreak) Error() string { return ErrJournalTampered.Error() + ": " + b.reason }
+func (b *chainBreak) Unwrap() error { return ErrJournalTampered }
+
+// fingerprint identifies the break across checks and restarts.
+func (b *chainBreak) fingerprint() string { return fmt.Sprintf("%d:%s", b.seq, b.hash) }
+
+// JournalEntry is one record in the append-only config change journal.
+// Each entry commits to its predecessor through PrevHash. Hash is an HMAC
+// under the signing key KeyID, so that the chain cannot be recomputed
+// without the key.
+type JournalEntry struct {
+	Seq      int           `json:"seq"`
+	Time     time.Time     `json:"time"`
+	Source   string        `json:"source"`
+	Changes  []FieldChange `json:"changes"`
+	PrevHash string        `json:"prev_hash"`
+	Schema   int           `json:"schema,omitempty"` // Config schema version the changes are in
+	KeyID    string        `json:"kid,omitempty"`
+	Hash     string        `json:"hash"`
+}
+
+// FieldChange is one top-level config field that changed in a save.
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// computeHash MACs the entry, with its Hash field cleared, under secret.
+func (e JournalEntry) computeHash(secret []byte) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	return computeMAC(secret, data)
+}
+
+// legacyHash is the plain SHA-256 that journals were chained with before
+// schema v6. Only upgradeJournal accepts it.
+func (e JournalEntry) legacyHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sealEntry links e to prev (nil for the first entry) and MACs it under
+// the current signing key.
+func (s *Store) sealEntry(e *JournalEntry, prev *JournalEntry) error {
+	key := s.keys.current()
+	if key == nil {
+		return errors.New("no signing key for the journal")
+	}
+	e.Seq, e.PrevHash = 1, ""
+	if prev != nil {
+		e.Seq, e.PrevHash = prev.Seq+1, prev.Hash
+	}
+	e.KeyID = key.ID
+	e.Hash = e.computeHash(key.Secret)
+	return nil
+}
+
+// SetSource sets the name recorded in the journal for changes saved by this
+// Store (SourceUI or SourceGhost).
+func (s *Store) SetSource(source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source = source
+}
+
+func (s *Store) journalPath() string {
+	return s.filePath + journalSuffix
+}
+
+// diffConfigs compares two config bodies field by field, skipping ignored.
+func diffConfigs(oldData, newData []byte, ignored map[string]bool) ([]FieldChange, error) {
+	oldDoc := map[string]json.RawMessage{}
+	if len(oldData) > 0 {
+		if err := json.Unmarshal(oldData, &oldDoc); err != nil {
+			return nil, err
+		}
+	}
+	newDoc := map[string]json.RawMessage{}
+	if err := json.Unmarshal(newData, &newDoc); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for k := range oldDoc {
+		keys[k] = true
+	}
+	for k := range newDoc {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if !ignored[k] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	var changes []FieldChange
+	for _, k := range sorted {
+		oldVal, newVal := compactJSON(oldDoc[k]), compactJSON(newDoc[k])
+		if !bytes.Equal(oldVal, newVal) {
+			changes = append(changes, FieldChange{Field: k, Old: oldVal, New: newVal})
+		}
+	}
+	return changes, nil
+}
+
+func compactJSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage("null")
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+// appendJournal records the difference between the last committed config
+// and data. Saves that only touch ignored fields produce no entry.
+func (s *Store) appendJournal(source string, data []byte) error {
+	changes, err := diffConfigs(s.lastCommitted, data, journalIgnoredFields)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	if err := s.sealJournalValues(changes); err != nil {
+		return err
+	}
+
+	// Re-read the tail each time: the other process appends too.
+	if err := s.dropTornTail(); err != nil {
+		return err
+	}
+	tail, err := s.readJournalTail()
+	if err != nil {
+		return err
+	}
+
+	entry := JournalEntry{
+		Time:    s.clock.Now(),
+		Source:  source,
+		Changes: changes,
+		Schema:  CurrentSchemaVersion,
+	}
+	if err := s.sealEntry(&entry, tail); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.journalPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dropTornTail cuts off a last line without a newline. Every append ends
+// with one, so such a line is an append cut short by a crash, not
+// tampering; left in place, the next entry would be glued to it. Called
+// with the store lock held.
+func (s *Store) dropTornTail() error {
+	f, err := os.OpenFile(s.journalPath(), os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	// Find the end of the last complete line, a window at a time
+	const window = 64 * 1024
+	keep := int64(0)
+	for end := size; end > 0 && keep == 0; end -= window {
+		from := max(end-window, 0)
+		buf := make([]byte, end-from)
+		if _, err := f.ReadAt(buf, from); err != nil && err != io.EOF {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			keep = from + int64(i) + 1
+		}
+	}
+	if err := f.Truncate(keep); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// readJournalTail returns the last complete entry, or nil for an empty journal.
+func (s *Store) readJournalTail() (*JournalEntry, error) {
+	f, err := os.Open(s.journalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Most entries are small; read the end of the file first and fall back
+	// to the whole file if the last line does not fit.
+	const tailWindow = 64 * 1024
+	offset := info.Size() - tailWindow
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	buf = completeLines(buf)
+	buf = bytes.TrimRight(buf, "\n")
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	idx := bytes.LastIndexByte(buf, '\n')
+	if idx < 0 && offset > 0 {
+		entries, err := s.readJournal()
+		if err != nil || len(entries) == 0 {
+			return nil, err
+		}
+		return &entries[len(entries)-1], nil
+	}
+
+	var entry JournalEntry
+	if err := json.Unmarshal(buf[idx+1:], &entry); err != nil {
+		return nil, fmt.Errorf("%w: unreadable last entry", ErrJournalTampered)
+	}
+	return &entry, nil
+}
+
+// completeLines cuts off a last line without a newline; see dropTornTail.
+func completeLines(data []byte) []byte {
+	return data[:bytes.LastIndexByte(data, '\n')+1]
+}
+
+// readJournal returns all entries in file order without verifying them.
+func (s *Store) readJournal() ([]JournalEntry, error) {
+	data, err := s.readJournalFrom(0)
+	if err != nil {
+		return nil, err
+	}
+	return parseJournal(data, 0)
+}
+
+// readJournalFrom returns the complete lines of the journal from offset on.
+func (s *Store) readJournalFrom(offset int64) ([]byte, error) {
+	f, err := os.Open(s.journalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return completeLines(data), nil
+}
+
+// parseJournal decodes journal lines; afterSeq is the entry before them.
+func parseJournal(data []byte, afterSeq int) ([]JournalEntry, error) {
+	entries := []JournalEntry{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			sum := sha256.Sum256(line)
+			return nil, &chainBreak{
+				seq:    afterSeq + len(entries) + 1,
+				hash:   hex.EncodeToString(sum[:]),
+				reason: fmt.Sprintf("unreadable entry after #%d", afterSeq+len(entries)),
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// verifyChain checks sequence numbers, MACs and links of all entries.
+func (s *Store) verifyChain(entries []JournalEntry) error {
+	return s.verifyChainFrom(nil, entries)
+}
+
+// verifyChainFrom is verifyChain for entries that follow prev (nil for the
+// start of the journal). Entries MACed under a key ID we do not know were
+// written after the other process rotated the key, so the keyring is
+// reloaded once.
+func (s *Store) verifyChainFrom(prev *JournalEntry, entries []JournalEntry) error {
+	reloaded := false
+	return checkChain(prev, entries, func(e JournalEntry) bool {
+		key := s.keys.find(e.KeyID)
+		if key == nil && !reloaded {
+			reloaded = true
+			if ring, err := loadKeyring(s.backup); err == nil {
+				s.keys = ring
+				key = s.keys.find(e.KeyID)
+			}
+		}
+		// Retired keys still count: RotateKey re-chains the journal before
+		// it drops them
+		return key != nil && hmac.Equal([]byte(e.computeHash(key.Secret)), []byte(e.Hash))
+	})
+}
+
+// checkChain checks sequence numbers and links of the entries following
+// prev (nil for the start of the journal), and each entry's hash with
+// valid.
+func checkChain(prev *JournalEntry, entries []JournalEntry, valid func(JournalEntry) bool) error {
+	seq, prevHash := 0, ""
+	if prev != nil {
+		seq, prevHash = prev.Seq, prev.Hash
+	}
+	for i, e := range entries {
+		if e.Seq != seq+i+1 {
+			return &chainBreak{e.Seq, e.Hash, fmt.Sprintf("entry #%d out of sequence", e.Seq)}
+		}
+		if e.PrevHash != prevHash {
+			return &chainBreak{e.Seq, e.Hash, fmt.Sprintf("entry #%d does not link to #%d", e.Seq, seq+i)}
+		}
+		if !valid(e) {
+			return &chainBreak{e.Seq, e.Hash, fmt.Sprintf("entry #%d was modified", e.Seq)}
+		}
+		prevHash = e.Hash
+	}
+	return nil
+}
+
+// rechainJournal MACs every entry again under the current key and replaces
+// the journal with the result.
+func (s *Store) rechainJournal(entries []JournalEntry) error {
+	var buf bytes.Buffer
+	for i := range entries {
+		var prev *JournalEntry
+		if i > 0 {
+			prev = &entries[i-1]
+		}
+		if err := s.sealEntry(&entries[i], prev); err != nil {
+			return err
+		}
+		line, err := json.Marshal(entries[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp := s.journalPath() + pendingSuffix
+	if err := writeFileSync(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.journalPath())
+}
+
+// upgradeJournal moves a journal chained with plain SHA-256 to the keyed
+// chain. It runs once, when the config is migrated to v6; later, an unkeyed
+// chain is as broken as any other. A chain that does not verify is left
+// alone, so that the tampering stays visible.
+func (s *Store) upgradeJournal() error {
+	entries, err := s.readJournal()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	for _, e := range entries {
+		if e.KeyID != "" {
+			return nil // Already keyed, e.g. by the other process
+		}
+	}
+	if checkChain(nil, entries, func(e JournalEntry) bool { return e.legacyHash() == e.Hash }) != nil {
+		return nil
+	}
+	return s.rechainJournal(entries)
+}
+
+// JournalEntries returns the change journal, oldest first. The entries are
+// returned even if the chain is broken, together with ErrJournalTampered.
+func (s *Store) JournalEntries() ([]JournalEntry, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.unlock()
+
+	entries, err := s.readJournal()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyChain(entries); err != nil {
+		return entries, err
+	}
+	// Values that cannot be decrypted are shown sealed
+	_ = s.openJournalValues(entries)
+	return entries, nil
+}
+
+// journalCursor marks the last entry VerifyJournal has verified.
+type journalCursor struct {
+	start int64  // Offset of the entry's line
+	line  []byte // The line itself, without the newline
+	entry JournalEntry
+}
+
+// VerifyJournal reports whether the journal's hash chain is intact.
+// A broken chain is a tamper signal.
+//
+// The enforcer calls it every few seconds, so only entries appended since
+// the last call are verified, chained to the last verified entry. The whole
+// journal is verified on the first call and whenever that entry is no
+// longer where it was (the journal was rechained, rolled back or replaced).
+func (s *Store) VerifyJournal() error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
+
+	if cur := s.journalCur; cur != nil {
+		data, err := s.readJournalFrom(cur.start)
+		if err != nil {
+			return err
+		}
+		if rest, ok := bytes.CutPrefix(data, append(cur.line, '\n')); ok {
+			entries, err := parseJournal(rest, cur.entry.Seq)
+			if err != nil {
+				return err
+			}
+			if err := s.verifyChainFrom(&cur.entry, entries); err != nil {
+				return err
+			}
+			s.setJournalCursor(rest, cur.start+int64(len(cur.line))+1, entries)
+			return nil
+		}
+	}
+	return s.verifyJournalFull()
+}
+
+// verifyJournalFull verifies the whole journal and moves the cursor to its
+// end. Called with the store lock held.
+func (s *Store) verifyJournalFull() error {
+	s.journalCur = nil
+	data, err := s.readJournalFrom(0)
+	if err != nil {
+		return err
+	}
+	entries, err := parseJournal(data, 0)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyChain(entries); err != nil {
+		return err
+	}
+	s.setJournalCursor(data, 0, entries)
+	return nil
+}
+
+// setJournalCursor moves the cursor to the last of entries, parsed from
+// data read at offset base. Nothing moves if there are no entries.
+func (s *Store) setJournalCursor(data []byte, base int64, entries []JournalEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	data = bytes.TrimRight(data, "\n")
+	start := bytes.LastIndexByte(data, '\n') + 1
+	s.journalCur = &journalCursor{
+		start: base + int64(start),
+		line:  bytes.Clone(data[start:]),
+		entry: entries[len(entries)-1],
+	}
+}
+
+// RollbackTo restores the user's settings as they were right after entry seq
+// by undoing every later entry. Session state (lock and pause times, ghost
+// identity) and bookkeeping fields keep their current values. Refused during
+// a session (manual lock or schedule window), if the journal has been
+// tampered with, or if the config format was upgraded since entry seq.
+func (s *Store) RollbackTo(seq int) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
+
+	if err := s.loadInternal(); err != nil {
+		return err
+	}
+	if s.Data.SessionActive(s.clock.Now()) {
+		return ErrLockActive
+	}
+
+	entries, err := s.readJournal()
+	if err != nil {
+		return err
+	}
+	if err := s.verifyChain(entries); err != nil {
+		return err
+	}
+	if err := s.openJournalValues(entries); err != nil {
+		return err
+	}
+	if seq < 1 || seq > len(entries) {
+		return fmt.Errorf("journal entry #%d not found", seq)
+	}
+	for _, e := range entries[seq-1:] {
+		if e.Schema != CurrentSchemaVersion {
+			return ErrRollbackSchema
+		}
+	}
+
+	current, err := json.Marshal(s.Data)
+	if err != nil {
+		return err
+	}
+	doc := map[string]json.RawMessage{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+
+	// Undo newest first
+	for i := len(entries) - 1; i >= seq; i-- {
+		for _, c := range entries[i].Changes {
+			if rollbackPreservedFields[c.Field] || journalIgnoredFields[c.Field] {
+				continue
+			}
+			doc[c.Field] = c.Old
+		}
+	}
+
+	merged, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var restored Config
+	if err := json.Unmarshal(merged, &restored); err != nil {
+		return err
+	}
+
+	s.Data = restored
+	return s.saveInternalAs(fmt.Sprintf("%s (rollback to #%d)", s.source, seq))
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"focus-lock/backend/clock"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeEntries replaces the journal of s with entries as they are.
+func writeEntries(t *testing.T, s *Store, entries []JournalEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(s.journalPath(), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// journaledStore returns a store with three journal entries.
+func journaledStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := NewStoreWithBackup(t.TempDir(), NewMemoryBackupStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, marker := range []string{"a", "b", "c"} {
+		if err := saveMarker(t, s, marker); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestJournalRejectsRecomputedChain(t *testing.T) {
+	s := journaledStore(t)
+	entries, err := s.JournalEntries()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("entries = %d, err = %v", len(entries), err)
+	}
+
+	// Rewrite the history and redo the chain without the key
+	entries[1].Source = "forged"
+	prev := ""
+	for i := range entries {
+		entries[i].PrevHash = prev
+		entries[i].KeyID = ""
+		entries[i].Hash = entries[i].legacyHash()
+		prev = entries[i].Hash
+	}
+	writeEntries(t, s, entries)
+
+	if _, err := s.JournalEntries(); !errors.Is(err, ErrJournalTampered) {
+		t.Fatalf("err = %v, want ErrJournalTampered", err)
+	}
+}
+
+func TestJournalVerifiesAfterKeyRotation(t *testing.T) {
+	s := journaledStore(t)
+	for i := 0; i < 2; i++ {
+		if err := s.RotateKey(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Past the grace window the first keys are dropped on the next rotation
+	s.SetClock(clock.NewFake(time.Now().Add(2 * KeyGraceWindow)))
+	if err := s.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.VerifyJournal(); err != nil {
+		t.Fatalf("journal does not verify after rotation: %v", err)
+	}
+}
+
+func TestUpgradeJournalRechainsLegacyChainOnce(t *testing.T) {
+	s := journaledStore(t)
+	entries, err := s.JournalEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := ""
+	for i := range entries {
+		entries[i].PrevHash = prev
+		entries[i].Schema = 0
+		entries[i].KeyID = ""
+		entries[i].Hash = entries[i].legacyHash()
+		prev = entries[i].Hash
+	}
+	writeEntries(t, s, entries)
+
+	if err := s.upgradeJournal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.VerifyJournal(); err != nil {
+		t.Fatalf("upgraded journal does not verify: %v", err)
+	}
+
+	// Entries from before the upgrade cannot be rolled back to
+	if err := s.RollbackTo(1); !errors.Is(err, ErrRollbackSchema) {
+		t.Fatalf("err = %v, want ErrRollbackSchema", err)
+	}
+}
+
+func TestRollbackRefusedDuringScheduleWindow(t *testing.T) {
+	s := journaledStore(t)
+	// Wednesday, inside the window
+	s.SetClock(clock.NewFake(time.Date(2026, 10, 14, 10, 0, 0, 0, time.Local)))
+	err := s.UpdateAtomic(func(cfg *Config) {
+		cfg.Schedules = []Schedule{{ID: "work", Days: []string{"Wed"}, StartTime: "09:00", EndTime: "17:00", Enabled: true}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RollbackTo(1); !errors.Is(err, ErrLockActive) {
+		t.Fatalf("err = %v, want ErrLockActive", err)
+	}
+}
+
+func TestJournalSurvivesCrashMidAppend(t *testing.T) {
+	s := journaledStore(t)
+	dir := filepath.Dir(s.filePath)
+
+	// The process dies halfway through writing a fourth entry
+	entries, err := s.JournalEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := entries[2]
+	next.Seq, next.PrevHash = 4, next.Hash
+	line, err := json.Marshal(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(s.journalPath(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(line[:len(line)/2]); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// A torn last line is not tampering, and the next save starts afresh
+	s, err = NewStoreWithBackup(dir, s.backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.VerifyJournal(); err != nil {
+		t.Fatalf("torn append reported as tampering: %v", err)
+	}
+	if err := saveMarker(t, s, "d"); err != nil {
+		t.Fatalf("save after torn append: %v", err)
+	}
+	entries, err = s.JournalEntries()
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("entries = %d, err = %v", len(entries), err)
+	}
+	if err := s.VerifyJournal(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyJournalChecksNewEntries(t *testing.T) {
+	s := journaledStore(t)
+	if err := s.VerifyJournal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveMarker(t, s, "d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.VerifyJournal(); err != nil {
+		t.Fatalf("appended entry does not verify: %v", err)
+	}
+
+	// A forged entry after the verified ones is caught
+	entries, err := s.readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := entries[3]
+	forged.Seq, forged.PrevHash, forged.Source = 5, forged.Hash, "forged"
+	entries = append(entries, forged)
+	writeEntries(t, s, entries)
+	if err := s.VerifyJournal(); !errors.Is(err, ErrJournalTampered) {
+		t.Fatalf("err = %v, want ErrJournalTampered", err)
+	}
+
+}
@@ -1,29 +1,38 @@
 package storage
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"focus-lock/backend/clock"
+	"focus-lock/backend/datadir"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 )
 
+// configFile is the name of the config in the data directory.
+const configFile = "config.json"
+
 type Config struct {
-	BlockedApps          []string      `json:"blocked_apps"`
-	BlockedSites         []string      `json:"blocked_sites"`
-	BlockCommonVPN       bool          `json:"block_common_vpn"`
-	Schedules            []Schedule    `json:"schedules"` // New schedule structure
-	Stats                Stats         `json:"stats"`
-	LockEndTime          time.Time     `json:"lock_end_time"`      // Zero if not locked
-	RemainingDuration    time.Duration `json:"remaining_duration"` // For offline usage tracking
-	GhostTaskName        string        `json:"ghost_task_name"`    // Obfuscated task name
-	GhostExePath         string        `json:"ghost_exe_path"`     // Path to obfuscated executable
-	PausedUntil          time.Time     `json:"paused_until"`       // Emergency unlock expiry
-	EmergencyUnlocksUsed int           `json:"emergency_unlocks_used"`
+	SchemaVersion        int            `json:"schema_version"`
+	Profiles             []Profile      `json:"profiles"`
+	ActiveProfileID      string         `json:"active_profile_id"`  // Profile edited in the UI and used by default
+	SessionProfileID     string         `json:"session_profile_id"` // Profile enforced by the manual lock
+	Schedules            []Schedule     `json:"schedules"`          // New schedule structure
+	LockEndTime          time.Time      `json:"lock_end_time"`      // Zero if not locked
+	RemainingDuration    time.Duration  `json:"remaining_duration"` // For offline usage tracking
+	GhostTaskName        string         `json:"ghost_task_name"`    // Obfuscated task name
+	GhostExePath         string         `json:"ghost_exe_path"`     // Path to obfuscated executable
+	PausedUntil          time.Time      `json:"paused_until"`       // Emergency unlock expiry
+	EmergencyUnlocksUsed int            `json:"emergency_unlocks_used"`
+	TamperPolicy         TamperPolicy   `json:"tamper_policy"`
+	StatsRetention       StatsRetention `json:"stats_retention"`
+	EncryptAtRest        bool           `json:"encrypt_at_rest"`         // Store config.json AES-GCM encrypted
+	Exceptions           []AppRule      `json:"exceptions"`              // Processes never ended, whatever rule matches
+	RelaunchPolicy       RelaunchPolicy `json:"relaunch_policy"`         // Escalation for apps that respawn
+	JournalBreak         string         `json:"journal_break,omitempty"` // Broken journal chain already reported; see ReportJournalBroken
 }
 
 // Schedule represents a weekly time window for automatic locking
@@ -34,238 +43,586 @@ type Schedule struct {
 	StartTime string   `json:"start_time"` // "HH:MM" 24h format
 	EndTime   string   `json:"end_time"`   // "HH:MM" 24h format
 	Enabled   bool     `json:"enabled"`
+	ProfileID string   `json:"profile_id"` // Empty means the active profile
 }
 
-type Stats struct {
-	KillCounts       map[string]int   `json:"kill_counts"`
-	BlockedFrequency map[string]int   `json:"blocked_frequency"`
-	BlockedDuration  map[string]int64 `json:"blocked_duration"` // Total seconds blocked
+// ActiveAt reports whether the schedule is enabled and its window contains
+// now.
+func (s Schedule) ActiveAt(now time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	day := now.Format("Mon") // "Mon", "Tue", ...
+	dayMatch := false
+	for _, d := range s.Days {
+		if d == day {
+			dayMatch = true
+			break
+		}
+	}
+	// Simple string comparison works for 24h "HH:MM" format
+	hhmm := now.Format("15:04")
+	return dayMatch && hhmm >= s.StartTime && hhmm < s.EndTime
 }
 
-// Methods for Stats
+// SessionActive reports whether a manual lock or a schedule window is
+// running at now, paused or not. Settings that could end a session early
+// are refused while it is.
+func (c *Config) SessionActive(now time.Time) bool {
+	if !c.LockEndTime.IsZero() && now.Before(c.LockEndTime) {
+		return true
+	}
+	for _, s := range c.Schedules {
+		if s.ActiveAt(now) {
+			return true
+		}
+	}
+	return false
+}
 
 type Store struct {
-	mu           sync.Mutex
-	filePath     string
-	Data         Config
-	regStore     *RegistryStore
-	activeSecret []byte
+	mu       sync.Mutex
+	filePath string
+	// Data is the working copy of the config, owned by the store's lock.
+	// Only Update callbacks and the goroutine that owns the store should
+	// touch it; everyone else reads Snapshot.
+	Data       Config
+	backup     BackupStore
+	keys       *keyring
+	encKey     []byte // Loaded on first use
+	sessions   *SessionStore
+	stats      *StatsStore
+	suspended  *SuspendedStore
+	audit      *AuditStore
+	quarantine *QuarantineStore
+
+	killsMu      sync.Mutex
+	pendingKills []KillRecord // Not yet written; see FlushKills
+	flock        *fileLock    // Held between lock() and unlock()
+	schemaErr    error        // Set when the file on disk is from a newer build or not yet migratable
+
+	legacyBackupGone bool // Old lock times deleted; see LegacyBackupStore
+
+	clock         clock.Clock
+	source        string         // Recorded in the journal for saves from this Store
+	lastCommitted []byte         // Config body as last loaded or saved, for journal diffs
+	lastNotified  []byte         // Config body last published to subscribers
+	journalCur    *journalCursor // End of the journal as last verified; see VerifyJournal
+	watch         watchState
+
+	snapMu   sync.RWMutex
+	snapshot []byte // Data as last loaded or saved; see Snapshot
 }
 
+// NewStore opens the config in the resolved data directory (see datadir),
+// backed up to the platform's default secondary store. Isolated instances
+// keep their own backup instead, so that they do not share the registry key
+// or state file with the main installation: outside their directory (see
+// instanceBackupDir), except in portable mode, where the directory has to
+// carry its keys along.
 func NewStore() (*Store, error) {
-	configDir, err := os.UserConfigDir()
+	dir, err := datadir.Dir()
 	if err != nil {
 		return nil, err
 	}
 
-	dir := filepath.Join(configDir, "FocusLock")
+	backup := NewDefaultBackupStore()
+	switch datadir.CurrentMode() {
+	case datadir.ModeDefault:
+	case datadir.ModePortable:
+		backup = NewFileBackupStore(filepath.Join(dir, isolatedBackupDir))
+	default:
+		to := instanceBackupDir(dir)
+		if err := moveIsolatedBackup(dir, to); err != nil {
+			return nil, fmt.Errorf("moving the backup out of %s: %w", dir, err)
+		}
+		backup = NewFileBackupStore(to)
+	}
+	return NewStoreWithBackup(dir, backup)
+}
+
+// isolatedBackupDir holds the secondary store of a portable instance, and
+// that of other isolated instances before it was moved out of their
+// directory.
+const isolatedBackupDir = "Backup"
+
+// moveIsolatedBackup moves the secondary store an older build kept in the
+// data directory dir to to. Under the config lock, so that the UI and the
+// ghost starting together do not both move it.
+func moveIsolatedBackup(dir, to string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fl, err := acquireFileLock(filepath.Join(dir, configFile)+lockSuffix, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+	return moveBackupDir(filepath.Join(dir, isolatedBackupDir), to)
+}
+
+// NewStoreWithBackup opens the config in dir using the given secondary store.
+// Tests pass a temp dir and a MemoryBackupStore.
+func NewStoreWithBackup(dir string, backup BackupStore) (*Store, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
 
+	profile := NewProfile(DefaultProfileName)
 	store := &Store{
-		filePath: filepath.Join(dir, "config.json"),
+		filePath: filepath.Join(dir, configFile),
 		Data: Config{
-			BlockedApps: []string{},
-			Stats: Stats{
-				KillCounts: make(map[string]int),
-			},
-			BlockedSites:   []string{},
-			BlockCommonVPN: true,
+			SchemaVersion:   CurrentSchemaVersion,
+			Profiles:        []Profile{profile},
+			ActiveProfileID: profile.ID,
+			TamperPolicy:    DefaultTamperPolicy(),
+			StatsRetention:  DefaultStatsRetention(),
 		},
-		regStore: NewRegistryStore(),
+		backup:     backup,
+		sessions:   NewSessionStore(dir),
+		stats:      NewStatsStore(dir),
+		suspended:  NewSuspendedStore(dir),
+		audit:      NewAuditStore(dir),
+		quarantine: NewQuarantineStore(dir),
+		clock:      clock.Default(),
+		source:     SourceUnknown,
 	}
 
-	// Initialize Secret for HMAC
-	secret, err := store.regStore.GetOrCreateSecret()
+	// Initialize Keyring for HMAC. Under the file lock, so that the UI and the
+	// ghost starting together on a fresh install agree on one secret.
+	if err := store.lock(); err != nil {
+		return nil, err
+	}
+	keys, err := loadKeyring(store.backup)
+	store.unlock()
 	if err != nil {
-		// Fallback to memory-only secret if registry fails (unlikely)
-		secret = make([]byte, 32)
+		// Fallback to memory-only secret if the backup store fails (unlikely)
+		secret := make([]byte, 32)
+		keys = &keyring{Keys: []signingKey{{ID: keyIDFor(secret), Secret: secret}}}
 		// We log or ignore, but better to proceed than crash
 	}
-	store.activeSecret = secret
+	store.keys = keys
+	store.sessions.keys = store.sessionKey
+	store.refreshSnapshot()
 
 	return store, nil
 }
 
+// Snapshot returns a copy of the config as last loaded or saved. Unlike
+// Data it may be read from any goroutine, also while the store reloads in
+// the background (see Subscribe), and the copy is the caller's own.
+func (s *Store) Snapshot() Config {
+	s.snapMu.RLock()
+	data := s.snapshot
+	s.snapMu.RUnlock()
+
+	var cfg Config
+	_ = json.Unmarshal(data, &cfg)
+	return cfg
+}
+
+// refreshSnapshot publishes Data to Snapshot. Called with s.mu held
+// whenever Data is committed, before subscribers hear of the change.
+func (s *Store) refreshSnapshot() {
+	data, err := json.Marshal(s.Data)
+	if err != nil {
+		return
+	}
+	s.snapMu.Lock()
+	s.snapshot = data
+	s.snapMu.Unlock()
+}
+
 func (s *Store) Load() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
 
 	return s.loadInternal()
 }
 
 // loadInternal is the actual load logic, assuming lock is held
 func (s *Store) loadInternal() error {
-	// Retry logic for file contention
-	var data []byte
-	var err error
-	maxRetries := 3
-
-	for i := 0; i < maxRetries; i++ {
-		data, err = os.ReadFile(s.filePath)
-		if err == nil {
-			break
-		}
-		// If permission denied or locked, wait and retry
-		time.Sleep(50 * time.Millisecond)
-	}
+	// 1. Read the newest generation whose signature verifies
+	data, fromPrevious, err := s.readGeneration()
 
 	fileMissing := os.IsNotExist(err)
-	corrupt := false
+	corrupt := err != nil && !fileMissing
 
+	var encrypted bool
 	if err == nil {
-		// 2. Verify Signature
-		sigPath := s.filePath + ".sig"
-		sigData, sigErr := os.ReadFile(sigPath)
-		if sigErr == nil {
-			computed := s.computeHMAC(data)
-			stored := string(sigData)
-			if computed != stored {
-				corrupt = true
-				// fmt.Println("Config TAMPERED: Signature mismatch") // Silence to prevent console window
-			}
-		} else {
-			corrupt = true // Missing signature counts as tamper
-			// fmt.Println("Config TAMPERED: Missing signature") // Silence
+		data, encrypted, err = s.decodeBody(data)
+		corrupt = err != nil
+	}
+
+	if err == nil {
+		// Bring older files up to date; refuse files from a newer build
+		// instead of half-reading them.
+		var migrated bool
+		data, migrated, err = s.migrate(data)
+		if migrationRetryable(err) {
+			s.schemaErr = err
+			return err
 		}
+		s.schemaErr = nil
 
-		if !corrupt {
-			if jsonErr := json.Unmarshal(data, &s.Data); jsonErr != nil {
-				corrupt = true
+		if err != nil {
+			corrupt = true
+		} else if jsonErr := json.Unmarshal(data, &s.Data); jsonErr != nil {
+			corrupt = true
+		} else {
+			s.lastCommitted = data
+			s.refreshSnapshot()
+			s.publish(data, false)
+			if fromPrevious {
+				// The current pair does not verify but the one before it is
+				// intact. Keep it unless the backup below holds an active lock.
+				fileMissing = true
+			} else if migrated || encrypted != s.Data.EncryptAtRest {
+				// Re-sign right away so the upgrade is not redone on every
+				// load. This also moves the file to or from encryption.
+				if saveErr := s.saveInternal(); saveErr != nil {
+					return saveErr
+				}
 			}
 		}
 	}
 
-	// 3. Redundancy / Restore Logic
-	// If file is missing OR corrupt, check Registry
+	// 2. Redundancy / Restore Logic
+	// If file is missing OR corrupt, check the secondary store
+	now := s.clock.Now()
 	if fileMissing || corrupt {
-		lockEnd, remDur, pausedUntil, regErr := s.regStore.LoadBackup()
-		if regErr == nil {
-			now := time.Now()
-			// If Registry has an active lock
-			if lockEnd.After(now) || remDur > 0 || (!pausedUntil.IsZero() && pausedUntil.After(now)) {
-				// fmt.Println("Restoring Config from Registry Backup...") // Silence
-				s.Data.LockEndTime = lockEnd
-				s.Data.RemainingDuration = remDur
-				s.Data.PausedUntil = pausedUntil
-				// Force Save to restore the file
-				// We need to unlock first because Save locks - BUT we are in internal load?
-				// Actually Save() locks, so we cannot call it from here if we hold lock.
-				// We should save AFTER returning from load if needed, or implement saveInternal.
-				// For now, let's just populate Data and let the caller handle save if appropriate,
-				// OR better, we trust the registry data and subsequent saves will write it.
-				// However, the original code did: s.mu.Unlock(); s.Save(); s.mu.Lock();
-				// This is dangerous if loadInternal is called from UpdateAtomic.
-				// CORRECT FIX: Do NOT save here. Just load into memory.
-				// The next Save() call will persist it to disk.
-				return nil
+		restored, ok := s.loadBackupConfig()
+		// If the backup has an active lock, restore everything it was
+		// enforcing: blocklists and schedules as well as lock times.
+		if ok && lockActive(restored, now) {
+			s.Data = restored
+
+			// Interrupted saves are covered by the pending pair, so getting
+			// here means the config was removed or edited during a session.
+			// Penalize and repair right away so the next load does not
+			// see it again.
+			tamperErr := err
+			if fromPrevious {
+				tamperErr = s.currentGenerationErr()
 			}
+			s.recordTamper(tamperTypeFor(tamperErr), s.tamperEvidence(tamperErr))
+			return s.saveInternal()
 		}
 
 		if corrupt {
+			s.recordTamper(tamperTypeFor(err), s.tamperEvidence(err))
 			return fmt.Errorf("config corrupted and no backup found")
 		}
 		// If just missing and no backup, return defaults (fresh start)
 		return nil
 	}
 
+	// 3. Cross-check with the secondary store. A valid config whose lock ends
+	// earlier than the backup's was swapped for an older signed copy.
+	if restored, ok := s.loadBackupConfig(); ok && restored.LockEndTime.After(now) &&
+		restored.LockEndTime.After(s.Data.LockEndTime) {
+		evidence := fmt.Sprintf("config lock ends %s, backup lock ends %s",
+			s.Data.LockEndTime.Format(time.RFC3339), restored.LockEndTime.Format(time.RFC3339))
+		if restored.EncryptAtRest {
+			// The tamper log is not encrypted
+			evidence = "config lock ends before the backup's"
+		}
+		s.Data = restored
+		s.recordTamper(TamperRegistryMismatch, evidence)
+		return s.saveInternal()
+	}
+
 	return nil
 }
 
+// lockActive reports whether cfg describes a running manual lock or pause.
+func lockActive(cfg Config, now time.Time) bool {
+	return cfg.LockEndTime.After(now) || cfg.RemainingDuration > 0 ||
+		(!cfg.PausedUntil.IsZero() && cfg.PausedUntil.After(now))
+}
+
+// tamperTypeFor maps a failed config read to the tamper it indicates.
+func tamperTypeFor(readErr error) TamperType {
+	switch {
+	case errors.Is(readErr, errMissingSignature):
+		return TamperMissingSignature
+	case os.IsNotExist(readErr):
+		return TamperConfigDeleted
+	default:
+		return TamperSignatureMismatch
+	}
+}
+
+func (s *Store) tamperEvidence(readErr error) string {
+	if os.IsNotExist(readErr) {
+		return "config.json missing during an active lock"
+	}
+	return readErr.Error() + "; " + fileEvidence(s.filePath)
+}
+
+// loadBackupConfig returns the config held by the secondary store if its
+// signature verifies and it can be read by this build.
+func (s *Store) loadBackupConfig() (Config, bool) {
+	snap, err := s.backup.LoadBackup()
+	if errors.Is(err, ErrNoBackup) {
+		return s.legacyBackupConfig()
+	}
+	if err != nil {
+		return Config{}, false
+	}
+
+	if !s.verify(snap.Config, snap.Signature) {
+		return Config{}, false
+	}
+
+	data, _, err := s.decodeBody(snap.Config)
+	if err != nil {
+		return Config{}, false
+	}
+	data, _, err = s.migrate(data)
+	if err != nil {
+		return Config{}, false
+	}
+
+	var restored Config
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return Config{}, false
+	}
+	return restored, true
+}
+
+// legacyBackupConfig is what builds before full snapshots restored from
+// the secondary store: the current config with the backed up lock times.
+// It is only consulted until the first snapshot replaces those times.
+func (s *Store) legacyBackupConfig() (Config, bool) {
+	legacy, ok := s.backup.(LegacyBackupStore)
+	if !ok || s.legacyBackupGone {
+		return Config{}, false
+	}
+	old, err := legacy.LoadLegacyBackup()
+	if err != nil {
+		return Config{}, false
+	}
+
+	restored := s.Data
+	restored.LockEndTime = old.LockEndTime
+	restored.RemainingDuration = old.RemainingDuration
+	restored.PausedUntil = old.PausedUntil
+	return restored, true
+}
+
+// dropLegacyBackup deletes the old lock times once a snapshot is saved.
+func (s *Store) dropLegacyBackup() {
+	legacy, ok := s.backup.(LegacyBackupStore)
+	if !ok || s.legacyBackupGone {
+		return
+	}
+	if err := legacy.DeleteLegacyBackup(); err == nil {
+		s.legacyBackupGone = true
+	}
+}
+
 // UpdateAtomic provides a thread-safe way to read-modify-write the config.
 // It ensures that we are modifying the most recent version of the config
 // and avoids race conditions where the UI updates the config while the
-// watchdog is calculating time.
+// watchdog is calculating time. The whole cycle runs under the cross-process
+// file lock, so the UI and the ghost cannot overwrite each other.
 func (s *Store) UpdateAtomic(updater func(*Config)) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.Update(func(cfg *Config) error {
+		updater(cfg)
+		return nil
+	})
+}
+
+// Update is UpdateAtomic for changes that can be refused: if updater returns
+// an error, nothing is saved and the error is returned. Changes adding an
+// invalid app rule are refused with ErrInvalidRule.
+func (s *Store) Update(updater func(*Config) error) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
 
 	// 1. Load latest state from disk (ignore error to allow defaults/recovery)
-	_ = s.loadInternal()
+	if err := s.loadInternal(); migrationRetryable(err) {
+		return err
+	}
 
-	// 2. Apply modifications
-	updater(&s.Data)
+	// 2. Apply modifications, refusing invalid rules
+	known := s.Data.knownRules()
+	err := updater(&s.Data)
+	if err == nil {
+		err = s.Data.validateNewRules(known)
+	}
+	if err != nil {
+		// Drop the half-made change, or the next save would commit it
+		s.Data = s.Snapshot()
+		return err
+	}
 
 	// 3. Save directly (we already hold lock)
 	return s.saveInternal()
 }
 
 func (s *Store) Save() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
 	return s.saveInternal()
 }
 
 func (s *Store) saveInternal() error {
+	return s.saveInternalAs(s.source)
+}
+
+// saveInternalAs saves and journals the change under the given source.
+func (s *Store) saveInternalAs(source string) error {
+	// Never downgrade a file written by a newer build
+	if s.schemaErr != nil {
+		return s.schemaErr
+	}
+	s.Data.SchemaVersion = CurrentSchemaVersion
+
 	data, err := json.MarshalIndent(s.Data, "", "  ")
 	if err != nil {
 		return err
 	}
+	body, err := s.encodeBody(data)
+	if err != nil {
+		return err
+	}
 
-	// 1. Save Config File
-	if err := os.WriteFile(s.filePath, data, 0644); err != nil {
+	// 1. Save Config File + HMAC Signature as one generation
+	sig := s.sign(body)
+	if err := s.commitGeneration(body, sig); err != nil {
 		return err
 	}
 
-	// 2. Save HMAC Signature
-	sig := s.computeHMAC(data)
-	if err := os.WriteFile(s.filePath+".sig", []byte(sig), 0644); err != nil {
+	// 2. Record what changed. The config is committed either way, so the
+	// rest still runs; the failure is returned at the end.
+	journalErr := s.appendJournal(source, data)
+	s.lastCommitted = data
+	s.refreshSnapshot()
+	s.publish(data, true)
+
+	// 3. Save full signed snapshot to secondary store (Redundancy)
+	if err := s.backup.SaveBackup(Snapshot{Config: body, Signature: sig}); err != nil {
 		return err
 	}
+	s.dropLegacyBackup()
 
-	// 3. Save to Registry (Redundancy)
-	return s.regStore.SaveBackup(s.Data.LockEndTime, s.Data.RemainingDuration, s.Data.PausedUntil)
+	// 4. Encrypt what older saves left in plaintext
+	if s.Data.EncryptAtRest {
+		if err := s.sealHistory(body, sig); err != nil {
+			return err
+		}
+	}
+	if journalErr != nil {
+		return fmt.Errorf("config saved, but not journaled: %w", journalErr)
+	}
+	return nil
 }
 
-func (s *Store) computeHMAC(data []byte) string {
-	if len(s.activeSecret) == 0 {
-		return ""
+// killFlushSize is how many kills IncrementKillCount buffers before it
+// writes them itself rather than waiting for FlushKills.
+const killFlushSize = 64
+
+// IncrementKillCount records an enforced process in the stats and, if it
+// exited, in the running session. Kills are buffered, so that a respawning
+// app does not cost two file writes every time it is killed; the enforcer
+// calls FlushKills on its slow loop.
+func (s *Store) IncrementKillCount(appName string, outcome KillOutcome) {
+	s.killsMu.Lock()
+	s.pendingKills = append(s.pendingKills, KillRecord{App: appName, Outcome: outcome, Time: s.clock.Now()})
+	full := len(s.pendingKills) >= killFlushSize
+	s.killsMu.Unlock()
+	if full {
+		_ = s.FlushKills()
 	}
-	h := hmac.New(sha256.New, s.activeSecret)
-	h.Write(data)
-	return hex.EncodeToString(h.Sum(nil))
 }
-func (s *Store) IncrementKillCount(appName string) {
-	s.mu.Lock()
-	if s.Data.Stats.KillCounts == nil {
-		s.Data.Stats.KillCounts = make(map[string]int)
+
+// FlushKills writes the buffered kills to the stats and session history,
+// one write each.
+func (s *Store) FlushKills() error {
+	s.killsMu.Lock()
+	kills := s.pendingKills
+	s.pendingKills = nil
+	s.killsMu.Unlock()
+	if len(kills) == 0 {
+		return nil
 	}
-	s.Data.Stats.KillCounts[appName]++
-	s.mu.Unlock()
-	s.Save() // Auto-save on stats update
-}
 
-func (s *Store) UpdateBlockedStats(apps []string, durationSec int) {
-	s.mu.Lock()
-	if s.Data.Stats.BlockedFrequency == nil {
-		s.Data.Stats.BlockedFrequency = make(map[string]int)
+	var exited []SessionKill
+	for _, k := range kills {
+		if k.Outcome != OutcomeSurvived {
+			exited = append(exited, SessionKill{App: k.App, Time: k.Time})
+		}
 	}
-	if s.Data.Stats.BlockedDuration == nil {
-		s.Data.Stats.BlockedDuration = make(map[string]int64)
+	err := s.stats.RecordKills(kills)
+	if len(exited) > 0 {
+		err = errors.Join(err, s.sessions.RecordKills(exited))
 	}
+	return err
+}
 
-	for _, app := range apps {
-		s.Data.Stats.BlockedFrequency[app]++
-		s.Data.Stats.BlockedDuration[app] += int64(durationSec)
-	}
-	s.mu.Unlock()
-	s.Save()
+// UpdateBlockedStats credits apps with durationSec of blocked time. Sessions
+// call it when they end (see EndSession) with the time actually blocked.
+func (s *Store) UpdateBlockedStats(apps []string, durationSec int) {
+	_ = s.stats.RecordBlocked(apps, int64(durationSec), s.clock.Now())
 }
 
+// GetBlockedDuration returns the all-time seconds blocked per app.
 func (s *Store) GetBlockedDuration() map[string]int64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.Data.Stats.BlockedDuration == nil {
+	totals, err := s.stats.Totals()
+	if err != nil {
 		return make(map[string]int64)
 	}
+	return totals.BlockedDuration
+}
 
-	copyMap := make(map[string]int64, len(s.Data.Stats.BlockedDuration))
-	for k, v := range s.Data.Stats.BlockedDuration {
-		copyMap[k] = v
-	}
-	return copyMap
+// Stats returns the usage statistics kept next to the config.
+func (s *Store) Stats() *StatsStore {
+	return s.stats
+}
+
+// Suspended returns the processes the enforcers have suspended.
+func (s *Store) Suspended() *SuspendedStore {
+	return s.suspended
+}
+
+// Quarantine returns the executables renamed to stop relaunch loops.
+func (s *Store) Quarantine() *QuarantineStore {
+	return s.quarantine
+}
+
+// Audit returns the log of enforcement actions other than kills.
+func (s *Store) Audit() *AuditStore {
+	return s.audit
+}
+
+// CompactStats rolls up statistics past the configured retention.
+func (s *Store) CompactStats(now time.Time) error {
+	s.mu.Lock()
+	retention := s.Data.StatsRetention
+	s.mu.Unlock()
+	return s.stats.Compact(now, retention)
+}
+
+// SetClock replaces the clock the store reads the time from. Tests pass a
+// clock.Fake; the enforcer uses the same clock through Clock. Call it before
+// the store is shared between goroutines.
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+	s.sessions.setClock(c)
+}
+
+// Clock returns the clock the store reads the time from. It does not take
+// the store's lock, so Update callbacks may call it.
+func (s *Store) Clock() clock.Clock {
+	return s.clock
 }
 
 func (s *Store) GetFilePath() string {
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"focus-lock/backend/clock"
+	"strings"
+	"time"
+)
+
+const (
+	sigFormatVersion = 2
+	sigAlgorithm     = "HMAC-SHA256"
+
+	// KeyGraceWindow is how long signatures made with a rotated-out key keep
+	// verifying. It covers the other process, which may still hold the old
+	// key in memory, and any file it signed before noticing the rotation.
+	KeyGraceWindow = 24 * time.Hour
+)
+
+// signingKey is one HMAC key. The last key in a keyring is the one used
+// for signing; older keys are only kept for verification.
+type signingKey struct {
+	ID      string    `json:"id"`
+	Secret  []byte    `json:"secret"`
+	Created time.Time `json:"created"`
+	Retired time.Time `json:"retired,omitempty"` // Zero while current
+}
+
+type keyring struct {
+	Keys []signingKey `json:"keys"`
+}
+
+// signature is the content of a versioned .sig file.
+type signature struct {
+	Version   int    `json:"v"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	MAC       string `json:"mac"`
+}
+
+// keyIDFor derives a stable, non-secret identifier from the key material.
+func keyIDFor(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:4])
+}
+
+func (k *keyring) current() *signingKey {
+	if len(k.Keys) == 0 {
+		return nil
+	}
+	return &k.Keys[len(k.Keys)-1]
+}
+
+func (k *keyring) find(id string) *signingKey {
+	for i := range k.Keys {
+		if k.Keys[i].ID == id {
+			return &k.Keys[i]
+		}
+	}
+	return nil
+}
+
+// usable reports whether key may still verify signatures at now.
+func (key *signingKey) usable(now time.Time) bool {
+	return key.Retired.IsZero() || now.Before(key.Retired.Add(KeyGraceWindow))
+}
+
+func computeMAC(secret, data []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadKeyring reads the keyring from the secondary store. Installs from
+// before key rotation only have the single secret; it becomes the first key.
+func loadKeyring(backup BackupStore) (*keyring, error) {
+	data, err := backup.LoadKeyring()
+	if err == nil {
+		var ring keyring
+		if err := json.Unmarshal(data, &ring); err != nil {
+			return nil, fmt.Errorf("keyring unreadable: %w", err)
+		}
+		if ring.current() == nil {
+			return nil, errors.New("keyring is empty")
+		}
+		return &ring, nil
+	}
+	if !errors.Is(err, ErrNoBackup) {
+		return nil, err
+	}
+
+	secret, err := backup.GetOrCreateSecret()
+	if err != nil {
+		return nil, err
+	}
+	ring := &keyring{Keys: []signingKey{{
+		ID:      keyIDFor(secret),
+		Secret:  secret,
+		Created: clock.Default().Now(),
+	}}}
+	if err := saveKeyring(backup, ring); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+func saveKeyring(backup BackupStore, ring *keyring) error {
+	data, err := json.Marshal(ring)
+	if err != nil {
+		return err
+	}
+	return backup.SaveKeyring(data)
+}
+
+// sign returns the .sig content for data using the current key.
+func (s *Store) sign(data []byte) string {
+	key := s.keys.current()
+	if key == nil {
+		return ""
+	}
+	out, _ := json.Marshal(signature{
+		Version:   sigFormatVersion,
+		Algorithm: sigAlgorithm,
+		KeyID:     key.ID,
+		MAC:       computeMAC(key.Secret, data),
+	})
+	return string(out)
+}
+
+// verify checks sig against data. Both the versioned format and the bare
+// hex digest written by older builds are accepted. A key ID we do not know
+// means the other process rotated the key, so the keyring is reloaded once.
+func (s *Store) verify(data []byte, sig string) bool {
+	sig = strings.TrimSpace(sig)
+	if sig == "" || s.keys == nil {
+		return false
+	}
+	now := s.clock.Now()
+
+	if !strings.HasPrefix(sig, "{") {
+		// Legacy: bare hex digest, no key ID
+		for i := range s.keys.Keys {
+			key := &s.keys.Keys[i]
+			if key.usable(now) && hmac.Equal([]byte(computeMAC(key.Secret, data)), []byte(sig)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var parsed signature
+	if err := json.Unmarshal([]byte(sig), &parsed); err != nil {
+		return false
+	}
+	if parsed.Version != sigFormatVersion || parsed.Algorithm != sigAlgorithm {
+		return false
+	}
+
+	key := s.keys.find(parsed.KeyID)
+	if key == nil {
+		if ring, err := loadKeyring(s.backup); err == nil {
+			s.keys = ring
+			key = s.keys.find(parsed.KeyID)
+		}
+	}
+	if key == nil || !key.usable(now) {
+		return false
+	}
+	return hmac.Equal([]byte(computeMAC(key.Secret, data)), []byte(parsed.MAC))
+}
+
+// CurrentKeyID returns the ID of the key new signatures are made with.
+func (s *Store) CurrentKeyID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key := s.keys.current(); key != nil {
+		return key.ID
+	}
+	return ""
+}
+
+// RotateKey replaces the signing key, e.g. after a suspected leak, and
+// re-signs the config and backup with the new key. The previous key keeps
+// verifying for KeyGraceWindow; keys past their window are dropped.
+func (s *Store) RotateKey() error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
+
+	// Make sure we re-sign what is actually on disk
+	if err := s.loadInternal(); err != nil {
+		return fmt.Errorf("refusing to rotate key: %w", err)
+	}
+
+	// The journal is re-chained under the new key below, which would launder
+	// a broken chain
+	entries, err := s.readJournal()
+	if err != nil {
+		return err
+	}
+	journalIntact := s.verifyChain(entries) == nil
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	now := s.clock.Now()
+
+	ring := &keyring{}
+	for _, key := range s.keys.Keys {
+		if key.Retired.IsZero() {
+			key.Retired = now
+		}
+		if key.usable(now) {
+			ring.Keys = append(ring.Keys, key)
+		}
+	}
+	ring.Keys = append(ring.Keys, signingKey{
+		ID:      keyIDFor(secret),
+		Secret:  secret,
+		Created: now,
+	})
+
+	// Keyring first: if the re-sign fails, the old signature still verifies
+	// during the grace window.
+	if err := saveKeyring(s.backup, ring); err != nil {
+		return err
+	}
+	s.keys = ring
+
+	// Keys past their window are gone from the ring now: MAC the journal
+	// under the new key so that it keeps verifying
+	if journalIntact {
+		if err := s.rechainJournal(entries); err != nil {
+			return err
+		}
+	}
+
+	return s.saveInternalAs(s.source + " (key rotation)")
+}
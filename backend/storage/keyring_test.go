@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"focus-lock/backend/clock"
+	"testing"
+	"time"
+)
+
+func TestRetiredKeyVerifiesWithinGraceWindow(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC))
+	s, err := NewStoreWithBackup(t.TempDir(), NewMemoryBackupStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetClock(clk)
+
+	data := []byte(`{"ghost_task_name":"old"}`)
+	oldSig := s.sign(data)
+	oldKey := s.CurrentKeyID()
+	if err := s.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if s.CurrentKeyID() == oldKey {
+		t.Fatal("RotateKey kept the signing key")
+	}
+
+	tests := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},
+		{KeyGraceWindow - time.Minute, true},
+		{KeyGraceWindow, false},
+		{KeyGraceWindow + time.Hour, false},
+	}
+	start := clk.Now()
+	for _, tt := range tests {
+		clk.Set(start.Add(tt.after))
+		if got := s.verify(data, oldSig); got != tt.want {
+			t.Errorf("%s after rotation: verify = %v, want %v", tt.after, got, tt.want)
+		}
+	}
+
+	// The new key is not affected
+	if !s.verify(data, s.sign(data)) {
+		t.Fatal("signature under the current key does not verify")
+	}
+}
+
+func TestRotateKeyKeepsBrokenJournalBroken(t *testing.T) {
+	s := journaledStore(t)
+	entries, err := s.readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries[1].Source = "forged"
+	writeEntries(t, s, entries)
+
+	// Rotation still goes ahead, but does not rechain the forged entry
+	oldKey := s.CurrentKeyID()
+	if err := s.RotateKey(); err != nil {
+		t.Fatalf("RotateKey on a broken journal: %v", err)
+	}
+	if s.CurrentKeyID() == oldKey {
+		t.Fatal("RotateKey kept the signing key")
+	}
+	if err := s.VerifyJournal(); !errors.Is(err, ErrJournalTampered) {
+		t.Fatalf("err = %v, want ErrJournalTampered", err)
+	}
+
+	// The config is signed under the new key
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := s.TamperEvents(); len(events) > 0 {
+		t.Fatalf("config does not verify after rotation: %+v", events)
+	}
+}
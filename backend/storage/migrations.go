@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CurrentSchemaVersion is the config layout written by this build.
+// Bump it together with a new entry in migrations.
+const CurrentSchemaVersion = 6
+
+// ErrUnsupportedSchema is returned when config.json was written by a newer
+// build. The file is left untouched and saving is refused.
+var ErrUnsupportedSchema = errors.New("config schema version is newer than this build supports")
+
+// migration upgrades a raw config document from version From to From+1.
+// It works on the decoded JSON object rather than on Config so that it keeps
+// compiling after the struct moves on.
+type migration struct {
+	From    int
+	Migrate func(doc map[string]any) error
+}
+
+// migrations must stay ordered: migrations[i].From == i.
+var migrations = []migration{
+	{From: 0, Migrate: migrateV0ToV1},
+	{From: 1, Migrate: migrateV1ToV2},
+	{From: 2, Migrate: migrateV2ToV3},
+	{From: 3, Migrate: migrateV3ToV4},
+	{From: 4, Migrate: migrateV4ToV5},
+	{From: 5, Migrate: migrateV5ToV6},
+}
+
+func init() {
+	if len(migrations) != CurrentSchemaVersion {
+		panic("storage: migrations do not reach CurrentSchemaVersion")
+	}
+	for i, m := range migrations {
+		if m.From != i {
+			panic(fmt.Sprintf("storage: migration %d is out of order (from %d)", i, m.From))
+		}
+	}
+}
+
+var (
+	// errStatsImport means the stats could not be moved out of a pre-v3 config.
+	// The config is left as it is so that the move can be retried.
+	errStatsImport = errors.New("could not move stats out of config")
+	// errJournalUpgrade means a pre-v6 journal could not be re-chained. The
+	// config is left as it is so that the upgrade can be retried.
+	errJournalUpgrade = errors.New("could not upgrade the config journal")
+)
+
+// migrate is migrateConfig plus what a migration cannot do on the document
+// alone: before v3 drops the stats counters, they are moved to the stats
+// store, and before v6 the journal is moved to the keyed chain.
+func (s *Store) migrate(data []byte) (out []byte, migrated bool, err error) {
+	var legacy struct {
+		SchemaVersion int    `json:"schema_version"`
+		Stats         *Stats `json:"stats"`
+	}
+	if json.Unmarshal(data, &legacy) == nil {
+		if legacy.SchemaVersion < 3 && legacy.Stats != nil {
+			if err := s.stats.importLegacy(*legacy.Stats); err != nil {
+				return nil, false, fmt.Errorf("%w: %v", errStatsImport, err)
+			}
+		}
+		if legacy.SchemaVersion < 6 {
+			if err := s.upgradeJournal(); err != nil {
+				return nil, false, fmt.Errorf("%w: %v", errJournalUpgrade, err)
+			}
+		}
+	}
+	return migrateConfig(data)
+}
+
+// migrationRetryable reports whether err from migrate leaves the config as
+// it is for the next load to retry, rather than meaning it is unreadable.
+func migrationRetryable(err error) bool {
+	return errors.Is(err, ErrUnsupportedSchema) || errors.Is(err, errStatsImport) || errors.Is(err, errJournalUpgrade)
+}
+
+// migrateConfig brings a verified config body up to CurrentSchemaVersion.
+// It returns the input unchanged (and migrated == false) if it is already current.
+func migrateConfig(data []byte) (out []byte, migrated bool, err error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, false, err
+	}
+
+	if header.SchemaVersion > CurrentSchemaVersion {
+		return nil, false, fmt.Errorf("%w (file v%d, supported v%d)", ErrUnsupportedSchema, header.SchemaVersion, CurrentSchemaVersion)
+	}
+	if header.SchemaVersion == CurrentSchemaVersion {
+		return data, false, nil
+	}
+
+	// UseNumber keeps int64 fields (durations in ns) exact.
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, false, err
+	}
+
+	for _, m := range migrations[header.SchemaVersion:] {
+		if err := m.Migrate(doc); err != nil {
+			return nil, false, fmt.Errorf("migration v%d -> v%d failed: %w", m.From, m.From+1, err)
+		}
+		doc["schema_version"] = m.From + 1
+	}
+
+	out, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// migrateV0ToV1 normalizes files written before versioning. Fields added over
+// time (schedules, paused_until, emergency_unlocks_used) may be missing or
+// null, and the stats maps may be absent.
+func migrateV0ToV1(doc map[string]any) error {
+	for _, key := range []string{"blocked_apps", "blocked_sites", "schedules"} {
+		if doc[key] == nil {
+			doc[key] = []any{}
+		}
+	}
+
+	if _, ok := doc["emergency_unlocks_used"]; !ok {
+		doc["emergency_unlocks_used"] = 0
+	}
+
+	stats, _ := doc["stats"].(map[string]any)
+	if stats == nil {
+		stats = map[string]any{}
+	}
+	for _, key := range []string{"kill_counts", "blocked_frequency", "blocked_duration"} {
+		if stats[key] == nil {
+			stats[key] = map[string]any{}
+		}
+	}
+	doc["stats"] = stats
+
+	return nil
+}
+
+// migrateV1ToV2 adds the tamper penalty policy with its defaults.
+func migrateV1ToV2(doc map[string]any) error {
+	if _, ok := doc["tamper_policy"]; !ok {
+		policy := DefaultTamperPolicy()
+		doc["tamper_policy"] = map[string]any{
+			"extend_lock_minutes":      policy.ExtendLockMinutes,
+			"consume_emergency_unlock": policy.ConsumeEmergencyUnlock,
+		}
+	}
+	return nil
+}
+
+// migrateV2ToV3 drops the stats counters, which now live in stats.json
+// (Store.migrate has moved them there), and adds stats retention.
+func migrateV2ToV3(doc map[string]any) error {
+	delete(doc, "stats")
+	if _, ok := doc["stats_retention"]; !ok {
+		r := DefaultStatsRetention()
+		doc["stats_retention"] = map[string]any{
+			"raw_hours":    r.RawHours,
+			"hourly_days":  r.HourlyDays,
+			"daily_days":   r.DailyDays,
+			"weekly_weeks": r.WeeklyWeeks,
+		}
+	}
+	return nil
+}
+
+// migrateV3ToV4 moves the single blocklist into a profile named Default and
+// makes it the active one. Schedules without a profile follow the active
+// profile, so they keep enforcing the same lists. The profile always gets
+// MigratedProfileID, so that the migration is deterministic.
+func migrateV3ToV4(doc map[string]any) error {
+	apps, _ := doc["blocked_apps"].([]any)
+	sites, _ := doc["blocked_sites"].([]any)
+	vpn, ok := doc["block_common_vpn"].(bool)
+	if !ok {
+		vpn = true
+	}
+	if apps == nil {
+		apps = []any{}
+	}
+	if sites == nil {
+		sites = []any{}
+	}
+
+	doc["profiles"] = []any{map[string]any{
+		"id":               MigratedProfileID,
+		"name":             DefaultProfileName,
+		"blocked_apps":     apps,
+		"blocked_sites":    sites,
+		"block_common_vpn": vpn,
+	}}
+	doc["active_profile_id"] = MigratedProfileID
+	doc["session_profile_id"] = ""
+
+	delete(doc, "blocked_apps")
+	delete(doc, "blocked_sites")
+	delete(doc, "block_common_vpn")
+	return nil
+}
+
+// migrateV4ToV5 turns each profile's app names into name rules, folding in
+// the per-app termination settings that were kept beside them.
+func migrateV4ToV5(doc map[string]any) error {
+	profiles, _ := doc["profiles"].([]any)
+	for _, raw := range profiles {
+		profile, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("profile is %T, not an object", raw)
+		}
+		apps, _ := profile["blocked_apps"].([]any)
+		terms, _ := profile["app_termination"].(map[string]any)
+
+		rules := []any{}
+		for _, app := range apps {
+			name, ok := app.(string)
+			if !ok {
+				return fmt.Errorf("blocked app is %T, not a string", app)
+			}
+			rule := map[string]any{"type": string(RuleName), "value": strings.TrimSpace(name)}
+			if term, ok := terms[strings.ToLower(strings.TrimSpace(name))]; ok {
+				rule["termination"] = term
+			}
+			rules = append(rules, rule)
+		}
+		profile["app_rules"] = rules
+		delete(profile, "blocked_apps")
+		delete(profile, "app_termination")
+	}
+	return nil
+}
+
+// migrateV5ToV6 leaves the document as it is: v6 chains the journal with an
+// HMAC rather than a plain hash, which Store.migrate takes care of.
+func migrateV5ToV6(doc map[string]any) error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// goldenPath returns the config document at schema version v. v0.json is a
+// config as written before versioning; each later file is the one before
+// it after one migration.
+func goldenPath(v int) string {
+	return filepath.Join("testdata", "migrations", fmt.Sprintf("v%d.json", v))
+}
+
+// canonical re-encodes a JSON document so that formatting does not matter.
+func canonical(t *testing.T, data []byte) string {
+	t.Helper()
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out) + "\n"
+}
+
+func TestMigrationsGolden(t *testing.T) {
+	for _, m := range migrations {
+		t.Run(fmt.Sprintf("v%d-v%d", m.From, m.From+1), func(t *testing.T) {
+			before, err := os.ReadFile(goldenPath(m.From))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]any
+			dec := json.NewDecoder(bytes.NewReader(before))
+			dec.UseNumber()
+			if err := dec.Decode(&doc); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Migrate(doc); err != nil {
+				t.Fatal(err)
+			}
+			doc["schema_version"] = m.From + 1
+
+			out, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := canonical(t, out)
+			if *update {
+				if err := os.WriteFile(goldenPath(m.From+1), []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath(m.From + 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != canonical(t, want) {
+				t.Fatalf("v%d migrated to:\n%s\nwant:\n%s", m.From, got, want)
+			}
+		})
+	}
+}
+
+// TestMigrateConfigIsDeterministic checks that every version reaches the
+// same current document, however often it is migrated. The backup is
+// migrated separately from config.json and must end up identical.
+func TestMigrateConfigIsDeterministic(t *testing.T) {
+	want, err := os.ReadFile(goldenPath(CurrentSchemaVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := 0; v < CurrentSchemaVersion; v++ {
+		before, err := os.ReadFile(goldenPath(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, migrated, err := migrateConfig(before)
+		if err != nil || !migrated {
+			t.Fatalf("v%d: migrated = %v, err = %v", v, migrated, err)
+		}
+		second, _, err := migrateConfig(before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if canonical(t, first) != canonical(t, second) {
+			t.Fatalf("v%d migrates differently each time", v)
+		}
+		if canonical(t, first) != canonical(t, want) {
+			t.Fatalf("v%d migrated to:\n%s\nwant:\n%s", v, first, want)
+		}
+	}
+
+	current, migrated, err := migrateConfig(want)
+	if err != nil || migrated || !bytes.Equal(current, want) {
+		t.Fatalf("current version was changed: migrated = %v, err = %v", migrated, err)
+	}
+}
+
+func TestMigrateConfigRejectsNewerSchema(t *testing.T) {
+	_, _, err := migrateConfig([]byte(fmt.Sprintf(`{"schema_version": %d}`, CurrentSchemaVersion+1)))
+	if !errors.Is(err, ErrUnsupportedSchema) {
+		t.Fatalf("err = %v, want ErrUnsupportedSchema", err)
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// DefaultProfileName is the profile that older configs' blocklists move into.
+const DefaultProfileName = "Default"
+
+// MigratedProfileID is the ID of the profile that older configs' blocklists
+// move into. It is fixed so that config.json and its backup, which are
+// migrated separately, agree on it.
+const MigratedProfileID = "default"
+
+var (
+	// ErrProfileNotFound is returned for an unknown profile ID.
+	ErrProfileNotFound = errors.New("profile not found")
+	// ErrLastProfile is returned when deleting the only remaining profile.
+	ErrLastProfile = errors.New("cannot delete the last profile")
+)
+
+// Profile is a named blocklist (e.g. Work, Study, Evening). Sessions and
+// schedules each enforce one profile.
+type Profile struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	AppRules       []AppRule `json:"app_rules"`
+	BlockedSites   []string  `json:"blocked_sites"`
+	BlockCommonVPN bool      `json:"block_common_vpn"`
+	Action         Action    `json:"action,omitempty"` // For rules without their own; empty means ActionKill
+}
+
+// NewProfile returns an empty profile with a fresh ID and VPN blocking on.
+func NewProfile(name string) Profile {
+	return Profile{
+		ID:             uuid.New().String(),
+		Name:           strings.TrimSpace(name),
+		AppRules:       []AppRule{},
+		BlockedSites:   []string{},
+		BlockCommonVPN: true,
+	}
+}
+
+// EffectiveAction returns what the enforcer does with processes the
+// profile's rules match, unless a rule says otherwise.
+func (p *Profile) EffectiveAction() Action {
+	if p.Action == "" {
+		return ActionKill
+	}
+	return p.Action
+}
+
+// Normalize sorts the lists and replaces nil with empty slices, so the
+// profile serializes the same way however it was built.
+func (p *Profile) Normalize() {
+	if p.AppRules == nil {
+		p.AppRules = []AppRule{}
+	}
+	if p.BlockedSites == nil {
+		p.BlockedSites = []string{}
+	}
+	sortRules(p.AppRules)
+	sort.Strings(p.BlockedSites)
+}
+
+// Profile returns the profile with the given ID, or nil.
+func (c *Config) Profile(id string) *Profile {
+	for i := range c.Profiles {
+		if c.Profiles[i].ID == id {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// ProfileByName returns the profile with the given name (case-insensitive), or nil.
+func (c *Config) ProfileByName(name string) *Profile {
+	for i := range c.Profiles {
+		if strings.EqualFold(c.Profiles[i].Name, strings.TrimSpace(name)) {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// ActiveProfile returns the profile selected in the UI. It falls back to the
+// first profile and creates a default one if there are none, so it never
+// returns nil.
+func (c *Config) ActiveProfile() *Profile {
+	if p := c.Profile(c.ActiveProfileID); p != nil {
+		return p
+	}
+	if len(c.Profiles) == 0 {
+		c.Profiles = []Profile{NewProfile(DefaultProfileName)}
+	}
+	c.ActiveProfileID = c.Profiles[0].ID
+	return &c.Profiles[0]
+}
+
+// ResolveProfile returns the profile with the given ID, or the active
+// profile when id is empty or no longer exists. Schedules and sessions keep
+// working after their profile is deleted.
+func (c *Config) ResolveProfile(id string) *Profile {
+	if p := c.Profile(id); p != nil {
+		return p
+	}
+	return c.ActiveProfile()
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const quarantineFile = "quarantine.json"
+
+// RelaunchPolicy says how the enforcer escalates when a blocked app keeps
+// being relaunched as soon as it is killed. A warning is always shown.
+type RelaunchPolicy struct {
+	EndParent  bool `json:"end_parent"` // End the process that keeps relaunching it
+	Quarantine bool `json:"quarantine"` // Rename its executable until the session ends
+}
+
+// QuarantinedFile is an executable renamed so that it cannot be started
+// again until the session ends.
+type QuarantinedFile struct {
+	Path    string    `json:"path"`     // Where it belongs
+	MovedTo string    `json:"moved_to"` // Where it is now
+	Since   time.Time `json:"since"`
+}
+
+// QuarantineStore lists the quarantined executables. Like SuspendedStore,
+// it is on disk so that they are put back by whichever process sees the
+// session end, even after a crash.
+type QuarantineStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewQuarantineStore opens the quarantine list in dir.
+func NewQuarantineStore(dir string) *QuarantineStore {
+	return &QuarantineStore{path: filepath.Join(dir, quarantineFile)}
+}
+
+// update runs fn on the list under the file lock and saves the result if
+// fn reports a change.
+func (qs *QuarantineStore) update(fn func([]QuarantinedFile) ([]QuarantinedFile, bool)) error {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	fl, err := acquireFileLock(qs.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	files, err := qs.read()
+	if err != nil {
+		return err
+	}
+	files, changed := fn(files)
+	if !changed {
+		return nil
+	}
+	if len(files) == 0 {
+		if err := os.Remove(qs.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	out, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := qs.path + pendingSuffix
+	if err := writeFileSync(tmp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, qs.path)
+}
+
+func (qs *QuarantineStore) read() ([]QuarantinedFile, error) {
+	raw, err := readFileRetry(qs.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []QuarantinedFile
+	if err := json.Unmarshal(raw, &files); err != nil {
+		// Unlike PIDs, the moved files can still be found: refuse to
+		// forget them
+		return nil, err
+	}
+	return files, nil
+}
+
+// Add records f before the file is moved. It reports false if the path is
+// already quarantined.
+func (qs *QuarantineStore) Add(f QuarantinedFile) (bool, error) {
+	added := false
+	err := qs.update(func(files []QuarantinedFile) ([]QuarantinedFile, bool) {
+		for _, existing := range files {
+			if existing.Path == f.Path {
+				return files, false
+			}
+		}
+		added = true
+		return append(files, f), true
+	})
+	return added && err == nil, err
+}
+
+// Remove drops the record of path, e.g. when moving the file failed.
+func (qs *QuarantineStore) Remove(path string) error {
+	return qs.update(func(files []QuarantinedFile) ([]QuarantinedFile, bool) {
+		kept := files[:0]
+		for _, f := range files {
+			if f.Path != path {
+				kept = append(kept, f)
+			}
+		}
+		return kept, len(kept) != len(files)
+	})
+}
+
+// Take returns every record and clears the list, so that each file is put
+// back by one process only. Files that cannot be put back yet are to be
+// added again.
+func (qs *QuarantineStore) Take() ([]QuarantinedFile, error) {
+	var taken []QuarantinedFile
+	err := qs.update(func(files []QuarantinedFile) ([]QuarantinedFile, bool) {
+		taken = files
+		return nil, len(files) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return taken, nil
+}
+
+// List returns the quarantined files, oldest first.
+func (qs *QuarantineStore) List() ([]QuarantinedFile, error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	fl, err := acquireFileLock(qs.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer fl.release()
+
+	files, err := qs.read()
+	if files == nil && err == nil {
+		files = []QuarantinedFile{}
+	}
+	return files, err
+}
@@ -12,14 +12,25 @@ import (
 const (
 	registryPath = `Software\FocusLock`
 	keySecret    = "SecretKey"
-	keyLockEnd   = "LockEndTime"
-	keyRemDur    = "RemainingDuration"
-	keyPausedUse = "PausedUntil"
+	keySnapshot  = "ConfigSnapshot"
+	keyKeyring   = "Keyring"
+	keyEncKey    = "ConfigKey"
+
+	// Lock times written by builds before full snapshots
+	keyLegacyLockEnd   = "LockEndTime"
+	keyLegacyRemaining = "RemainingDuration"
+	keyLegacyPaused    = "PausedUntil"
 )
 
-// RegistryStore handles backup storage in Windows Registry
+// RegistryStore handles backup storage in Windows Registry.
+// It is the default BackupStore on Windows.
 type RegistryStore struct{}
 
+var (
+	_ BackupStore       = (*RegistryStore)(nil)
+	_ LegacyBackupStore = (*RegistryStore)(nil)
+)
+
 func NewRegistryStore() *RegistryStore {
 	return &RegistryStore{}
 }
@@ -59,69 +70,152 @@ func (r *RegistryStore) GetOrCreateSecret() ([]byte, error) {
 	return bytes, nil
 }
 
-// SaveBackup persists critical state to Registry
-func (r *RegistryStore) SaveBackup(lockEnd time.Time, remaining time.Duration, pausedUntil time.Time) error {
+// SaveBackup persists the config snapshot to Registry.
+// Body and signature go into a single REG_BINARY value so they are
+// always written together.
+func (r *RegistryStore) SaveBackup(snap Snapshot) error {
+	blob, err := encodeSnapshot(snap)
+	if err != nil {
+		return err
+	}
+
 	k, _, err := r.createKey()
 	if err != nil {
 		return err
 	}
 	defer k.Close()
 
-	// Store times as Unix timestamps / Duration nanoseconds
-	if err := k.SetQWordValue(keyLockEnd, uint64(lockEnd.Unix())); err != nil {
-		return err
+	return k.SetBinaryValue(keySnapshot, blob)
+}
+
+// LoadBackup retrieves the config snapshot from Registry
+func (r *RegistryStore) LoadBackup() (Snapshot, error) {
+	k, err := r.openKey(registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return Snapshot{}, ErrNoBackup
 	}
-	if err := k.SetQWordValue(keyRemDur, uint64(remaining)); err != nil {
-		return err
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer k.Close()
+
+	blob, _, err := k.GetBinaryValue(keySnapshot)
+	if err == registry.ErrNotExist {
+		return Snapshot{}, ErrNoBackup
 	}
-	// Store PausedUntil
-	if !pausedUntil.IsZero() {
-		return k.SetQWordValue(keyPausedUse, uint64(pausedUntil.Unix()))
-	} else {
-		// If zero, delete the value or set to 0. Deleting is cleaner but Set 0 is easier.
-		return k.SetQWordValue(keyPausedUse, 0)
+	if err != nil {
+		return Snapshot{}, err
 	}
+	return decodeSnapshot(blob)
 }
 
-// LoadBackup retrieves state from Registry
-func (r *RegistryStore) LoadBackup() (time.Time, time.Duration, time.Time, error) {
+// LoadLegacyBackup retrieves the lock times of builds before full snapshots.
+// They were stored as Unix seconds and nanoseconds, with 0 for none.
+func (r *RegistryStore) LoadLegacyBackup() (LegacyBackup, error) {
 	k, err := r.openKey(registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return LegacyBackup{}, ErrNoBackup
+	}
 	if err != nil {
-		return time.Time{}, 0, time.Time{}, err
+		return LegacyBackup{}, err
 	}
 	defer k.Close()
 
-	lockEndUnix, _, err := k.GetIntegerValue(keyLockEnd)
+	lockEnd, _, err := k.GetIntegerValue(keyLegacyLockEnd)
+	if err == registry.ErrNotExist {
+		return LegacyBackup{}, ErrNoBackup
+	}
 	if err != nil {
-		return time.Time{}, 0, time.Time{}, err
+		return LegacyBackup{}, err
+	}
+	// Optional even then, as in the old reader
+	remaining, _, _ := k.GetIntegerValue(keyLegacyRemaining)
+	paused, _, _ := k.GetIntegerValue(keyLegacyPaused)
+
+	var legacy LegacyBackup
+	if lockEnd > 0 {
+		legacy.LockEndTime = time.Unix(int64(lockEnd), 0)
+	}
+	legacy.RemainingDuration = time.Duration(remaining)
+	if paused > 0 {
+		legacy.PausedUntil = time.Unix(int64(paused), 0)
+	}
+	return legacy, nil
+}
+
+// DeleteLegacyBackup removes the old lock time values.
+func (r *RegistryStore) DeleteLegacyBackup() error {
+	k, err := r.openKey(registry.SET_VALUE)
+	if err == registry.ErrNotExist {
+		return nil
 	}
-	remDur, _, err := k.GetIntegerValue(keyRemDur)
 	if err != nil {
-		// Tolerable, might default to 0
-		remDur = 0
+		return err
+	}
+	defer k.Close()
+
+	for _, name := range []string{keyLegacyLockEnd, keyLegacyRemaining, keyLegacyPaused} {
+		if err := k.DeleteValue(name); err != nil && err != registry.ErrNotExist {
+			return err
+		}
 	}
-	pausedUnix, _, err := k.GetIntegerValue(keyPausedUse)
+	return nil
+}
+
+// SaveKeyring persists the signing keyring to Registry
+func (r *RegistryStore) SaveKeyring(data []byte) error {
+	k, _, err := r.createKey()
 	if err != nil {
-		pausedUnix = 0
+		return err
 	}
+	defer k.Close()
 
-	// 0 means no lock usually, but Unix(0) is 1970.
-	// If lockEndUnix is 0 or very old, assume unlocked?
-	// But we strictly just return what's there.
+	return k.SetBinaryValue(keyKeyring, data)
+}
 
-	// Handles the zero case: time.Unix(0,0) is 1970.
-	// Typically IsZero() checks for 0001-01-01.
-	// We'll let the logic handle it, but note that 0 in registry is 1970.
+// LoadKeyring retrieves the signing keyring from Registry
+func (r *RegistryStore) LoadKeyring() ([]byte, error) {
+	k, err := r.openKey(registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return nil, ErrNoBackup
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
 
-	var t time.Time
-	if lockEndUnix > 0 {
-		t = time.Unix(int64(lockEndUnix), 0)
+	data, _, err := k.GetBinaryValue(keyKeyring)
+	if err == registry.ErrNotExist {
+		return nil, ErrNoBackup
 	}
+	return data, err
+}
 
-	var pausedT time.Time
-	if pausedUnix > 0 {
-		pausedT = time.Unix(int64(pausedUnix), 0)
+// SaveEncryptionKey persists the config encryption key to Registry
+func (r *RegistryStore) SaveEncryptionKey(key []byte) error {
+	k, _, err := r.createKey()
+	if err != nil {
+		return err
 	}
+	defer k.Close()
 
-	return t, time.Duration(remDur), pausedT, nil
+	return k.SetBinaryValue(keyEncKey, key)
+}
+
+// LoadEncryptionKey retrieves the config encryption key from Registry
+func (r *RegistryStore) LoadEncryptionKey() ([]byte, error) {
+	k, err := r.openKey(registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return nil, ErrNoBackup
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	data, _, err := k.GetBinaryValue(keyEncKey)
+	if err == registry.ErrNotExist {
+		return nil, ErrNoBackup
+	}
+	return data, err
 }
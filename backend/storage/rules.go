@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RuleType says what an app rule is matched against.
+type RuleType string
+
+const (
+	RuleName      RuleType = "name"       // Executable file name, case-insensitive; ".exe" is optional
+	RulePathGlob  RuleType = "path_glob"  // Glob on the full executable path, case-insensitive
+	RulePathRegex RuleType = "path_regex" // Regular expression on the full executable path, case-insensitive
+	RuleSHA256    RuleType = "sha256"     // SHA-256 of the executable image, in hex
+)
+
+// MatchMode says how a name rule is compared with the product name and file
+// description of an executable's version metadata.
+type MatchMode string
+
+const (
+	MatchExact    MatchMode = "exact"    // The whole field equals the name
+	MatchPrefix   MatchMode = "prefix"   // The field starts with the name
+	MatchWord     MatchMode = "word"     // The name appears as a whole word; the default
+	MatchContains MatchMode = "contains" // The name appears anywhere, even inside a word
+)
+
+// ValidMatchMode reports whether m is a known mode. Empty means MatchWord.
+func ValidMatchMode(m MatchMode) bool {
+	switch m {
+	case "", MatchExact, MatchPrefix, MatchWord, MatchContains:
+		return true
+	}
+	return false
+}
+
+// RuleScope says which processes around a matched one a rule ends.
+type RuleScope string
+
+const (
+	ScopeProcess  RuleScope = "process"  // Only the matched process; the default
+	ScopeTree     RuleScope = "tree"     // The matched process and everything it launched
+	ScopeLaunched RuleScope = "launched" // Only what it launched, e.g. games started by a launcher
+)
+
+// ValidScope reports whether s is a known scope. Empty means ScopeProcess.
+func ValidScope(s RuleScope) bool {
+	switch s {
+	case "", ScopeProcess, ScopeTree, ScopeLaunched:
+		return true
+	}
+	return false
+}
+
+// Action says what the enforcer does with a process a rule matches.
+type Action string
+
+const (
+	ActionKill    Action = "kill"    // End it along the termination ladder; the default
+	ActionSuspend Action = "suspend" // Freeze it until the session ends
+	ActionNotify  Action = "notify"  // Leave it running and tell the user
+	ActionLog     Action = "log"     // Leave it running and only record it, to try out a rule
+
+	// ActionWarn is not a rule action: it marks audit entries of warnings
+	// the enforcer raises itself, e.g. about relaunch loops.
+	ActionWarn Action = "warn"
+)
+
+// ValidAction reports whether a is a known action. Empty means the
+// profile's action, or ActionKill.
+func ValidAction(a Action) bool {
+	switch a {
+	case "", ActionKill, ActionSuspend, ActionNotify, ActionLog:
+		return true
+	}
+	return false
+}
+
+// ErrInvalidRule is returned for rules of an unknown type or with a value
+// that does not parse.
+var ErrInvalidRule = errors.New("invalid app rule")
+
+// AppRule is one entry of a profile's app blocklist. Name rules are what
+// older configs' plain app names migrate to; the others survive renaming
+// the executable.
+type AppRule struct {
+	Type  RuleType `json:"type"`
+	Value string   `json:"value"`
+
+	// Match is how a name rule is compared with version metadata.
+	Match MatchMode `json:"match,omitempty"`
+	// Scope says whether the processes the match launched are ended too.
+	Scope RuleScope `json:"scope,omitempty"`
+	// Action overrides the profile's action for this rule.
+	Action Action `json:"action,omitempty"`
+	// Termination overrides DefaultTermination for this rule.
+	Termination *Termination `json:"termination,omitempty"`
+}
+
+// NameRule returns a rule matching the executable name.
+func NameRule(name string) AppRule {
+	return AppRule{Type: RuleName, Value: strings.TrimSpace(name)}
+}
+
+// NewAppRule validates value for the rule type and returns the rule.
+// Hashes are stored in lower case.
+func NewAppRule(t RuleType, value string) (AppRule, error) {
+	value = strings.TrimSpace(value)
+	if t == RuleSHA256 {
+		value = strings.ToLower(value)
+	}
+	r := AppRule{Type: t, Value: value}
+	if err := r.Validate(); err != nil {
+		return AppRule{}, err
+	}
+	return r, nil
+}
+
+// Validate checks the value for the rule type, and the match mode, scope
+// and action.
+func (r AppRule) Validate() error {
+	if strings.TrimSpace(r.Value) == "" {
+		return fmt.Errorf("%w: empty value", ErrInvalidRule)
+	}
+
+	switch r.Type {
+	case RuleName:
+	case RulePathGlob:
+		if _, err := filepath.Match(r.Value, ""); err != nil {
+			return fmt.Errorf("%w: glob %q: %v", ErrInvalidRule, r.Value, err)
+		}
+	case RulePathRegex:
+		if _, err := r.Regexp(); err != nil {
+			return fmt.Errorf("%w: regex %q: %v", ErrInvalidRule, r.Value, err)
+		}
+	case RuleSHA256:
+		if raw, err := hex.DecodeString(r.Value); err != nil || len(raw) != 32 {
+			return fmt.Errorf("%w: %q is not a SHA-256 hash", ErrInvalidRule, r.Value)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidRule, r.Type)
+	}
+
+	if !ValidMatchMode(r.Match) {
+		return fmt.Errorf("%w: unknown match mode %q", ErrInvalidRule, r.Match)
+	}
+	if !ValidScope(r.Scope) {
+		return fmt.Errorf("%w: unknown scope %q", ErrInvalidRule, r.Scope)
+	}
+	if !ValidAction(r.Action) {
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidRule, r.Action)
+	}
+	return nil
+}
+
+// Regexp compiles a path_regex rule the way the enforcer matches it:
+// case-insensitively.
+func (r AppRule) Regexp() (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + r.Value)
+}
+
+// knownRules returns every profile rule and exception of c, without their
+// termination settings.
+func (c *Config) knownRules() map[AppRule]bool {
+	known := make(map[AppRule]bool)
+	add := func(rules []AppRule) {
+		for _, r := range rules {
+			r.Termination = nil
+			known[r] = true
+		}
+	}
+	for i := range c.Profiles {
+		add(c.Profiles[i].AppRules)
+	}
+	add(c.Exceptions)
+	return known
+}
+
+// validateNewRules checks the rules of c that are not in known. Rules get
+// into the config by many paths (the bridge, imports, exceptions), so
+// Store.Update checks them all here rather than leave the enforcer to skip
+// them. Rules already saved are left alone, so that one written by an
+// older build can still be removed.
+func (c *Config) validateNewRules(known map[AppRule]bool) error {
+	for r := range c.knownRules() {
+		if known[r] {
+			continue
+		}
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Key identifies a rule for duplicate checks. Regular expressions are case
+// sensitive as written; everything else is compared case-insensitively.
+func (r AppRule) Key() string {
+	if r.Type == RulePathRegex {
+		return string(r.Type) + ":" + r.Value
+	}
+	return string(r.Type) + ":" + strings.ToLower(r.Value)
+}
+
+// EffectiveMatch returns how the rule is compared with version metadata.
+func (r AppRule) EffectiveMatch() MatchMode {
+	if r.Match == "" {
+		return MatchWord
+	}
+	return r.Match
+}
+
+// EffectiveScope returns which processes around a match the rule ends.
+func (r AppRule) EffectiveScope() RuleScope {
+	if r.Scope == "" {
+		return ScopeProcess
+	}
+	return r.Scope
+}
+
+// EffectiveAction returns what the enforcer does with the rule's matches.
+// Rules of enforced profiles carry their profile's action (see
+// Profile.RuleAction), so empty only remains for ActionKill.
+func (r AppRule) EffectiveAction() Action {
+	if r.Action == "" {
+		return ActionKill
+	}
+	return r.Action
+}
+
+// Ladder returns how processes matched by the rule are ended.
+func (r AppRule) Ladder() Termination {
+	if r.Termination != nil {
+		return *r.Termination
+	}
+	return DefaultTermination()
+}
+
+// RuleAction returns r's action, falling back to the profile's.
+func (p *Profile) RuleAction(r AppRule) Action {
+	if r.Action == "" {
+		return p.EffectiveAction()
+	}
+	return r.Action
+}
+
+// Rule returns the rule of the given type and value, or nil.
+func (p *Profile) Rule(t RuleType, value string) *AppRule {
+	key := AppRule{Type: t, Value: strings.TrimSpace(value)}.Key()
+	for i := range p.AppRules {
+		if p.AppRules[i].Key() == key {
+			return &p.AppRules[i]
+		}
+	}
+	return nil
+}
+
+// AddRule appends r unless the profile already has it. It reports whether
+// the rule was added.
+func (p *Profile) AddRule(r AppRule) bool {
+	if p.Rule(r.Type, r.Value) != nil {
+		return false
+	}
+	p.AppRules = append(p.AppRules, r)
+	sortRules(p.AppRules)
+	return true
+}
+
+// RemoveRule drops the rule of the given type and value. It reports whether
+// there was one.
+func (p *Profile) RemoveRule(t RuleType, value string) bool {
+	key := AppRule{Type: t, Value: strings.TrimSpace(value)}.Key()
+	kept := []AppRule{}
+	for _, r := range p.AppRules {
+		if r.Key() != key {
+			kept = append(kept, r)
+		}
+	}
+	removed := len(kept) != len(p.AppRules)
+	p.AppRules = kept
+	return removed
+}
+
+// BlockedAppNames returns the values of the name rules, which is what the
+// app list in the UI shows.
+func (p *Profile) BlockedAppNames() []string {
+	names := []string{}
+	for _, r := range p.AppRules {
+		if r.Type == RuleName {
+			names = append(names, r.Value)
+		}
+	}
+	return names
+}
+
+// SetBlockedAppNames replaces the name rules with names, keeping the
+// settings of names that stay and every rule of another type.
+func (p *Profile) SetBlockedAppNames(names []string) {
+	var rules []AppRule
+	for _, r := range p.AppRules {
+		if r.Type != RuleName {
+			rules = append(rules, r)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		rule := NameRule(name)
+		if rule.Value == "" || seen[rule.Key()] {
+			continue
+		}
+		seen[rule.Key()] = true
+		if existing := p.Rule(RuleName, name); existing != nil {
+			rule = *existing
+		}
+		rules = append(rules, rule)
+	}
+	if rules == nil {
+		rules = []AppRule{}
+	}
+	sortRules(rules)
+	p.AppRules = rules
+}
+
+// sortRules orders rules by type, then value.
+func sortRules(rules []AppRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Type != rules[j].Type {
+			return rules[i].Type < rules[j].Type
+		}
+		return rules[i].Value < rules[j].Value
+	})
+}
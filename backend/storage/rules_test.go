@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAppRuleValidate(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name  string
+		rule  AppRule
+		valid bool
+	}{
+		{"name", AppRule{Type: RuleName, Value: "game.exe"}, true},
+		{"empty", AppRule{Type: RuleName, Value: " "}, false},
+		{"glob", AppRule{Type: RulePathGlob, Value: `C:\Games\*\*.exe`}, true},
+		{"bad glob", AppRule{Type: RulePathGlob, Value: `games/[a-`}, false},
+		{"regex", AppRule{Type: RulePathRegex, Value: `\\games\\.+\.exe$`}, true},
+		{"bad regex", AppRule{Type: RulePathRegex, Value: `games(`}, false},
+		{"sha256", AppRule{Type: RuleSHA256, Value: hash}, true},
+		{"short sha256", AppRule{Type: RuleSHA256, Value: hash[2:]}, false},
+		{"sha256 not hex", AppRule{Type: RuleSHA256, Value: strings.Repeat("zz", 32)}, false},
+		{"unknown type", AppRule{Type: "title", Value: "game"}, false},
+		{"match mode", AppRule{Type: RuleName, Value: "game", Match: MatchPrefix}, true},
+		{"unknown match mode", AppRule{Type: RuleName, Value: "game", Match: "fuzzy"}, false},
+		{"scope", AppRule{Type: RuleName, Value: "game", Scope: ScopeLaunched}, true},
+		{"unknown scope", AppRule{Type: RuleName, Value: "game", Scope: "children"}, false},
+		{"action", AppRule{Type: RuleName, Value: "game", Action: ActionSuspend}, true},
+		{"warn is no rule action", AppRule{Type: RuleName, Value: "game", Action: ActionWarn}, false},
+	}
+	for _, tt := range tests {
+		err := tt.rule.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%s: err = %v, want ErrInvalidRule", tt.name, err)
+		}
+	}
+}
+
+func TestUpdateRefusesInvalidRules(t *testing.T) {
+	s, err := NewStoreWithBackup(t.TempDir(), NewMemoryBackupStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := AppRule{Type: RulePathRegex, Value: `games`}
+	bad := AppRule{Type: RulePathRegex, Value: `games(`}
+
+	err = s.UpdateAtomic(func(cfg *Config) {
+		cfg.ActiveProfile().AddRule(good)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, add := range map[string]func(*Config){
+		"profile rule": func(cfg *Config) { cfg.ActiveProfile().AddRule(bad) },
+		"exception":    func(cfg *Config) { cfg.Exceptions = append(cfg.Exceptions, bad) },
+	} {
+		if err := s.UpdateAtomic(add); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%s: err = %v, want ErrInvalidRule", name, err)
+		}
+	}
+
+	// Nothing of the refused changes is left to be saved with the next one
+	if err := s.UpdateAtomic(func(cfg *Config) { cfg.GhostTaskName = "task" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := s.Snapshot()
+	if rules := cfg.ActiveProfile().AppRules; len(rules) != 1 || rules[0].Value != good.Value {
+		t.Fatalf("rules = %+v, want only %+v", rules, good)
+	}
+	if len(cfg.Exceptions) != 0 {
+		t.Fatalf("exceptions = %+v, want none", cfg.Exceptions)
+	}
+}
@@ -0,0 +1,494 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"focus-lock/backend/clock"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const sessionsFile = "sessions.jsonl"
+
+// Session triggers.
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+)
+
+// ErrSessionNotOpen is returned when ending a session that is unknown or
+// already ended (typically by the other process).
+var ErrSessionNotOpen = errors.New("session is not open")
+
+// Session is one manual or scheduled lock.
+type Session struct {
+	ID               string        `json:"id"`
+	Trigger          string        `json:"trigger"`               // TriggerManual or TriggerSchedule
+	ScheduleID       string        `json:"schedule_id,omitempty"` // Set for TriggerSchedule
+	ProfileID        string        `json:"profile_id,omitempty"`  // Profile the session enforced
+	Apps             []string      `json:"apps"`                  // Blocked apps when the session started
+	Start            time.Time     `json:"start"`
+	PlannedEnd       time.Time     `json:"planned_end"`
+	End              time.Time     `json:"end"` // Zero while running
+	Kills            []SessionKill `json:"kills"`
+	EmergencyUnlocks int           `json:"emergency_unlocks"`
+}
+
+// SessionKill is one process killed during a session.
+type SessionKill struct {
+	App  string    `json:"app"`
+	Time time.Time `json:"time"`
+}
+
+// Open reports whether the session is still running.
+func (s Session) Open() bool {
+	return s.End.IsZero()
+}
+
+// Duration is how long the session actually lasted, or has lasted so far.
+func (s Session) Duration(now time.Time) time.Duration {
+	end := s.End
+	if end.IsZero() {
+		end = now
+	}
+	if end.Before(s.Start) {
+		return 0
+	}
+	return end.Sub(s.Start)
+}
+
+// sessionRecord is one line in the sessions file. A session is the replay
+// of its records, so the file is only appended to; it is rewritten just once,
+// when encryption is turned on (see sealPlannedEnds).
+type sessionRecord struct {
+	Kind    string    `json:"kind"` // start, kill, unlock, end
+	Session string    `json:"session"`
+	Time    time.Time `json:"time"`
+	Start   *Session  `json:"start,omitempty"` // kind start
+	App     string    `json:"app,omitempty"`   // kind kill
+
+	// SealedEnd replaces Start.PlannedEnd while encryption is on, so that
+	// the history does not give away when a running lock ends.
+	SealedEnd []byte `json:"sealed_end,omitempty"`
+}
+
+// SessionStore is the append-only history of lock sessions. It lives next to
+// config.json but outside it, so kills do not rewrite the signed config.
+type SessionStore struct {
+	mu    sync.Mutex
+	path  string
+	clock clock.Clock // For the running length of open sessions
+
+	// keys returns the key for planned ends and whether to seal new ones;
+	// nil keeps them in plaintext. Set by the Store.
+	keys func() (key []byte, seal bool, err error)
+}
+
+// NewSessionStore opens the session history in dir.
+func NewSessionStore(dir string) *SessionStore {
+	return &SessionStore{path: filepath.Join(dir, sessionsFile), clock: clock.Default()}
+}
+
+// key returns the planned-end key; see keys. Called before lock.
+func (ss *SessionStore) key() ([]byte, bool, error) {
+	if ss.keys == nil {
+		return nil, false, nil
+	}
+	return ss.keys()
+}
+
+func (ss *SessionStore) setClock(c clock.Clock) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.clock = c
+}
+
+// lock serializes access within the process and with the other process.
+func (ss *SessionStore) lock() (*fileLock, error) {
+	ss.mu.Lock()
+	fl, err := acquireFileLock(ss.path+lockSuffix, lockTimeout)
+	if err != nil {
+		ss.mu.Unlock()
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (ss *SessionStore) unlock(fl *fileLock) {
+	fl.release()
+	ss.mu.Unlock()
+}
+
+// Begin records the start of sess and returns it. If a session with the same
+// trigger and schedule is already open (the UI and the ghost both notice a
+// schedule starting), that one is returned instead. An empty ID is filled in.
+func (ss *SessionStore) Begin(sess Session) (Session, error) {
+	key, seal, err := ss.key()
+	if err != nil {
+		return Session{}, err
+	}
+	fl, err := ss.lock()
+	if err != nil {
+		return Session{}, err
+	}
+	defer ss.unlock(fl)
+
+	sessions, err := ss.replay(key)
+	if err != nil {
+		return Session{}, err
+	}
+	for _, existing := range sessions {
+		if existing.Open() && existing.Trigger == sess.Trigger && existing.ScheduleID == sess.ScheduleID {
+			return existing, nil
+		}
+	}
+
+	if sess.ID == "" {
+		sess.ID = uuid.NewString()
+	}
+	sess.End = time.Time{}
+	sess.Kills = []SessionKill{}
+	sess.EmergencyUnlocks = 0
+	if sess.Apps == nil {
+		sess.Apps = []string{}
+	}
+
+	rec := sessionRecord{Kind: "start", Session: sess.ID, Time: sess.Start, Start: &sess}
+	if seal {
+		if err := sealPlannedEnd(&rec, key); err != nil {
+			return Session{}, err
+		}
+	}
+	return sess, ss.append(rec)
+}
+
+// sealPlannedEnd moves the planned end of a start record to SealedEnd.
+func sealPlannedEnd(rec *sessionRecord, key []byte) error {
+	sealed, err := sealTime(key, rec.Start.PlannedEnd)
+	if err != nil {
+		return err
+	}
+	start := *rec.Start
+	start.PlannedEnd = time.Time{}
+	rec.Start, rec.SealedEnd = &start, sealed
+	return nil
+}
+
+// sealPlannedEnds seals the planned ends recorded before encryption was
+// turned on. Called by the Store, with its lock held.
+func (ss *SessionStore) sealPlannedEnds(key []byte) error {
+	fl, err := ss.lock()
+	if err != nil {
+		return err
+	}
+	defer ss.unlock(fl)
+
+	data, err := os.ReadFile(ss.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	sealed := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec sessionRecord
+		if json.Unmarshal(line, &rec) == nil && rec.Kind == "start" && rec.Start != nil &&
+			rec.SealedEnd == nil && !rec.Start.PlannedEnd.IsZero() {
+			if err := sealPlannedEnd(&rec, key); err != nil {
+				return err
+			}
+			if line, err = json.Marshal(rec); err != nil {
+				return err
+			}
+			sealed = true
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if !sealed {
+		return nil
+	}
+
+	tmp := ss.path + pendingSuffix
+	if err := writeFileSync(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ss.path)
+}
+
+// RecordKill attributes a kill to the most recently started open session.
+// Kills outside any session are not recorded.
+func (ss *SessionStore) RecordKill(app string, t time.Time) error {
+	return ss.recordEvent(sessionRecord{Kind: "kill", Time: t, App: app})
+}
+
+// RecordKills attributes a batch of kills, each to the most recently
+// started session that was running at its time, so that kills written
+// after their session ended still count for it.
+func (ss *SessionStore) RecordKills(kills []SessionKill) error {
+	fl, err := ss.lock()
+	if err != nil {
+		return err
+	}
+	defer ss.unlock(fl)
+
+	sessions, err := ss.replay(nil) // Planned ends are not needed
+	if err != nil {
+		return err
+	}
+	for _, k := range kills {
+		var newest *Session
+		for i := range sessions {
+			sess := &sessions[i]
+			running := !k.Time.Before(sess.Start) && (sess.Open() || k.Time.Before(sess.End))
+			if running && (newest == nil || sess.Start.After(newest.Start)) {
+				newest = sess
+			}
+		}
+		if newest == nil {
+			continue
+		}
+		if err := ss.append(sessionRecord{Kind: "kill", Session: newest.ID, Time: k.Time, App: k.App}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordEmergencyUnlock attributes an emergency unlock like RecordKill.
+func (ss *SessionStore) RecordEmergencyUnlock(t time.Time) error {
+	return ss.recordEvent(sessionRecord{Kind: "unlock", Time: t})
+}
+
+func (ss *SessionStore) recordEvent(rec sessionRecord) error {
+	fl, err := ss.lock()
+	if err != nil {
+		return err
+	}
+	defer ss.unlock(fl)
+
+	sessions, err := ss.replay(nil)
+	if err != nil {
+		return err
+	}
+	var newest *Session
+	for i := range sessions {
+		if sessions[i].Open() && (newest == nil || sessions[i].Start.After(newest.Start)) {
+			newest = &sessions[i]
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+
+	rec.Session = newest.ID
+	return ss.append(rec)
+}
+
+// end closes session id at t and returns it. Use Store.EndSession, which
+// also credits the blocked time.
+func (ss *SessionStore) end(id string, t time.Time) (Session, error) {
+	fl, err := ss.lock()
+	if err != nil {
+		return Session{}, err
+	}
+	defer ss.unlock(fl)
+
+	sessions, err := ss.replay(nil)
+	if err != nil {
+		return Session{}, err
+	}
+	for _, sess := range sessions {
+		if sess.ID != id || !sess.Open() {
+			continue
+		}
+		if t.Before(sess.Start) {
+			t = sess.Start
+		}
+		if err := ss.append(sessionRecord{Kind: "end", Session: id, Time: t}); err != nil {
+			return Session{}, err
+		}
+		sess.End = t
+		return sess, nil
+	}
+	return Session{}, ErrSessionNotOpen
+}
+
+// OpenSessions returns the sessions that have not ended, oldest first.
+func (ss *SessionStore) OpenSessions() ([]Session, error) {
+	key, _, err := ss.key()
+	if err != nil {
+		return nil, err
+	}
+	fl, err := ss.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer ss.unlock(fl)
+
+	sessions, err := ss.replay(key)
+	if err != nil {
+		return nil, err
+	}
+	open := []Session{}
+	for _, sess := range sessions {
+		if sess.Open() {
+			open = append(open, sess)
+		}
+	}
+	return open, nil
+}
+
+// Query returns the sessions that overlap [from, to), oldest first. A zero
+// from or to leaves that side unbounded. Open sessions extend to now.
+func (ss *SessionStore) Query(from, to time.Time) ([]Session, error) {
+	key, _, err := ss.key()
+	if err != nil {
+		return nil, err
+	}
+	fl, err := ss.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer ss.unlock(fl)
+
+	sessions, err := ss.replay(key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := ss.clock.Now()
+	result := []Session{}
+	for _, sess := range sessions {
+		end := sess.End
+		if end.IsZero() {
+			end = now
+		}
+		if !to.IsZero() && !sess.Start.Before(to) {
+			continue
+		}
+		if !from.IsZero() && end.Before(from) {
+			continue
+		}
+		result = append(result, sess)
+	}
+	return result, nil
+}
+
+func (ss *SessionStore) append(rec sessionRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(ss.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replay rebuilds all sessions from the records, ordered by start time.
+// Unreadable lines (e.g. a write cut short by a crash) are skipped. Sealed
+// planned ends are opened with key; without it they stay zero.
+func (ss *SessionStore) replay(key []byte) ([]Session, error) {
+	f, err := os.Open(ss.path)
+	if os.IsNotExist(err) {
+		return []Session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	byID := make(map[string]*Session)
+	var order []*Session
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec sessionRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue
+		}
+
+		if rec.Kind == "start" {
+			if rec.Start == nil || byID[rec.Session] != nil {
+				continue
+			}
+			sess := *rec.Start
+			if rec.SealedEnd != nil && key != nil {
+				sess.PlannedEnd, _ = openTime(key, rec.SealedEnd)
+			}
+			byID[sess.ID] = &sess
+			order = append(order, &sess)
+			continue
+		}
+
+		sess := byID[rec.Session]
+		if sess == nil {
+			continue
+		}
+		switch rec.Kind {
+		case "kill":
+			sess.Kills = append(sess.Kills, SessionKill{App: rec.App, Time: rec.Time})
+		case "unlock":
+			sess.EmergencyUnlocks++
+		case "end":
+			if sess.End.IsZero() {
+				sess.End = rec.Time
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(order))
+	for _, sess := range order {
+		sessions = append(sessions, *sess)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	return sessions, nil
+}
+
+// Sessions returns the session history kept next to the config.
+func (s *Store) Sessions() *SessionStore {
+	return s.sessions
+}
+
+// EndSession closes a session at end and credits its apps with the time
+// they were actually blocked, which is less than planned if the session
+// was stopped early.
+func (s *Store) EndSession(id string, end time.Time) error {
+	_ = s.FlushKills()
+	sess, err := s.sessions.end(id, end)
+	if err != nil {
+		return err
+	}
+	s.UpdateBlockedStats(sess.Apps, int(sess.Duration(end).Seconds()))
+	return nil
+}
@@ -0,0 +1,444 @@
+package storage
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	statsFile = "stats.json"
+
+	// corruptSuffix marks a stats file that could not be read, set aside
+	// when a new one is started.
+	corruptSuffix = ".corrupt"
+)
+
+// Granularity is the bucket size of a stats rollup.
+type Granularity string
+
+const (
+	Hourly Granularity = "hour"
+	Daily  Granularity = "day"
+	Weekly Granularity = "week"
+)
+
+// Stats holds per-app counters. It is used for buckets and for totals.
+type Stats struct {
+	KillCounts       map[string]int   `json:"kill_counts"`     // Processes ended, gracefully or not
+	ClosedCounts     map[string]int   `json:"closed_counts"`   // Of those, closed when asked to
+	SurvivedCounts   map[string]int   `json:"survived_counts"` // Still running after the ladder
+	BlockedFrequency map[string]int   `json:"blocked_frequency"`
+	BlockedDuration  map[string]int64 `json:"blocked_duration"` // Total seconds blocked
+}
+
+func newStats() Stats {
+	return Stats{
+		KillCounts:       make(map[string]int),
+		ClosedCounts:     make(map[string]int),
+		SurvivedCounts:   make(map[string]int),
+		BlockedFrequency: make(map[string]int),
+		BlockedDuration:  make(map[string]int64),
+	}
+}
+
+// add merges other into st. st must have been created by newStats.
+func (st Stats) add(other Stats) {
+	for k, v := range other.KillCounts {
+		st.KillCounts[k] += v
+	}
+	for k, v := range other.ClosedCounts {
+		st.ClosedCounts[k] += v
+	}
+	for k, v := range other.SurvivedCounts {
+		st.SurvivedCounts[k] += v
+	}
+	for k, v := range other.BlockedFrequency {
+		st.BlockedFrequency[k] += v
+	}
+	for k, v := range other.BlockedDuration {
+		st.BlockedDuration[k] += v
+	}
+}
+
+// addEvent counts one raw event into st.
+func (st Stats) addEvent(e StatsEvent) {
+	switch e.Kind {
+	case "kill":
+		// Events from before the ladder have no outcome; they were kills
+		switch e.Outcome {
+		case OutcomeSurvived:
+			st.SurvivedCounts[e.App]++
+		case OutcomeClosed:
+			st.ClosedCounts[e.App]++
+			st.KillCounts[e.App]++
+		default:
+			st.KillCounts[e.App]++
+		}
+	case "blocked":
+		st.BlockedFrequency[e.App]++
+		st.BlockedDuration[e.App] += e.Seconds
+	}
+}
+
+// StatsBucket is the counters for one hour, day or week.
+type StatsBucket struct {
+	Start time.Time `json:"start"`
+	Stats
+}
+
+// StatsEvent is one raw, not yet rolled up, statistic.
+type StatsEvent struct {
+	Time    time.Time   `json:"time"`
+	Kind    string      `json:"kind"` // kill, blocked
+	App     string      `json:"app"`
+	Seconds int64       `json:"seconds,omitempty"` // kind blocked
+	Outcome KillOutcome `json:"outcome,omitempty"` // kind kill
+}
+
+// StatsRetention says how long each resolution is kept before being rolled
+// up into the next coarser one. Weekly buckets past their retention are
+// folded into the all-time baseline, so totals never shrink.
+type StatsRetention struct {
+	RawHours    int `json:"raw_hours"`
+	HourlyDays  int `json:"hourly_days"`
+	DailyDays   int `json:"daily_days"`
+	WeeklyWeeks int `json:"weekly_weeks"` // 0 keeps weekly buckets forever
+}
+
+// DefaultStatsRetention is applied to new configs and to configs migrated
+// from before retention existed.
+func DefaultStatsRetention() StatsRetention {
+	return StatsRetention{RawHours: 48, HourlyDays: 14, DailyDays: 90, WeeklyWeeks: 0}
+}
+
+// statsData is the content of stats.json. Every count lives in exactly one
+// place (baseline, a bucket or a raw event), so summing all of them gives
+// the totals regardless of how far compaction has progressed.
+type statsData struct {
+	LegacyImported bool          `json:"legacy_imported"` // Counters moved out of config.json
+	Baseline       Stats         `json:"baseline"`        // Legacy and expired counts, no timestamps
+	Events         []StatsEvent  `json:"events"`
+	Hourly         []StatsBucket `json:"hourly"`
+	Daily          []StatsBucket `json:"daily"`
+	Weekly         []StatsBucket `json:"weekly"`
+}
+
+// StatsStore keeps usage statistics outside the signed config, so kills and
+// session ends do not rewrite config.json.
+type StatsStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewStatsStore opens the statistics in dir.
+func NewStatsStore(dir string) *StatsStore {
+	return &StatsStore{path: filepath.Join(dir, statsFile)}
+}
+
+// update runs fn on the stats file under the file lock and saves the result.
+func (ss *StatsStore) update(fn func(*statsData)) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	fl, err := acquireFileLock(ss.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	data, err := ss.read()
+	if err != nil {
+		return err
+	}
+	fn(data)
+
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := ss.path + pendingSuffix
+	if err := writeFileSync(tmp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ss.path)
+}
+
+// view runs fn on a consistent copy of the stats file.
+func (ss *StatsStore) view(fn func(*statsData)) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	fl, err := acquireFileLock(ss.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	data, err := ss.read()
+	if err != nil {
+		return err
+	}
+	fn(data)
+	return nil
+}
+
+func (ss *StatsStore) read() (*statsData, error) {
+	data := &statsData{}
+	raw, err := readFileRetry(ss.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, data); err != nil {
+			// Statistics are not security relevant; start over rather
+			// than block kills on a damaged file, but keep it for a look.
+			data = &statsData{}
+			if mvErr := os.Rename(ss.path, ss.path+corruptSuffix); mvErr != nil {
+				log.Printf("stats: %s unreadable (%v) and could not be kept: %v", ss.path, err, mvErr)
+			} else {
+				log.Printf("stats: %s unreadable (%v), kept as %s", ss.path, err, ss.path+corruptSuffix)
+			}
+		}
+	}
+
+	// Buckets written by hand or by older code may lack maps
+	data.Baseline = normalizeStats(data.Baseline)
+	for _, tier := range [][]StatsBucket{data.Hourly, data.Daily, data.Weekly} {
+		for i := range tier {
+			tier[i].Stats = normalizeStats(tier[i].Stats)
+		}
+	}
+	return data, nil
+}
+
+func normalizeStats(st Stats) Stats {
+	n := newStats()
+	n.add(st)
+	return n
+}
+
+// KillRecord is one enforced process, as buffered by Store.IncrementKillCount.
+type KillRecord struct {
+	App     string
+	Outcome KillOutcome
+	Time    time.Time
+}
+
+// RecordKill counts one enforced process and whether it exited.
+func (ss *StatsStore) RecordKill(app string, outcome KillOutcome, t time.Time) error {
+	return ss.RecordKills([]KillRecord{{App: app, Outcome: outcome, Time: t}})
+}
+
+// RecordKills counts a batch of enforced processes in one write.
+func (ss *StatsStore) RecordKills(kills []KillRecord) error {
+	return ss.update(func(d *statsData) {
+		for _, k := range kills {
+			d.Events = append(d.Events, StatsEvent{Time: k.Time, Kind: "kill", App: k.App, Outcome: k.Outcome})
+		}
+	})
+}
+
+// RecordBlocked credits each app with one block of seconds.
+func (ss *StatsStore) RecordBlocked(apps []string, seconds int64, t time.Time) error {
+	return ss.update(func(d *statsData) {
+		for _, app := range apps {
+			d.Events = append(d.Events, StatsEvent{Time: t, Kind: "blocked", App: app, Seconds: seconds})
+		}
+	})
+}
+
+// importLegacy adds the counters that used to live in config.json to the
+// baseline. It only ever runs once, so a failed config save followed by a
+// retry does not count them twice.
+func (ss *StatsStore) importLegacy(legacy Stats) error {
+	return ss.update(func(d *statsData) {
+		if d.LegacyImported {
+			return
+		}
+		d.Baseline.add(legacy)
+		d.LegacyImported = true
+	})
+}
+
+// Totals returns the all-time counters.
+func (ss *StatsStore) Totals() (Stats, error) {
+	totals := newStats()
+	err := ss.view(func(d *statsData) {
+		totals.add(d.Baseline)
+		for _, tier := range [][]StatsBucket{d.Hourly, d.Daily, d.Weekly} {
+			for _, b := range tier {
+				totals.add(b.Stats)
+			}
+		}
+		for _, e := range d.Events {
+			totals.addEvent(e)
+		}
+	})
+	return totals, err
+}
+
+// Rollup returns buckets of size g that start in [from, to), oldest first.
+// Zero bounds are open. Data already compacted to a coarser resolution than
+// g is returned in its own, larger buckets.
+func (ss *StatsStore) Rollup(g Granularity, from, to time.Time) ([]StatsBucket, error) {
+	buckets := make(bucketMap)
+	addTo := func(start time.Time, st Stats) {
+		buckets.get(start).add(st)
+	}
+
+	err := ss.view(func(d *statsData) {
+		for _, e := range d.Events {
+			single := newStats()
+			single.addEvent(e)
+			addTo(bucketStart(g, e.Time), single)
+		}
+		for _, tier := range []struct {
+			g       Granularity
+			buckets []StatsBucket
+		}{{Hourly, d.Hourly}, {Daily, d.Daily}, {Weekly, d.Weekly}} {
+			for _, b := range tier.buckets {
+				if coarser(tier.g, g) {
+					addTo(b.Start, b.Stats)
+				} else {
+					addTo(bucketStart(g, b.Start), b.Stats)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []StatsBucket{}
+	for _, b := range buckets.sorted() {
+		if !from.IsZero() && b.Start.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !b.Start.Before(to) {
+			continue
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+// Compact rolls data past its retention up into the next resolution.
+func (ss *StatsStore) Compact(now time.Time, r StatsRetention) error {
+	return ss.update(func(d *statsData) {
+		// Raw events -> hourly
+		cutoff := now.Add(-time.Duration(r.RawHours) * time.Hour)
+		hourly := bucketIndex(d.Hourly)
+		var keep []StatsEvent
+		for _, e := range d.Events {
+			if !bucketEnd(Hourly, bucketStart(Hourly, e.Time)).After(cutoff) {
+				hourly.get(bucketStart(Hourly, e.Time)).addEvent(e)
+			} else {
+				keep = append(keep, e)
+			}
+		}
+		d.Events = keep
+		d.Hourly = hourly.sorted()
+
+		// Hourly -> daily, daily -> weekly
+		d.Hourly, d.Daily = rollUp(d.Hourly, d.Daily, Daily, now.AddDate(0, 0, -r.HourlyDays))
+		d.Daily, d.Weekly = rollUp(d.Daily, d.Weekly, Weekly, now.AddDate(0, 0, -r.DailyDays))
+
+		// Weekly -> baseline
+		if r.WeeklyWeeks > 0 {
+			cutoff = now.AddDate(0, 0, -7*r.WeeklyWeeks)
+			var kept []StatsBucket
+			for _, b := range d.Weekly {
+				if !bucketEnd(Weekly, b.Start).After(cutoff) {
+					d.Baseline.add(b.Stats)
+				} else {
+					kept = append(kept, b)
+				}
+			}
+			d.Weekly = kept
+		}
+	})
+}
+
+// rollUp moves the fine buckets that ended before cutoff into coarse
+// buckets of granularity g.
+func rollUp(fine, coarse []StatsBucket, g Granularity, cutoff time.Time) ([]StatsBucket, []StatsBucket) {
+	idx := bucketIndex(coarse)
+	var kept []StatsBucket
+	for _, b := range fine {
+		start := bucketStart(g, b.Start)
+		if !bucketEnd(g, start).After(cutoff) {
+			idx.get(start).add(b.Stats)
+		} else {
+			kept = append(kept, b)
+		}
+	}
+	return kept, idx.sorted()
+}
+
+// bucketMap indexes buckets by start time in Unix seconds; time.Time keys
+// would not match across locations.
+type bucketMap map[int64]Stats
+
+func bucketIndex(buckets []StatsBucket) bucketMap {
+	idx := make(bucketMap, len(buckets))
+	for _, b := range buckets {
+		idx.get(b.Start).add(b.Stats)
+	}
+	return idx
+}
+
+func (m bucketMap) get(start time.Time) Stats {
+	st, ok := m[start.Unix()]
+	if !ok {
+		st = newStats()
+		m[start.Unix()] = st
+	}
+	return st
+}
+
+func (m bucketMap) sorted() []StatsBucket {
+	out := make([]StatsBucket, 0, len(m))
+	for start, st := range m {
+		out = append(out, StatsBucket{Start: time.Unix(start, 0), Stats: st})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// bucketStart returns the start of the bucket containing t, in local time.
+// Weeks start on Monday.
+func bucketStart(g Granularity, t time.Time) time.Time {
+	t = t.Local()
+	switch g {
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case Weekly:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		offset := (int(day.Weekday()) + 6) % 7 // Days since Monday
+		return day.AddDate(0, 0, -offset)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	}
+}
+
+func bucketEnd(g Granularity, start time.Time) time.Time {
+	switch g {
+	case Daily:
+		return start.AddDate(0, 0, 1)
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.Add(time.Hour)
+	}
+}
+
+// coarser reports whether a is a larger bucket size than b.
+func coarser(a, b Granularity) bool {
+	rank := map[Granularity]int{Hourly: 0, Daily: 1, Weekly: 2}
+	return rank[a] > rank[b]
+}
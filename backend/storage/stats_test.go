@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"maps"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCompactKeepsBlockedTotals(t *testing.T) {
+	s, err := NewStoreWithBackup(t.TempDir(), NewMemoryBackupStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sunday night into Monday: every bucket size has a boundary at midnight
+	sunday := time.Date(2026, 10, 11, 0, 0, 0, 0, time.Local)
+	events := []struct {
+		app string
+		at  time.Time
+		sec int64
+	}{
+		{"game.exe", sunday.Add(22*time.Hour + 59*time.Minute), 600},
+		{"game.exe", sunday.Add(23*time.Hour + 59*time.Minute), 300},
+		{"chat.exe", sunday.Add(24 * time.Hour), 120}, // Monday 00:00
+		{"game.exe", sunday.Add(24*time.Hour + time.Minute), 60},
+		{"chat.exe", sunday.AddDate(0, 0, 3).Add(12 * time.Hour), 45},
+		{"game.exe", sunday.AddDate(0, 0, 15), 30},
+	}
+	want := map[string]int64{}
+	for _, e := range events {
+		if err := s.Stats().RecordBlocked([]string{e.app}, e.sec, e.at); err != nil {
+			t.Fatal(err)
+		}
+		want[e.app] += e.sec
+	}
+
+	// Compact day by day until everything has gone through every tier and
+	// into the baseline
+	retention := StatsRetention{RawHours: 1, HourlyDays: 1, DailyDays: 7, WeeklyWeeks: 2}
+	for now := sunday; now.Before(sunday.AddDate(0, 0, 60)); now = now.Add(7 * time.Hour) {
+		if err := s.Stats().Compact(now, retention); err != nil {
+			t.Fatal(err)
+		}
+		if got := s.GetBlockedDuration(); !maps.Equal(got, want) {
+			t.Fatalf("after compacting at %s: blocked = %v, want %v", now, got, want)
+		}
+	}
+
+	daily, err := s.Stats().Rollup(Daily, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 0 {
+		t.Fatalf("daily buckets left after the weekly retention: %+v", daily)
+	}
+}
+
+func TestDamagedStatsKeptAside(t *testing.T) {
+	dir := t.TempDir()
+	ss := NewStatsStore(dir)
+	damaged := []byte(`{"events": [{"time": "`)
+	if err := os.WriteFile(ss.path, damaged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.RecordBlocked([]string{"game.exe"}, 60, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	totals, err := ss.Totals()
+	if err != nil || totals.BlockedDuration["game.exe"] != 60 {
+		t.Fatalf("blocked = %v, err = %v, want a fresh start", totals.BlockedDuration, err)
+	}
+	kept, err := os.ReadFile(ss.path + corruptSuffix)
+	if err != nil || string(kept) != string(damaged) {
+		t.Fatalf("damaged file not kept: %q, %v", kept, err)
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const suspendedFile = "suspended.json"
+
+// SuspendedProcess is a process the enforcer froze and has to resume.
+type SuspendedProcess struct {
+	PID       uint32    `json:"pid"`
+	Name      string    `json:"name"`
+	StartTime time.Time `json:"start_time"` // Tells a reused PID apart; zero if unknown
+	Since     time.Time `json:"since"`
+}
+
+// SuspendedStore lists the processes suspended by either enforcer. It is
+// kept on disk so that whichever process notices the session ending can
+// resume them, even if the one that suspended them has exited or crashed.
+type SuspendedStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewSuspendedStore opens the suspended process list in dir.
+func NewSuspendedStore(dir string) *SuspendedStore {
+	return &SuspendedStore{path: filepath.Join(dir, suspendedFile)}
+}
+
+// update runs fn on the list under the file lock and saves the result if
+// fn reports a change.
+func (ss *SuspendedStore) update(fn func([]SuspendedProcess) ([]SuspendedProcess, bool)) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	fl, err := acquireFileLock(ss.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer fl.release()
+
+	procs, err := ss.read()
+	if err != nil {
+		return err
+	}
+	procs, changed := fn(procs)
+	if !changed {
+		return nil
+	}
+	if len(procs) == 0 {
+		if err := os.Remove(ss.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	out, err := json.MarshalIndent(procs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := ss.path + pendingSuffix
+	if err := writeFileSync(tmp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ss.path)
+}
+
+func (ss *SuspendedStore) read() ([]SuspendedProcess, error) {
+	raw, err := readFileRetry(ss.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var procs []SuspendedProcess
+	if err := json.Unmarshal(raw, &procs); err != nil {
+		// The PIDs are lost either way; start over rather than fail
+		// every suspend and resume after.
+		return nil, nil
+	}
+	return procs, nil
+}
+
+// Add records p before it is suspended. It reports false if p is already
+// recorded, i.e. the other enforcer got there first; suspending it again
+// would need a second resume on Windows. A record of an exited process
+// with the same PID is replaced.
+func (ss *SuspendedStore) Add(p SuspendedProcess) (bool, error) {
+	added := false
+	err := ss.update(func(procs []SuspendedProcess) ([]SuspendedProcess, bool) {
+		kept := procs[:0]
+		for _, existing := range procs {
+			if existing.PID != p.PID {
+				kept = append(kept, existing)
+			} else if existing.StartTime.Equal(p.StartTime) {
+				return procs, false
+			}
+		}
+		added = true
+		return append(kept, p), true
+	})
+	return added && err == nil, err
+}
+
+// Remove drops the record of pid, e.g. when suspending it failed.
+func (ss *SuspendedStore) Remove(pid uint32) error {
+	return ss.update(func(procs []SuspendedProcess) ([]SuspendedProcess, bool) {
+		kept := procs[:0]
+		for _, p := range procs {
+			if p.PID != pid {
+				kept = append(kept, p)
+			}
+		}
+		return kept, len(kept) != len(procs)
+	})
+}
+
+// Take returns every record and clears the list, so that a process is
+// resumed by one enforcer only.
+func (ss *SuspendedStore) Take() ([]SuspendedProcess, error) {
+	var taken []SuspendedProcess
+	err := ss.update(func(procs []SuspendedProcess) ([]SuspendedProcess, bool) {
+		taken = procs
+		return nil, len(procs) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return taken, nil
+}
+
+// List returns the suspended processes, oldest first.
+func (ss *SuspendedStore) List() ([]SuspendedProcess, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	fl, err := acquireFileLock(ss.path+lockSuffix, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer fl.release()
+
+	procs, err := ss.read()
+	if procs == nil && err == nil {
+		procs = []SuspendedProcess{}
+	}
+	return procs, err
+}
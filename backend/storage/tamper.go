@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxEmergencyUnlocks is the number of emergency unlocks allowed per session.
+const MaxEmergencyUnlocks = 2
+
+const (
+	tamperLogFile     = "tamper.log"
+	tamperDedupWindow = 10 * time.Minute
+)
+
+// TamperType identifies what kind of interference was detected.
+type TamperType string
+
+const (
+	TamperSignatureMismatch TamperType = "signature_mismatch"  // config.json edited
+	TamperMissingSignature  TamperType = "missing_signature"   // config.json.sig deleted
+	TamperConfigDeleted     TamperType = "config_deleted"      // config.json deleted during a lock
+	TamperRegistryMismatch  TamperType = "registry_mismatch"   // config older than the secondary store
+	TamperHostsBlockRemoved TamperType = "hosts_block_removed" // our hosts section was stripped
+	TamperJournalBroken     TamperType = "journal_broken"      // change journal rewritten
+)
+
+// TamperEvent is one detected incident and the penalty applied for it.
+type TamperEvent struct {
+	Type     TamperType `json:"type"`
+	Time     time.Time  `json:"time"`
+	Evidence string     `json:"evidence"`
+	Penalty  string     `json:"penalty"` // Empty if no penalty applied
+}
+
+// TamperPolicy configures what happens when tampering is detected during an
+// active manual lock.
+type TamperPolicy struct {
+	ExtendLockMinutes      int  `json:"extend_lock_minutes"`      // Added to LockEndTime
+	ConsumeEmergencyUnlock bool `json:"consume_emergency_unlock"` // Burns one emergency unlock
+}
+
+// DefaultTamperPolicy is applied to new configs and to configs migrated
+// from before the policy existed.
+func DefaultTamperPolicy() TamperPolicy {
+	return TamperPolicy{ExtendLockMinutes: 15, ConsumeEmergencyUnlock: false}
+}
+
+// ReportTamper records an incident detected outside the store (for example by
+// the watchdog) and applies the configured penalty.
+func (s *Store) ReportTamper(t TamperType, evidence string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
+
+	if err := s.loadInternal(); err != nil {
+		return err
+	}
+	if !s.recordTamper(t, evidence) {
+		return nil
+	}
+	return s.saveInternal()
+}
+
+// ReportJournalBroken records a broken journal chain found by VerifyJournal.
+// The break is found again on every check, so each one is recorded and
+// penalized once: its first bad entry is kept in the config and matching
+// reports are ignored, however far apart they are.
+func (s *Store) ReportJournalBroken(journalErr error) error {
+	var brk *chainBreak
+	if !errors.As(journalErr, &brk) {
+		return s.ReportTamper(TamperJournalBroken, journalErr.Error())
+	}
+
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.unlock()
+
+	if err := s.loadInternal(); err != nil {
+		return err
+	}
+	if s.Data.JournalBreak == brk.fingerprint() {
+		return nil
+	}
+	s.Data.JournalBreak = brk.fingerprint()
+	s.recordTamper(TamperJournalBroken, journalErr.Error())
+	return s.saveInternal()
+}
+
+// TamperEvents returns all recorded incidents, oldest first.
+func (s *Store) TamperEvents() ([]TamperEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readTamperLog()
+}
+
+func (s *Store) tamperLogPath() string {
+	return filepath.Join(filepath.Dir(s.filePath), tamperLogFile)
+}
+
+// recordTamper logs the incident and applies the penalty to s.Data. It reports
+// whether s.Data was changed; the caller is responsible for saving. An
+// identical incident seen again within tamperDedupWindow (e.g. on every load
+// while the damage cannot be repaired) is not recorded or penalized again.
+func (s *Store) recordTamper(t TamperType, evidence string) bool {
+	now := s.clock.Now()
+	events, _ := s.readTamperLog()
+	for _, e := range events {
+		if e.Type == t && e.Evidence == evidence && now.Sub(e.Time) < tamperDedupWindow {
+			return false
+		}
+	}
+
+	event := TamperEvent{
+		Type:     t,
+		Time:     now,
+		Evidence: evidence,
+		Penalty:  applyTamperPenalty(&s.Data, now),
+	}
+
+	line, err := json.Marshal(event)
+	if err == nil {
+		f, err := os.OpenFile(s.tamperLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Write(append(line, '\n'))
+			f.Close()
+		}
+	}
+
+	return event.Penalty != ""
+}
+
+// applyTamperPenalty applies cfg.TamperPolicy if a manual lock is running and
+// returns a description of what was done.
+func applyTamperPenalty(cfg *Config, now time.Time) string {
+	if cfg.LockEndTime.IsZero() || !now.Before(cfg.LockEndTime) {
+		return ""
+	}
+
+	var applied []string
+	policy := cfg.TamperPolicy
+
+	if policy.ExtendLockMinutes > 0 {
+		extra := time.Duration(policy.ExtendLockMinutes) * time.Minute
+		cfg.LockEndTime = cfg.LockEndTime.Add(extra)
+		cfg.RemainingDuration += extra
+		applied = append(applied, fmt.Sprintf("lock extended by %d min", policy.ExtendLockMinutes))
+	}
+
+	if policy.ConsumeEmergencyUnlock && cfg.EmergencyUnlocksUsed < MaxEmergencyUnlocks {
+		cfg.EmergencyUnlocksUsed++
+		applied = append(applied, "emergency unlock consumed")
+	}
+
+	return strings.Join(applied, ", ")
+}
+
+func (s *Store) readTamperLog() ([]TamperEvent, error) {
+	f, err := os.Open(s.tamperLogPath())
+	if os.IsNotExist(err) {
+		return []TamperEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := []TamperEvent{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e TamperEvent
+		if err := json.Unmarshal(line, &e); err == nil {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// fileEvidence describes a file's current content for a tamper record.
+func fileEvidence(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", filepath.Base(path), err)
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s: %d bytes, sha256 %s", filepath.Base(path), len(data), hex.EncodeToString(sum[:8]))
+}
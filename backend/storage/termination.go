@@ -0,0 +1,43 @@
+package storage
+
+import "time"
+
+// Grace period limits. The cap keeps a blocked app from being granted
+// minutes of use by a long "grace period".
+const (
+	DefaultGraceSeconds = 5
+	MaxGraceSeconds     = 30
+)
+
+// Termination is how the enforcer ends a blocked app: optionally ask it to
+// close (SIGTERM, WM_CLOSE) and wait, then force-kill it.
+type Termination struct {
+	Graceful     bool `json:"graceful"`      // Ask the app to close before killing it
+	GraceSeconds int  `json:"grace_seconds"` // How long to wait for it to exit
+}
+
+// DefaultTermination gives apps a few seconds to save their state.
+func DefaultTermination() Termination {
+	return Termination{Graceful: true, GraceSeconds: DefaultGraceSeconds}
+}
+
+// GracePeriod is how long the app may keep running after it was asked to
+// close, clamped to [0, MaxGraceSeconds]. It is zero for force-kill.
+func (t Termination) GracePeriod() time.Duration {
+	if !t.Graceful || t.GraceSeconds <= 0 {
+		return 0
+	}
+	if t.GraceSeconds > MaxGraceSeconds {
+		return MaxGraceSeconds * time.Second
+	}
+	return time.Duration(t.GraceSeconds) * time.Second
+}
+
+// KillOutcome says whether an enforced process actually exited, and how.
+type KillOutcome string
+
+const (
+	OutcomeClosed   KillOutcome = "closed"   // Exited after being asked to close
+	OutcomeKilled   KillOutcome = "killed"   // Exited after being force-killed
+	OutcomeSurvived KillOutcome = "survived" // Still running after the whole ladder
+)
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind by.
+	// Events that do not fit are dropped for that subscriber; Snapshot is
+	// current either way.
+	subscriberBuffer = 32
+
+	// watchPollInterval is used where no file notification API is available.
+	watchPollInterval = 500 * time.Millisecond
+)
+
+// ChangeEvent is one committed change to the config, either saved through
+// this Store or picked up from disk after the other process saved.
+type ChangeEvent struct {
+	Time    time.Time     `json:"time"`
+	Local   bool          `json:"local"` // Saved by this process
+	Changes []FieldChange `json:"changes"`
+}
+
+// Changed reports whether any of the given top-level JSON fields changed.
+func (e ChangeEvent) Changed(fields ...string) bool {
+	for _, c := range e.Changes {
+		for _, f := range fields {
+			if c.Field == f {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// watchState tracks subscribers and the file watcher feeding them.
+type watchState struct {
+	mu   sync.Mutex
+	subs map[chan ChangeEvent]struct{}
+	stop chan struct{} // Closed to stop the watcher; nil when not running
+}
+
+// Subscribe returns a channel of config changes and a function that ends the
+// subscription. While anyone is subscribed, config.json is watched and
+// reloaded when the other process saves, so Snapshot stays current without
+// polling. Events carry every changed field, including stats.
+func (s *Store) Subscribe() (<-chan ChangeEvent, func()) {
+	s.mu.Lock()
+	if s.lastNotified == nil {
+		s.lastNotified = s.lastCommitted
+	}
+	s.mu.Unlock()
+
+	ch := make(chan ChangeEvent, subscriberBuffer)
+
+	s.watch.mu.Lock()
+	if s.watch.subs == nil {
+		s.watch.subs = make(map[chan ChangeEvent]struct{})
+	}
+	s.watch.subs[ch] = struct{}{}
+	if s.watch.stop == nil {
+		s.watch.stop = make(chan struct{})
+		go watchConfig(s.filePath, s.watch.stop, func() { _ = s.Load() })
+	}
+	s.watch.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.watch.mu.Lock()
+			defer s.watch.mu.Unlock()
+			delete(s.watch.subs, ch)
+			close(ch)
+			if len(s.watch.subs) == 0 && s.watch.stop != nil {
+				close(s.watch.stop)
+				s.watch.stop = nil
+			}
+		})
+	}
+	return ch, cancel
+}
+
+// publish sends the difference between the last published body and data to
+// all subscribers. Called with s.mu held whenever a body is committed.
+func (s *Store) publish(data []byte, local bool) {
+	prev := s.lastNotified
+	s.lastNotified = data
+	if prev == nil {
+		// First body seen: nothing to compare against yet
+		return
+	}
+
+	changes, err := diffConfigs(prev, data, nil)
+	if err != nil || len(changes) == 0 {
+		return
+	}
+	event := ChangeEvent{Time: s.clock.Now(), Local: local, Changes: changes}
+
+	s.watch.mu.Lock()
+	defer s.watch.mu.Unlock()
+	for ch := range s.watch.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// pollConfig calls changed whenever the content of path differs from the
+// last look. Comparing content rather than mtime cannot miss a save that
+// lands within the filesystem's timestamp resolution.
+func pollConfig(path string, stop <-chan struct{}, changed func()) {
+	last := contentHash(path)
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if h := contentHash(path); h != last {
+				last = h
+				changed()
+			}
+		}
+	}
+}
+
+// contentHash returns a digest of the file, or "" if it cannot be read
+// (a deleted config is a change too).
+func contentHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return string(sum[:])
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchConfig calls changed after every inotify event for the config or its
+// signature, falling back to polling if inotify is unavailable.
+//
+// The directory is watched rather than the file: saves replace config.json
+// by rename, which would leave a watch on the old inode.
+func watchConfig(path string, stop <-chan struct{}, changed func()) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		pollConfig(path, stop, changed)
+		return
+	}
+	defer unix.Close(fd)
+
+	mask := uint32(unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO)
+	if _, err := unix.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		pollConfig(path, stop, changed)
+		return
+	}
+
+	name := filepath.Base(path)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		// Wake up regularly to notice stop
+		n, err := unix.Poll(fds, 250)
+		if errors.Is(err, unix.EINTR) || n == 0 {
+			continue
+		}
+		if err != nil {
+			pollConfig(path, stop, changed)
+			return
+		}
+
+		n, err = unix.Read(fd, buf)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			pollConfig(path, stop, changed)
+			return
+		}
+		if inotifyTouches(buf[:n], name) {
+			changed()
+		}
+	}
+}
+
+// inotifyTouches reports whether a batch of raw inotify events concerns the
+// config pair. A queue overflow may have hidden such an event, so it counts.
+func inotifyTouches(buf []byte, name string) bool {
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		mask := binary.NativeEndian.Uint32(buf[off+4:])
+		nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+		start := off + unix.SizeofInotifyEvent
+		if start+nameLen > len(buf) {
+			return true
+		}
+		evName := string(bytes.TrimRight(buf[start:start+nameLen], "\x00"))
+
+		if mask&unix.IN_Q_OVERFLOW != 0 || evName == name || evName == name+sigSuffix {
+			return true
+		}
+		off = start + nameLen
+	}
+	return false
+}
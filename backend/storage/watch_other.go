@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package storage
+
+// watchConfig polls the config's content; see pollConfig.
+func watchConfig(path string, stop <-chan struct{}, changed func()) {
+	pollConfig(path, stop, changed)
+}
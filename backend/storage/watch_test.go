@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// nextEvent waits for one event on ch; ok is false if none came.
+func nextEvent(ch <-chan ChangeEvent, wait time.Duration) (ChangeEvent, bool) {
+	select {
+	case ev, ok := <-ch:
+		return ev, ok
+	case <-time.After(wait):
+		return ChangeEvent{}, false
+	}
+}
+
+// quiet is long enough for the watcher to pick up a save, even by polling.
+const quiet = 3 * watchPollInterval
+
+func TestSubscribersGetEachChangeOnce(t *testing.T) {
+	dir := t.TempDir()
+	backup := NewMemoryBackupStore()
+	s, err := NewStoreWithBackup(dir, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveMarker(t, s, "first"); err != nil {
+		t.Fatal(err)
+	}
+	changes, cancel := s.Subscribe()
+	defer cancel()
+
+	// Saved here
+	if err := saveMarker(t, s, "second"); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := nextEvent(changes, quiet)
+	if !ok || !ev.Local || !ev.Changed("ghost_task_name") {
+		t.Fatalf("event = %+v, %v, want a local ghost_task_name change", ev, ok)
+	}
+	if ev, ok := nextEvent(changes, quiet); ok {
+		t.Fatalf("change published twice: %+v", ev)
+	}
+
+	// Saved by the other process
+	other, err := NewStoreWithBackup(dir, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveMarker(t, other, "third"); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok = nextEvent(changes, 10*quiet)
+	if !ok || ev.Local || !ev.Changed("ghost_task_name") {
+		t.Fatalf("event = %+v, %v, want a ghost_task_name change from disk", ev, ok)
+	}
+	if ev, ok := nextEvent(changes, quiet); ok {
+		t.Fatalf("change published twice: %+v", ev)
+	}
+
+	// Nothing committed, nothing published
+	errRefused := errors.New("refused")
+	if err := s.Update(func(cfg *Config) error {
+		cfg.GhostTaskName = "refused"
+		return errRefused
+	}); !errors.Is(err, errRefused) {
+		t.Fatalf("err = %v, want errRefused", err)
+	}
+	if err := saveMarker(t, s, "third"); err != nil {
+		t.Fatal(err)
+	}
+	if ev, ok := nextEvent(changes, quiet); ok {
+		t.Fatalf("published without a change: %+v", ev)
+	}
+
+	// Unsubscribed: the channel is closed and stays quiet
+	cancel()
+	if err := saveMarker(t, s, "fourth"); err != nil {
+		t.Fatal(err)
+	}
+	if ev, ok := <-changes; ok {
+		t.Fatalf("published after unsubscribing: %+v", ev)
+	}
+}
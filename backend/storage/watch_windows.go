@@ -0,0 +1,127 @@
+//go:build windows
+
+package storage
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// watchConfig calls changed after every ReadDirectoryChangesW notification
+// for the config or its signature, falling back to polling if the
+// directory cannot be watched.
+//
+// The directory is watched rather than the file: saves replace config.json
+// by rename. The read is overlapped so that stop is noticed in between.
+func watchConfig(path string, stop <-chan struct{}, changed func()) {
+	dir, err := windows.UTF16PtrFromString(filepath.Dir(path))
+	if err != nil {
+		pollConfig(path, stop, changed)
+		return
+	}
+	h, err := windows.CreateFile(dir, windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		pollConfig(path, stop, changed)
+		return
+	}
+	defer windows.CloseHandle(h)
+
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		pollConfig(path, stop, changed)
+		return
+	}
+	defer windows.CloseHandle(event)
+
+	const mask = windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_LAST_WRITE | windows.FILE_NOTIFY_CHANGE_SIZE
+	name := filepath.Base(path)
+
+	// The kernel writes to both after the call returns: keep them on the
+	// heap and pinned for as long as a read can be pending.
+	r := new(dirRead)
+	var pin runtime.Pinner
+	pin.Pin(r)
+	defer pin.Unpin()
+	buf, ov := r.buf[:], &r.ov
+
+	for {
+		*ov = windows.Overlapped{HEvent: event}
+		if err := windows.ReadDirectoryChanges(h, &buf[0], uint32(len(buf)), false, mask, nil, ov, 0); err != nil {
+			pollConfig(path, stop, changed)
+			return
+		}
+
+		// Wake up regularly to notice stop
+		for waiting := true; waiting; {
+			ev, err := windows.WaitForSingleObject(event, 250)
+			switch {
+			case err != nil:
+				cancelRead(h, ov)
+				pollConfig(path, stop, changed)
+				return
+			case ev == uint32(windows.WAIT_TIMEOUT):
+				select {
+				case <-stop:
+					cancelRead(h, ov)
+					return
+				default:
+				}
+			default:
+				waiting = false
+			}
+		}
+
+		var n uint32
+		if err := windows.GetOverlappedResult(h, ov, &n, false); err != nil {
+			pollConfig(path, stop, changed)
+			return
+		}
+		if n == 0 || notifyTouches(buf[:n], name) {
+			// No records means the buffer overflowed; a change may be hidden
+			changed()
+		}
+		_ = windows.ResetEvent(event)
+	}
+}
+
+// dirRead is the state of one overlapped ReadDirectoryChangesW call.
+type dirRead struct {
+	ov  windows.Overlapped
+	buf [64 * 1024]byte // DWORD-aligned after ov, as the API requires
+}
+
+// cancelRead stops the pending read and waits for it, so that the kernel
+// is done with the buffer and the OVERLAPPED before they go away.
+func cancelRead(h windows.Handle, ov *windows.Overlapped) {
+	_ = windows.CancelIoEx(h, ov)
+	var n uint32
+	_ = windows.GetOverlappedResult(h, ov, &n, true)
+}
+
+// notifyTouches reports whether a batch of FILE_NOTIFY_INFORMATION records
+// concerns the config pair.
+func notifyTouches(buf []byte, name string) bool {
+	const header = int(unsafe.Offsetof(windows.FileNotifyInformation{}.FileName))
+	for off := 0; off+header <= len(buf); {
+		info := (*windows.FileNotifyInformation)(unsafe.Pointer(&buf[off]))
+		nameLen := int(info.FileNameLength) / 2
+		if off+header+nameLen*2 > len(buf) {
+			return true
+		}
+		evName := windows.UTF16ToString(unsafe.Slice(&info.FileName, nameLen))
+		if strings.EqualFold(evName, name) || strings.EqualFold(evName, name+sigSuffix) {
+			return true
+		}
+		if info.NextEntryOffset == 0 {
+			return false
+		}
+		off += int(info.NextEntryOffset)
+	}
+	return false
+}
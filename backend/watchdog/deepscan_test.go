@@ -0,0 +1,127 @@
+package watchdog
+
+import (
+	"fmt"
+	"focus-lock/backend/storage"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// BenchmarkEnforceDeep measures one deep scan of the processes running on
+// this machine with a name rule that matches none of them, so every
+// process is inspected and its metadata read. "uncached" starts each scan
+// with empty caches, which is what every scan cost before the caches;
+// "cached" is the steady state of the slow loop.
+func BenchmarkEnforceDeep(b *testing.B) {
+	procs := NewSystemProcessProvider()
+	if _, err := procs.List(); err != nil {
+		b.Skip("no process provider on this platform: " + err.Error())
+	}
+	store, err := storage.NewStoreWithBackup(b.TempDir(), storage.NewMemoryBackupStore())
+	if err != nil {
+		b.Fatal(err)
+	}
+	reader := NewSystemMetadataReader()
+	rules := compileRules([]storage.AppRule{storage.NameRule("focus-lock-benchmark-no-match")})
+	term := newTerminator(procs, store, newFileHashes())
+
+	newScan := func() *procCache {
+		return newProcCache(procs, newMetadataCache(reader, time.Now))
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			enforceDeep(procs, newScan(), term, rules, newFileHashes())
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		scan, hashes := newScan(), newFileHashes()
+		enforceDeep(procs, scan, term, rules, hashes) // Warm up
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			enforceDeep(procs, scan, term, rules, hashes)
+		}
+	})
+}
+
+// countingReader is a MetadataReader that counts its reads.
+type countingReader struct {
+	reads int
+}
+
+func (r *countingReader) Read(path string) (FileMetadata, error) {
+	r.reads++
+	return FileMetadata{ProductName: "Example"}, nil
+}
+
+func TestProcCacheRereadsOnNewStartTime(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(exe, []byte("app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	first := time.Unix(1000, 0)
+	fake := NewFakeProcessProvider(Process{PID: 7, Name: "app", Path: exe, StartTime: first})
+	reader := &countingReader{}
+	scan := newProcCache(fake, newMetadataCache(reader, time.Now))
+
+	for i := 0; i < 3; i++ {
+		proc := Process{PID: 7, Name: "app"}
+		if err := scan.inspect(&proc); err != nil {
+			t.Fatal(err)
+		}
+		if meta := scan.metadata(proc); meta.ProductName != "Example" {
+			t.Fatalf("metadata = %+v", meta)
+		}
+	}
+	if reader.reads != 1 {
+		t.Fatalf("reads = %d, want 1", reader.reads)
+	}
+
+	// The PID is reused by another process of the same executable: the
+	// per-PID entry goes, the per-file one stays
+	_ = fake.Terminate(7)
+	fake.Start(Process{PID: 7, Name: "app", Path: exe, StartTime: first.Add(time.Minute)})
+	proc := Process{PID: 7, Name: "app"}
+	if err := scan.inspect(&proc); err != nil {
+		t.Fatal(err)
+	}
+	if !proc.StartTime.Equal(first.Add(time.Minute)) {
+		t.Fatalf("StartTime = %v, want the new process's", proc.StartTime)
+	}
+	scan.metadata(proc)
+	if reader.reads != 1 {
+		t.Fatalf("reads = %d, want 1", reader.reads)
+	}
+}
+
+func TestMetadataCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	reader := &countingReader{}
+	cache := newMetadataCache(reader, time.Now)
+
+	paths := make([]string, maxMetadataEntries+1)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("app%d", i))
+		if err := os.WriteFile(paths[i], []byte("app"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range paths[:maxMetadataEntries] {
+		cache.read(p)
+	}
+	cache.read(paths[0]) // Most recently used now
+	cache.read(paths[maxMetadataEntries])
+
+	reads := reader.reads
+	cache.read(paths[0])
+	if reader.reads != reads {
+		t.Fatal("recently used entry was evicted")
+	}
+	cache.read(paths[1])
+	if reader.reads != reads+1 {
+		t.Fatal("least recently used entry was not evicted")
+	}
+}
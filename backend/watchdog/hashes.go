@@ -0,0 +1,65 @@
+package watchdog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxHashEntries bounds the hash cache. It is cleared when full, which
+// only costs rehashing what is still running.
+const maxHashEntries = 2048
+
+// fileHashes caches SHA-256 sums of executables, keyed by path and
+// invalidated when the file's size or modification time changes.
+type fileHashes struct {
+	mu      sync.Mutex
+	entries map[string]hashEntry
+}
+
+type hashEntry struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+func newFileHashes() *fileHashes {
+	return &fileHashes{entries: make(map[string]hashEntry)}
+}
+
+// sum returns the lower-case hex SHA-256 of the file at path.
+func (h *fileHashes) sum(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	h.mu.Lock()
+	cached, ok := h.entries[path]
+	h.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(digest.Sum(nil))
+
+	h.mu.Lock()
+	if len(h.entries) >= maxHashEntries {
+		h.entries = make(map[string]hashEntry)
+	}
+	h.entries[path] = hashEntry{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	h.mu.Unlock()
+	return sum, nil
+}
@@ -0,0 +1,97 @@
+package watchdog
+
+import (
+	"container/list"
+	"os"
+	"time"
+)
+
+// FileMetadata is what an executable says about itself, matched by name
+// rules in the deep scan.
+type FileMetadata struct {
+	ProductName     string
+	FileDescription string
+}
+
+// MetadataReader extracts FileMetadata from executables: the version
+// resource on Windows, the .desktop entries launching them on Linux. An
+// executable without metadata gives an empty FileMetadata, not an error.
+type MetadataReader interface {
+	Read(path string) (FileMetadata, error)
+}
+
+// NewSystemMetadataReader returns the platform's reader.
+func NewSystemMetadataReader() MetadataReader {
+	return newSystemMetadataReader()
+}
+
+// Bounds of the metadata cache. Entries also expire, since a reader may
+// draw on files other than the executable, e.g. .desktop entries.
+const (
+	maxMetadataEntries = 1024
+	metadataTTL        = 10 * time.Minute
+)
+
+// metadataCache is an LRU cache in front of a MetadataReader, keyed by
+// path and invalidated when the file's size or modification time changes.
+// It is used by the enforcer loop only.
+type metadataCache struct {
+	reader  MetadataReader
+	now     func() time.Time
+	entries map[string]*list.Element
+	lru     *list.List // Most recently used first
+}
+
+type metadataEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	read    time.Time
+	meta    FileMetadata
+}
+
+func newMetadataCache(reader MetadataReader, now func() time.Time) *metadataCache {
+	return &metadataCache{
+		reader:  reader,
+		now:     now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// read returns the metadata of the executable at path.
+func (c *metadataCache) read(path string) (FileMetadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+
+	now := c.now()
+	if el, ok := c.entries[path]; ok {
+		e := el.Value.(*metadataEntry)
+		if e.size == info.Size() && e.modTime.Equal(info.ModTime()) && now.Sub(e.read) < metadataTTL {
+			c.lru.MoveToFront(el)
+			return e.meta, nil
+		}
+		c.lru.Remove(el)
+		delete(c.entries, path)
+	}
+
+	meta, err := c.reader.Read(path)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	c.entries[path] = c.lru.PushFront(&metadataEntry{
+		path:    path,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		read:    now,
+		meta:    meta,
+	})
+	if c.lru.Len() > maxMetadataEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*metadataEntry).path)
+	}
+	return meta, nil
+}
@@ -0,0 +1,196 @@
+//go:build linux
+
+package watchdog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// desktopRescanInterval is how often the application directories are
+// checked for added or removed entries.
+const desktopRescanInterval = time.Minute
+
+// desktopWrappers run another program named later on the Exec line. Their
+// entries say nothing about the wrapper itself, so they are skipped rather
+// than giving every shell or Python process some app's name.
+var desktopWrappers = map[string]bool{
+	"sh": true, "bash": true, "flatpak": true, "snap": true,
+	"python": true, "python3": true, "perl": true, "java": true,
+	"sudo": true, "pkexec": true, "xdg-open": true, "gtk-launch": true,
+}
+
+// desktopMetadataReader takes the metadata of ELF executables, which have
+// no version resource, from the .desktop entries that launch them: Name is
+// the product name, GenericName or else Comment the file description. It
+// is what the user sees in their application menu.
+type desktopMetadataReader struct {
+	dirs []string
+
+	mu      sync.Mutex
+	stamp   string // Modification times of dirs when indexed
+	checked time.Time
+	byPath  map[string]FileMetadata // Resolved executable paths
+	byName  map[string]FileMetadata // Executable names, for Exec lines not on our PATH
+}
+
+func newSystemMetadataReader() MetadataReader {
+	return &desktopMetadataReader{dirs: applicationDirs()}
+}
+
+// applicationDirs returns the XDG application directories, the ones that
+// take precedence first.
+func applicationDirs() []string {
+	var dirs []string
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+	}
+	if dataHome != "" {
+		dirs = append(dirs, filepath.Join(dataHome, "applications"))
+	}
+
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range filepath.SplitList(dataDirs) {
+		if dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "applications"))
+		}
+	}
+	// Missing from XDG_DATA_DIRS when we run as a service
+	return append(dirs, "/var/lib/flatpak/exports/share/applications", "/var/lib/snapd/desktop/applications")
+}
+
+func (r *desktopMetadataReader) Read(path string) (FileMetadata, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if meta, ok := r.byPath[path]; ok {
+		return meta, nil
+	}
+	return r.byName[filepath.Base(path)], nil
+}
+
+// refresh re-reads the entries if an application directory has changed.
+func (r *desktopMetadataReader) refresh() {
+	now := time.Now()
+	if r.byPath != nil && now.Sub(r.checked) < desktopRescanInterval {
+		return
+	}
+	r.checked = now
+
+	var stamp strings.Builder
+	for _, dir := range r.dirs {
+		if info, err := os.Stat(dir); err == nil {
+			fmt.Fprintf(&stamp, "%s:%d;", dir, info.ModTime().UnixNano())
+		}
+	}
+	if r.byPath != nil && stamp.String() == r.stamp {
+		return
+	}
+	r.stamp = stamp.String()
+
+	r.byPath = make(map[string]FileMetadata)
+	r.byName = make(map[string]FileMetadata)
+	for _, dir := range r.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".desktop") {
+				continue
+			}
+			if program, meta, ok := parseDesktopEntry(filepath.Join(dir, e.Name())); ok {
+				r.add(program, meta)
+			}
+		}
+	}
+}
+
+// add indexes meta under the program an entry runs. Earlier entries win,
+// as in XDG lookups.
+func (r *desktopMetadataReader) add(program string, meta FileMetadata) {
+	name := filepath.Base(program)
+	if desktopWrappers[name] {
+		return
+	}
+	if _, ok := r.byName[name]; !ok {
+		r.byName[name] = meta
+	}
+
+	path, err := exec.LookPath(program)
+	if err != nil {
+		return
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if _, ok := r.byPath[path]; !ok {
+		r.byPath[path] = meta
+	}
+}
+
+// parseDesktopEntry reads the program and metadata of an application entry.
+func parseDesktopEntry(path string) (program string, meta FileMetadata, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", FileMetadata{}, false
+	}
+	defer f.Close()
+
+	keys := make(map[string]string)
+	inEntry := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		// Localized keys (Name[de]) contain '[' and are skipped
+		if key, value, found := strings.Cut(line, "="); inEntry && found {
+			keys[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	if t := keys["Type"]; (t != "" && t != "Application") || keys["Hidden"] == "true" {
+		return "", FileMetadata{}, false
+	}
+	program = keys["TryExec"]
+	if program == "" {
+		program = execProgram(keys["Exec"])
+	}
+	meta = FileMetadata{ProductName: keys["Name"], FileDescription: keys["GenericName"]}
+	if meta.FileDescription == "" {
+		meta.FileDescription = keys["Comment"]
+	}
+	return program, meta, program != "" && meta.ProductName != ""
+}
+
+// execProgram returns the program an Exec line runs, skipping an env
+// prefix with its variable assignments.
+func execProgram(line string) string {
+	for i, field := range strings.Fields(line) {
+		field = strings.Trim(field, `"`)
+		if i == 0 && field == "env" || strings.Contains(field, "=") {
+			continue
+		}
+		return field
+	}
+	return ""
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !linux
+
+package watchdog
+
+// noMetadataReader is for platforms whose executables carry no metadata we
+// read, so the deep check only has the name to go on.
+type noMetadataReader struct{}
+
+func newSystemMetadataReader() MetadataReader {
+	return noMetadataReader{}
+}
+
+func (noMetadataReader) Read(path string) (FileMetadata, error) { return FileMetadata{}, nil }
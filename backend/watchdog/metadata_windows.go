@@ -0,0 +1,92 @@
+//go:build windows
+
+package watchdog
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	version                     = windows.NewLazySystemDLL("version.dll")
+	procGetFileVersionInfoSizeW = version.NewProc("GetFileVersionInfoSizeW")
+	procGetFileVersionInfoW     = version.NewProc("GetFileVersionInfoW")
+	procVerQueryValueW          = version.NewProc("VerQueryValueW")
+)
+
+// versionInfoReader reads the version resource of PE executables.
+type versionInfoReader struct{}
+
+func newSystemMetadataReader() MetadataReader {
+	return versionInfoReader{}
+}
+
+// Read returns the Product Name and File Description of the executable at path
+func (versionInfoReader) Read(path string) (FileMetadata, error) {
+	// Get size of version info
+	ptrPath, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+
+	var handle uint32 // This handle is not used by GetFileVersionInfoSizeW, it's an output parameter for GetFileVersionInfo.
+	size, _, _ := procGetFileVersionInfoSizeW.Call(uintptr(unsafe.Pointer(ptrPath)), uintptr(unsafe.Pointer(&handle)))
+	if size == 0 {
+		return FileMetadata{}, nil // No version resource
+	}
+
+	// Allocate buffer
+	data := make([]byte, size)
+	ret, _, _ := procGetFileVersionInfoW.Call(
+		uintptr(unsafe.Pointer(ptrPath)),
+		0,
+		size,
+		uintptr(unsafe.Pointer(&data[0])),
+	)
+	if ret == 0 {
+		return FileMetadata{}, nil
+	}
+
+	// Helper to query string value
+	query := func(key string) string {
+		var transBlock *struct {
+			LangID  uint16
+			CharSet uint16
+		}
+		var transLen uint32
+		subBlockTr, _ := windows.UTF16PtrFromString("\\VarFileInfo\\Translation")
+		// Query language
+		ret, _, _ := procVerQueryValueW.Call(
+			uintptr(unsafe.Pointer(&data[0])),
+			uintptr(unsafe.Pointer(subBlockTr)),
+			uintptr(unsafe.Pointer(&transBlock)),
+			uintptr(unsafe.Pointer(&transLen)),
+		)
+
+		langCodes := []string{"040904b0"} // Default US English
+		if ret != 0 && transLen >= 4 {
+			// Add found language, prioritizing it
+			langCodes = append([]string{fmt.Sprintf("%04x%04x", transBlock.LangID, transBlock.CharSet)}, langCodes...)
+		}
+
+		for _, code := range langCodes {
+			subBlock, _ := windows.UTF16PtrFromString(fmt.Sprintf("\\StringFileInfo\\%s\\%s", code, key))
+			var valPtr uintptr
+			var valLen uint32
+			ret, _, _ = procVerQueryValueW.Call(
+				uintptr(unsafe.Pointer(&data[0])),
+				uintptr(unsafe.Pointer(subBlock)),
+				uintptr(unsafe.Pointer(&valPtr)),
+				uintptr(unsafe.Pointer(&valLen)),
+			)
+			if ret != 0 && valLen > 0 {
+				return windows.UTF16PtrToString((*uint16)(unsafe.Pointer(valPtr)))
+			}
+		}
+		return ""
+	}
+
+	return FileMetadata{ProductName: query("ProductName"), FileDescription: query("FileDescription")}, nil
+}
@@ -0,0 +1,194 @@
+package watchdog
+
+import (
+	"focus-lock/backend/storage"
+	"time"
+)
+
+// Reason says why enforcement is on or off.
+type Reason string
+
+const (
+	ReasonIdle     Reason = "idle"     // No manual lock and no schedule window
+	ReasonManual   Reason = "manual"   // A manual lock is running
+	ReasonSchedule Reason = "schedule" // A schedule window is open (and no manual lock)
+	ReasonPaused   Reason = "paused"   // A session is running but an emergency unlock is in effect
+)
+
+// DesiredState is what the enforcer should be doing at a given moment. It is
+// computed by Evaluate from a config snapshot alone, so the UI, the ghost and
+// the bridge's guards all agree on it.
+type DesiredState struct {
+	Enforce bool   // Kill blocked apps and block sites now
+	Reason  Reason // Why Enforce is what it is
+
+	// SessionActive is true while a manual lock or schedule window is
+	// running, even if paused. Settings guards use it.
+	SessionActive   bool
+	ManualActive    bool
+	ActiveSchedules []storage.Schedule
+
+	// Profiles are those of the running sessions, each once. They are set
+	// while paused as well, so their lists stay protected from edits.
+	Profiles []storage.Profile
+	// Rules and Sites are the effective blocklists of Profiles, VPN entries
+	// included. They are empty unless Enforce is set.
+	Rules []storage.AppRule
+	Sites []string
+	// Exceptions are the processes never ended, whatever rule matches.
+	Exceptions []storage.AppRule
+
+	Paused      bool
+	PausedUntil time.Time // Zero unless Paused
+
+	// LockExpired is set when a manual lock has ended but not been cleared.
+	LockExpired bool
+	// HasWork is false when there is no manual lock and no enabled schedule,
+	// i.e. the ghost has nothing left to wait for.
+	HasWork bool
+
+	// NextTransition is the next time the result can change on its own: a
+	// lock or pause ending, or a schedule window opening or closing. It is
+	// zero if nothing is pending.
+	NextTransition time.Time
+}
+
+// CoversProfile reports whether a running session enforces profile id.
+func (d DesiredState) CoversProfile(id string) bool {
+	for _, p := range d.Profiles {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate decides what should be enforced at now. It has no side effects
+// and does not modify cfg.
+func Evaluate(cfg storage.Config, now time.Time) DesiredState {
+	var d DesiredState
+
+	d.ManualActive = !cfg.LockEndTime.IsZero() && now.Before(cfg.LockEndTime)
+	d.LockExpired = !cfg.LockEndTime.IsZero() && !now.Before(cfg.LockEndTime)
+	d.ActiveSchedules = ActiveSchedules(cfg.Schedules, now)
+	d.SessionActive = d.ManualActive || len(d.ActiveSchedules) > 0
+	d.Paused = !cfg.PausedUntil.IsZero() && now.Before(cfg.PausedUntil)
+	if d.Paused {
+		d.PausedUntil = cfg.PausedUntil
+	}
+
+	d.HasWork = !cfg.LockEndTime.IsZero()
+	for _, s := range cfg.Schedules {
+		if s.Enabled {
+			d.HasWork = true
+			break
+		}
+	}
+
+	d.Profiles = sessionProfiles(cfg, d)
+	d.Exceptions = append([]storage.AppRule(nil), cfg.Exceptions...)
+
+	switch {
+	case !d.SessionActive:
+		d.Reason = ReasonIdle
+	case d.Paused:
+		d.Reason = ReasonPaused
+	case d.ManualActive:
+		d.Reason = ReasonManual
+	default:
+		d.Reason = ReasonSchedule
+	}
+
+	d.Enforce = d.SessionActive && !d.Paused
+	if d.Enforce {
+		d.Rules = blockedRulesFor(d.Profiles)
+		d.Sites = blockedSitesFor(d.Profiles)
+	}
+
+	d.NextTransition = nextTransition(cfg, d, now)
+	return d
+}
+
+// sessionProfiles returns the manual lock's profile and the profile of
+// every active schedule, each once.
+func sessionProfiles(cfg storage.Config, d DesiredState) []storage.Profile {
+	// ResolveProfile may fill in a missing default profile; work on a
+	// private copy so cfg stays untouched.
+	cfg.Profiles = append([]storage.Profile(nil), cfg.Profiles...)
+
+	var ids []string
+	if d.ManualActive {
+		ids = append(ids, cfg.ResolveProfile(cfg.SessionProfileID).ID)
+	}
+	for _, s := range d.ActiveSchedules {
+		ids = append(ids, cfg.ResolveProfile(s.ProfileID).ID)
+	}
+
+	seen := make(map[string]bool)
+	var profiles []storage.Profile
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		profiles = append(profiles, *cfg.Profile(id))
+	}
+	return profiles
+}
+
+// nextTransition returns the earliest future instant at which Evaluate can
+// give a different answer without the config changing.
+func nextTransition(cfg storage.Config, d DesiredState, now time.Time) time.Time {
+	var next time.Time
+	consider := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+
+	if d.ManualActive {
+		consider(cfg.LockEndTime)
+	}
+	if d.Paused {
+		consider(cfg.PausedUntil)
+	}
+
+	// Schedule windows opening or closing within the next week
+	for offset := 0; offset <= 7; offset++ {
+		day := now.AddDate(0, 0, offset)
+		weekday := day.Format("Mon")
+		for _, s := range cfg.Schedules {
+			if !s.Enabled || !containsDay(s.Days, weekday) {
+				continue
+			}
+			if start, ok := clockOn(day, s.StartTime); ok {
+				consider(start)
+			}
+			if end, ok := clockOn(day, s.EndTime); ok {
+				consider(end)
+			}
+		}
+		if !next.IsZero() && next.Before(day) {
+			break
+		}
+	}
+	return next
+}
+
+func containsDay(days []string, day string) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// clockOn returns the "HH:MM" time hhmm on the date of day.
+func clockOn(day time.Time, hhmm string) (time.Time, bool) {
+	t, err := time.ParseInLocation("15:04", hhmm, day.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), true
+}
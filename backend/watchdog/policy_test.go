@@ -0,0 +1,268 @@
+package watchdog
+
+import (
+	"focus-lock/backend/protection"
+	"focus-lock/backend/storage"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	// Wednesday
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	at := func(day int, hhmm string) time.Time {
+		tm, _ := clockOn(now.AddDate(0, 0, day), hhmm)
+		return tm
+	}
+
+	work := storage.Profile{ID: "work", Name: "Work", AppRules: []storage.AppRule{storage.NameRule("discord.exe")}, BlockedSites: []string{"reddit.com"}}
+	study := storage.Profile{ID: "study", Name: "Study", AppRules: []storage.AppRule{storage.NameRule("steam.exe")}, BlockedSites: []string{"youtube.com"}}
+	vpn := storage.Profile{ID: "vpn", Name: "VPN", BlockCommonVPN: true}
+
+	config := func(mod func(*storage.Config)) storage.Config {
+		cfg := storage.Config{
+			Profiles:        []storage.Profile{work, study, vpn},
+			ActiveProfileID: "work",
+		}
+		if mod != nil {
+			mod(&cfg)
+		}
+		return cfg
+	}
+	schedule := func(id, start, end, profile string, days ...string) storage.Schedule {
+		return storage.Schedule{ID: id, Days: days, StartTime: start, EndTime: end, Enabled: true, ProfileID: profile}
+	}
+
+	tests := []struct {
+		name string
+		cfg  storage.Config
+
+		enforce     bool
+		reason      Reason
+		session     bool
+		paused      bool
+		lockExpired bool
+		hasWork     bool
+		profiles    []string
+		apps        []string
+		sites       []string
+		next        time.Time
+	}{
+		{
+			name:   "idle",
+			cfg:    config(nil),
+			reason: ReasonIdle,
+		},
+		{
+			name: "manual lock uses session profile",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now.Add(time.Hour)
+				c.SessionProfileID = "study"
+			}),
+			enforce: true, reason: ReasonManual, session: true, hasWork: true,
+			profiles: []string{"study"}, apps: []string{"steam.exe"}, sites: []string{"youtube.com"},
+			next: now.Add(time.Hour),
+		},
+		{
+			name: "manual lock without profile falls back to active profile",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now.Add(time.Hour)
+				c.SessionProfileID = "deleted"
+			}),
+			enforce: true, reason: ReasonManual, session: true, hasWork: true,
+			profiles: []string{"work"}, apps: []string{"discord.exe"}, sites: []string{"reddit.com"},
+			next: now.Add(time.Hour),
+		},
+		{
+			name: "expired manual lock",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now.Add(-time.Minute)
+			}),
+			reason: ReasonIdle, lockExpired: true, hasWork: true,
+		},
+		{
+			name: "lock ending exactly now is expired",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now
+			}),
+			reason: ReasonIdle, lockExpired: true, hasWork: true,
+		},
+		{
+			name: "paused manual lock keeps profiles but not lists",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now.Add(time.Hour)
+				c.PausedUntil = now.Add(time.Minute)
+			}),
+			reason: ReasonPaused, session: true, paused: true, hasWork: true,
+			profiles: []string{"work"},
+			next:     now.Add(time.Minute),
+		},
+		{
+			name: "pause that has run out",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now.Add(time.Hour)
+				c.PausedUntil = now.Add(-time.Second)
+			}),
+			enforce: true, reason: ReasonManual, session: true, hasWork: true,
+			profiles: []string{"work"}, apps: []string{"discord.exe"}, sites: []string{"reddit.com"},
+			next: now.Add(time.Hour),
+		},
+		{
+			name: "active schedule",
+			cfg: config(func(c *storage.Config) {
+				c.Schedules = []storage.Schedule{schedule("s1", "09:00", "12:00", "study", "Wed")}
+			}),
+			enforce: true, reason: ReasonSchedule, session: true, hasWork: true,
+			profiles: []string{"study"}, apps: []string{"steam.exe"}, sites: []string{"youtube.com"},
+			next: at(0, "12:00"),
+		},
+		{
+			name: "schedule starting now is active",
+			cfg: config(func(c *storage.Config) {
+				c.Schedules = []storage.Schedule{schedule("s1", "10:00", "11:00", "", "Wed")}
+			}),
+			enforce: true, reason: ReasonSchedule, session: true, hasWork: true,
+			profiles: []string{"work"}, apps: []string{"discord.exe"}, sites: []string{"reddit.com"},
+			next: at(0, "11:00"),
+		},
+		{
+			name: "schedule ending now is over",
+			cfg: config(func(c *storage.Config) {
+				c.Schedules = []storage.Schedule{schedule("s1", "08:00", "10:00", "", "Wed")}
+			}),
+			reason: ReasonIdle, hasWork: true,
+			next: at(7, "08:00"),
+		},
+		{
+			name: "disabled schedule",
+			cfg: config(func(c *storage.Config) {
+				s := schedule("s1", "09:00", "12:00", "", "Wed")
+				s.Enabled = false
+				c.Schedules = []storage.Schedule{s}
+			}),
+			reason: ReasonIdle,
+		},
+		{
+			name: "schedule later today",
+			cfg: config(func(c *storage.Config) {
+				c.Schedules = []storage.Schedule{schedule("s1", "14:00", "16:00", "", "Wed")}
+			}),
+			reason: ReasonIdle, hasWork: true,
+			next: at(0, "14:00"),
+		},
+		{
+			name: "schedule on another day",
+			cfg: config(func(c *storage.Config) {
+				c.Schedules = []storage.Schedule{schedule("s1", "09:00", "17:00", "", "Mon")}
+			}),
+			reason: ReasonIdle, hasWork: true,
+			next: at(5, "09:00"),
+		},
+		{
+			name: "manual lock and schedule merge profiles",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now.Add(3 * time.Hour)
+				c.SessionProfileID = "work"
+				c.Schedules = []storage.Schedule{
+					schedule("s1", "09:00", "11:00", "study", "Wed"),
+					schedule("s2", "09:30", "10:30", "work", "Wed"),
+				}
+			}),
+			enforce: true, reason: ReasonManual, session: true, hasWork: true,
+			profiles: []string{"study", "work"},
+			apps:     []string{"discord.exe", "steam.exe"},
+			sites:    []string{"reddit.com", "youtube.com"},
+			next:     at(0, "10:30"),
+		},
+		{
+			name: "VPN blocking adds VPN clients and domains",
+			cfg: config(func(c *storage.Config) {
+				c.LockEndTime = now.Add(time.Hour)
+				c.SessionProfileID = "vpn"
+			}),
+			enforce: true, reason: ReasonManual, session: true, hasWork: true,
+			profiles: []string{"vpn"},
+			apps:     protection.GetVPNExecutables(),
+			sites:    protection.GetVPNDomains(),
+			next:     now.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.cfg.ActiveProfileID
+			got := Evaluate(tt.cfg, now)
+
+			if got.Enforce != tt.enforce {
+				t.Errorf("Enforce = %v, want %v", got.Enforce, tt.enforce)
+			}
+			if got.Reason != tt.reason {
+				t.Errorf("Reason = %q, want %q", got.Reason, tt.reason)
+			}
+			if got.SessionActive != tt.session {
+				t.Errorf("SessionActive = %v, want %v", got.SessionActive, tt.session)
+			}
+			if got.Paused != tt.paused {
+				t.Errorf("Paused = %v, want %v", got.Paused, tt.paused)
+			}
+			if got.LockExpired != tt.lockExpired {
+				t.Errorf("LockExpired = %v, want %v", got.LockExpired, tt.lockExpired)
+			}
+			if got.HasWork != tt.hasWork {
+				t.Errorf("HasWork = %v, want %v", got.HasWork, tt.hasWork)
+			}
+			var ids []string
+			for _, p := range got.Profiles {
+				ids = append(ids, p.ID)
+			}
+			if !sameSet(ids, tt.profiles) {
+				t.Errorf("Profiles = %v, want %v", ids, tt.profiles)
+			}
+			var apps []string
+			for _, r := range got.Rules {
+				apps = append(apps, r.Value)
+			}
+			if !sameSet(apps, tt.apps) {
+				t.Errorf("Rules = %v, want %v", apps, tt.apps)
+			}
+			if !sameSet(got.Sites, tt.sites) {
+				t.Errorf("Sites = %v, want %v", got.Sites, tt.sites)
+			}
+			if !got.NextTransition.Equal(tt.next) {
+				t.Errorf("NextTransition = %v, want %v", got.NextTransition, tt.next)
+			}
+			if tt.cfg.ActiveProfileID != before {
+				t.Errorf("Evaluate modified the config")
+			}
+		})
+	}
+}
+
+func TestEvaluateWithoutProfiles(t *testing.T) {
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	cfg := storage.Config{LockEndTime: now.Add(time.Hour)}
+
+	got := Evaluate(cfg, now)
+	if !got.Enforce || len(got.Profiles) != 1 {
+		t.Fatalf("want enforcement with one fallback profile, got %+v", got)
+	}
+	if cfg.Profiles != nil || cfg.ActiveProfileID != "" {
+		t.Errorf("Evaluate modified the config: %+v", cfg)
+	}
+}
+
+func TestCoversProfile(t *testing.T) {
+	d := DesiredState{Profiles: []storage.Profile{{ID: "work"}}}
+	if !d.CoversProfile("work") || d.CoversProfile("study") {
+		t.Errorf("CoversProfile gave the wrong answer for %v", d.Profiles)
+	}
+}
+
+func sameSet(got, want []string) bool {
+	got = slices.Clone(got)
+	want = slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	return slices.Equal(slices.Compact(got), slices.Compact(want))
+}
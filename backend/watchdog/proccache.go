@@ -0,0 +1,81 @@
+package watchdog
+
+// procCache remembers what the deep scan read about each running process:
+// the fields Inspect fills in and its executable's metadata. An entry holds
+// while the PID's start time stays the same; another start time means the
+// PID now belongs to another process. It is used by the enforcer loop only.
+type procCache struct {
+	procs ProcessProvider
+	files *metadataCache
+	byPID map[uint32]*procEntry
+}
+
+type procEntry struct {
+	proc Process       // As inspected
+	meta *FileMetadata // Nil until read
+}
+
+func newProcCache(procs ProcessProvider, files *metadataCache) *procCache {
+	return &procCache{
+		procs: procs,
+		files: files,
+		byPID: make(map[uint32]*procEntry),
+	}
+}
+
+// inspect is ProcessProvider.Inspect, answered from the cache while proc is
+// the process that was inspected. Providers that list start times (Linux)
+// make a hit free; the others need one StartTime call.
+func (c *procCache) inspect(proc *Process) error {
+	start := proc.StartTime
+	if start.IsZero() {
+		var err error
+		if start, err = c.procs.StartTime(proc.PID); err != nil {
+			delete(c.byPID, proc.PID)
+			return err // Gone, or not ours to read
+		}
+	}
+	if e := c.byPID[proc.PID]; e != nil && !start.IsZero() && e.proc.StartTime.Equal(start) {
+		proc.PPID, proc.Path, proc.Cmdline, proc.StartTime = e.proc.PPID, e.proc.Path, e.proc.Cmdline, e.proc.StartTime
+		return nil
+	}
+
+	delete(c.byPID, proc.PID)
+	if err := c.procs.Inspect(proc); err != nil {
+		return err
+	}
+	if !proc.StartTime.IsZero() {
+		c.byPID[proc.PID] = &procEntry{proc: *proc}
+	}
+	return nil
+}
+
+// metadata returns the metadata of proc's executable. proc must have been
+// inspected. Unreadable metadata is empty.
+func (c *procCache) metadata(proc Process) FileMetadata {
+	e := c.byPID[proc.PID]
+	if e != nil && e.meta != nil && e.proc.StartTime.Equal(proc.StartTime) {
+		return *e.meta
+	}
+	meta, err := c.files.read(proc.Path)
+	if err != nil {
+		return FileMetadata{}
+	}
+	if e != nil {
+		e.meta = &meta
+	}
+	return meta
+}
+
+// retain drops the entries of processes missing from a snapshot.
+func (c *procCache) retain(processes []Process) {
+	running := make(map[uint32]bool, len(processes))
+	for _, p := range processes {
+		running[p.PID] = true
+	}
+	for pid := range c.byPID {
+		if !running[pid] {
+			delete(c.byPID, pid)
+		}
+	}
+}
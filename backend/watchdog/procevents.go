@@ -0,0 +1,28 @@
+package watchdog
+
+import "time"
+
+// ProcessStart is a process that has just started (exec'd on Linux).
+type ProcessStart struct {
+	PID  uint32
+	Time time.Time
+}
+
+// ProcessEventSource reports process starts as they happen, so a blocked app
+// can be matched right away instead of on the next snapshot. The enforcer
+// still sweeps with snapshots, because events can be dropped.
+type ProcessEventSource interface {
+	// Start subscribes to process starts. The channel is closed when the
+	// source fails or is closed; the enforcer then falls back to polling.
+	Start() (<-chan ProcessStart, error)
+	// Close stops the subscription.
+	Close() error
+}
+
+// NewSystemProcessEventSource returns the platform's event source: the
+// netlink process connector on Linux. Elsewhere, Windows included, Start
+// fails with ErrUnsupportedPlatform and the enforcer polls (see
+// unsupportedEventSource).
+func NewSystemProcessEventSource() ProcessEventSource {
+	return newSystemProcessEventSource()
+}
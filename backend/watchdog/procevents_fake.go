@@ -0,0 +1,46 @@
+package watchdog
+
+import "sync"
+
+// FakeProcessEventSource delivers the starts passed to Emit. Meant for tests.
+type FakeProcessEventSource struct {
+	mu     sync.Mutex
+	ch     chan ProcessStart
+	closed bool
+
+	// StartErr, if set, is returned by Start.
+	StartErr error
+}
+
+var _ ProcessEventSource = (*FakeProcessEventSource)(nil)
+
+func NewFakeProcessEventSource() *FakeProcessEventSource {
+	return &FakeProcessEventSource{ch: make(chan ProcessStart, 64)}
+}
+
+func (f *FakeProcessEventSource) Start() (<-chan ProcessStart, error) {
+	if f.StartErr != nil {
+		return nil, f.StartErr
+	}
+	return f.ch, nil
+}
+
+// Emit reports a process start. It is dropped after Close.
+func (f *FakeProcessEventSource) Emit(ev ProcessStart) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.ch <- ev
+	}
+}
+
+// Close closes the channel, as a failing source would.
+func (f *FakeProcessEventSource) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.ch)
+	}
+	return nil
+}
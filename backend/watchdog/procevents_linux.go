@@ -0,0 +1,168 @@
+//go:build linux
+
+package watchdog
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Process connector constants from linux/connector.h and linux/cn_proc.h.
+const (
+	cnIdxProc         = 0x1
+	cnValProc         = 0x1
+	procCnMcastListen = 1
+	procEventExec     = 0x00000002
+
+	nlmsgHdrLen = 16 // struct nlmsghdr
+	cnMsgLen    = 20 // struct cn_msg without data
+	procEvHdr   = 16 // what, cpu, timestamp_ns of struct proc_event
+)
+
+// netlinkEventSource listens to the kernel's process connector. It needs
+// CAP_NET_ADMIN, which the ghost has when it runs as root.
+type netlinkEventSource struct {
+	mu   sync.Mutex
+	fd   int
+	done chan struct{}
+}
+
+func newSystemProcessEventSource() ProcessEventSource {
+	return &netlinkEventSource{fd: -1}
+}
+
+func (n *netlinkEventSource) Start() (<-chan ProcessStart, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fd >= 0 {
+		return nil, errors.New("process event source already started")
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	// Wake up periodically so Close does not wait for the next event
+	tv := unix.NsecToTimeval(int64(500 * time.Millisecond))
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	if err := unix.Sendto(fd, listenMessage(), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	n.fd = fd
+	n.done = make(chan struct{})
+	out := make(chan ProcessStart, 256)
+	go n.read(fd, n.done, out)
+	return out, nil
+}
+
+func (n *netlinkEventSource) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fd < 0 {
+		return nil
+	}
+	close(n.done)
+	n.fd = -1
+	return nil
+}
+
+// read delivers exec events until Close. The socket is closed here, after
+// the last receive, so the descriptor is never reused under us.
+func (n *netlinkEventSource) read(fd int, done chan struct{}, out chan<- ProcessStart) {
+	defer close(out)
+	defer unix.Close(fd)
+
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		size, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			switch {
+			case errors.Is(err, unix.EAGAIN), errors.Is(err, unix.EINTR):
+				continue
+			case errors.Is(err, unix.ENOBUFS):
+				// Events were dropped; the periodic sweep catches them
+				continue
+			default:
+				debugLog("Process events failed: " + err.Error())
+				return
+			}
+		}
+
+		for _, ev := range parseProcEvents(buf[:size]) {
+			select {
+			case out <- ev:
+			default:
+				// Enforcer is behind; the periodic sweep catches it
+			}
+		}
+	}
+}
+
+// listenMessage is the netlink message subscribing to process events.
+func listenMessage() []byte {
+	msg := make([]byte, nlmsgHdrLen+cnMsgLen+4)
+	ne := binary.NativeEndian
+	ne.PutUint32(msg[0:], uint32(len(msg)))
+	ne.PutUint16(msg[4:], unix.NLMSG_DONE)
+	ne.PutUint32(msg[12:], uint32(unix.Getpid()))
+
+	cn := msg[nlmsgHdrLen:]
+	ne.PutUint32(cn[0:], cnIdxProc)
+	ne.PutUint32(cn[4:], cnValProc)
+	ne.PutUint16(cn[16:], 4)
+	ne.PutUint32(cn[cnMsgLen:], procCnMcastListen)
+	return msg
+}
+
+// parseProcEvents extracts exec events from one netlink datagram.
+func parseProcEvents(buf []byte) []ProcessStart {
+	ne := binary.NativeEndian
+	var events []ProcessStart
+	for len(buf) >= nlmsgHdrLen {
+		msgLen := int(ne.Uint32(buf[0:]))
+		if msgLen < nlmsgHdrLen || msgLen > len(buf) {
+			break
+		}
+		data := buf[nlmsgHdrLen:msgLen]
+
+		// cn_msg, then struct proc_event
+		if len(data) >= cnMsgLen+procEvHdr+8 {
+			ev := data[cnMsgLen:]
+			if ne.Uint32(ev[0:]) == procEventExec {
+				pid := ne.Uint32(ev[procEvHdr:])
+				tgid := ne.Uint32(ev[procEvHdr+4:])
+				// Only the thread group leader; other threads share its image
+				if pid == tgid {
+					events = append(events, ProcessStart{PID: tgid, Time: time.Now()})
+				}
+			}
+		}
+
+		// Messages are 4-byte aligned
+		next := (msgLen + 3) &^ 3
+		if next > len(buf) {
+			break
+		}
+		buf = buf[next:]
+	}
+	return events
+}
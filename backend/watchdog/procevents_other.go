@@ -0,0 +1,24 @@
+//go:build !linux
+
+package watchdog
+
+// unsupportedEventSource is used where there is no process start event
+// source, which includes Windows. Its only sources are a WMI subscription
+// (Win32_ProcessStartTrace, a COM dependency) and an ETW real-time session
+// on the kernel process provider, which needs a trace session that outlives
+// a crash and a callback running inside the critical ghost. Neither is done:
+// Windows relies on the fast loop's snapshots instead, so a blocked app is
+// matched up to pollInterval after it starts rather than right away.
+type unsupportedEventSource struct{}
+
+func newSystemProcessEventSource() ProcessEventSource {
+	return unsupportedEventSource{}
+}
+
+func (unsupportedEventSource) Start() (<-chan ProcessStart, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+func (unsupportedEventSource) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package watchdog
+
+import (
+	"errors"
+	"time"
+)
+
+// Process is one running process as seen by a ProcessProvider.
+type Process struct {
+	PID       uint32
+	PPID      uint32
+	Name      string    // Executable file name, e.g. "discord.exe"
+	Path      string    // Full executable path; empty if not readable
+	Cmdline   string    // Full command line; empty if not readable
+	StartTime time.Time // Zero if unknown
+}
+
+// ProcessProvider lists and terminates processes. The enforcer talks to the
+// OS only through it, so it runs wherever a backend exists and can be driven
+// by FakeProcessProvider in tests.
+type ProcessProvider interface {
+	// List returns the running processes. PID, PPID and Name are always set.
+	// Backends that need a query per process for the other fields leave
+	// them to Inspect, so the fast loop stays cheap.
+	List() ([]Process, error)
+	// Inspect fills in Path, Cmdline and StartTime of p where they can be
+	// read, and PPID if it is zero.
+	Inspect(p *Process) error
+	// StartTime returns when the process started, which tells it apart
+	// from a later process with the same PID. It is cheaper than Inspect.
+	StartTime(pid uint32) (time.Time, error)
+	// RequestClose asks the process to exit on its own (SIGTERM, WM_CLOSE)
+	// and returns without waiting. ErrCannotRequestClose means there is no
+	// polite way to reach it, e.g. a Windows process without a window.
+	RequestClose(pid uint32) error
+	// Terminate kills the process immediately.
+	Terminate(pid uint32) error
+	// Suspend stops every thread of the process (SIGSTOP,
+	// NtSuspendProcess) until Resume is called for it. On Windows the two
+	// nest, so each Suspend needs exactly one Resume.
+	Suspend(pid uint32) error
+	// Resume continues a process stopped by Suspend.
+	Resume(pid uint32) error
+	// Alive reports whether the process still exists. Zombies count as
+	// exited. Termination is asynchronous, so callers poll it afterwards.
+	Alive(pid uint32) bool
+}
+
+// ErrUnsupportedPlatform is returned by the system provider on platforms
+// without a backend.
+var ErrUnsupportedPlatform = errors.New("process enumeration is not supported on this platform")
+
+// ErrCannotRequestClose is returned by RequestClose for processes that can
+// only be killed.
+var ErrCannotRequestClose = errors.New("process cannot be asked to close")
+
+// NewSystemProcessProvider returns the platform's provider: Toolhelp,
+// TerminateProcess and NtSuspendProcess on Windows, /proc and signals on
+// Linux.
+func NewSystemProcessProvider() ProcessProvider {
+	return newSystemProcessProvider()
+}
@@ -0,0 +1,181 @@
+package watchdog
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoSuchProcess is returned by FakeProcessProvider for unknown PIDs.
+var ErrNoSuchProcess = errors.New("no such process")
+
+// FakeProcessProvider is an in-memory process table. Meant for tests.
+type FakeProcessProvider struct {
+	mu     sync.Mutex
+	procs  []Process
+	killed []uint32
+	asked  []uint32
+
+	suspended map[uint32]int // Suspend count per PID
+	resumes   map[uint32]int // Resume calls per PID
+
+	// ListErr, if set, is returned by List.
+	ListErr error
+	// ClosesOnRequest makes processes exit when asked to close. Otherwise
+	// they ignore the request and have to be killed.
+	ClosesOnRequest bool
+}
+
+var _ ProcessProvider = (*FakeProcessProvider)(nil)
+
+// NewFakeProcessProvider returns a table of procs. It keeps a copy, so the
+// caller's slice is left alone when processes exit.
+func NewFakeProcessProvider(procs ...Process) *FakeProcessProvider {
+	return &FakeProcessProvider{procs: append([]Process(nil), procs...)}
+}
+
+// Start adds a process to the table.
+func (f *FakeProcessProvider) Start(p Process) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.procs = append(f.procs, p)
+}
+
+// Killed returns the PIDs terminated so far, in order.
+func (f *FakeProcessProvider) Killed() []uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]uint32(nil), f.killed...)
+}
+
+// CloseRequested returns the PIDs asked to close so far, in order.
+func (f *FakeProcessProvider) CloseRequested() []uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]uint32(nil), f.asked...)
+}
+
+// Suspended reports whether pid is suspended, i.e. has had more Suspend
+// than Resume calls.
+func (f *FakeProcessProvider) Suspended(pid uint32) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.suspended[pid] > 0
+}
+
+// Resumes returns how often pid was resumed.
+func (f *FakeProcessProvider) Resumes(pid uint32) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resumes[pid]
+}
+
+func (f *FakeProcessProvider) List() ([]Process, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ListErr != nil {
+		return nil, f.ListErr
+	}
+	// Like a real snapshot, List only carries the cheap fields
+	out := make([]Process, len(f.procs))
+	for i, p := range f.procs {
+		out[i] = Process{PID: p.PID, PPID: p.PPID, Name: p.Name}
+	}
+	return out, nil
+}
+
+func (f *FakeProcessProvider) Inspect(p *Process) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, known := range f.procs {
+		if known.PID == p.PID {
+			p.Path, p.Cmdline, p.StartTime = known.Path, known.Cmdline, known.StartTime
+			if p.PPID == 0 {
+				p.PPID = known.PPID
+			}
+			return nil
+		}
+	}
+	return ErrNoSuchProcess
+}
+
+func (f *FakeProcessProvider) StartTime(pid uint32) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.index(pid)
+	if i < 0 {
+		return time.Time{}, ErrNoSuchProcess
+	}
+	return f.procs[i].StartTime, nil
+}
+
+func (f *FakeProcessProvider) RequestClose(pid uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.index(pid)
+	if i < 0 {
+		return ErrNoSuchProcess
+	}
+	f.asked = append(f.asked, pid)
+	if f.ClosesOnRequest {
+		f.procs = append(f.procs[:i], f.procs[i+1:]...)
+	}
+	return nil
+}
+
+func (f *FakeProcessProvider) Terminate(pid uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.index(pid)
+	if i < 0 {
+		return ErrNoSuchProcess
+	}
+	f.procs = append(f.procs[:i], f.procs[i+1:]...)
+	f.killed = append(f.killed, pid)
+	return nil
+}
+
+func (f *FakeProcessProvider) Suspend(pid uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.index(pid) < 0 {
+		return ErrNoSuchProcess
+	}
+	if f.suspended == nil {
+		f.suspended = make(map[uint32]int)
+	}
+	f.suspended[pid]++
+	return nil
+}
+
+func (f *FakeProcessProvider) Resume(pid uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.index(pid) < 0 {
+		return ErrNoSuchProcess
+	}
+	if f.resumes == nil {
+		f.resumes = make(map[uint32]int)
+	}
+	f.resumes[pid]++
+	if f.suspended[pid] > 0 {
+		f.suspended[pid]--
+	}
+	return nil
+}
+
+func (f *FakeProcessProvider) Alive(pid uint32) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.index(pid) >= 0
+}
+
+// index returns the position of pid in the table, or -1. f.mu must be held.
+func (f *FakeProcessProvider) index(pid uint32) int {
+	for i, p := range f.procs {
+		if p.PID == pid {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,181 @@
+//go:build linux
+
+package watchdog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// clockTicks is USER_HZ, the unit of start times in /proc/<pid>/stat. It is
+// 100 on every architecture Linux supports for userspace.
+const clockTicks = 100
+
+// procProcessProvider reads /proc and terminates with signals.
+type procProcessProvider struct {
+	root string // "/proc", or a fixture directory
+
+	bootOnce sync.Once
+	bootTime time.Time
+}
+
+func newSystemProcessProvider() ProcessProvider {
+	return &procProcessProvider{root: "/proc"}
+}
+
+// List reads every /proc/<pid>. Everything but the command line comes from
+// stat and the exe link, which are cheap enough for the fast loop.
+func (p *procProcessProvider) List() ([]Process, error) {
+	entries, err := os.ReadDir(p.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []Process
+	for _, e := range entries {
+		pid, err := strconv.ParseUint(e.Name(), 10, 32)
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		proc, err := p.readStat(uint32(pid))
+		if err != nil {
+			continue // Exited while we were listing
+		}
+		if path := p.exePath(proc.PID); path != "" {
+			proc.Path = path
+			proc.Name = filepath.Base(path)
+		}
+		procs = append(procs, proc)
+	}
+	return procs, nil
+}
+
+func (p *procProcessProvider) Inspect(proc *Process) error {
+	if proc.Path == "" {
+		proc.Path = p.exePath(proc.PID)
+	}
+	if proc.StartTime.IsZero() || proc.PPID == 0 {
+		if stat, err := p.readStat(proc.PID); err == nil {
+			proc.StartTime = stat.StartTime
+			proc.PPID = stat.PPID
+		}
+	}
+
+	raw, err := os.ReadFile(filepath.Join(p.root, strconv.Itoa(int(proc.PID)), "cmdline"))
+	if err != nil {
+		return err
+	}
+	proc.Cmdline = strings.TrimSpace(string(bytes.ReplaceAll(raw, []byte{0}, []byte{' '})))
+	return nil
+}
+
+func (p *procProcessProvider) StartTime(pid uint32) (time.Time, error) {
+	stat, err := p.readStat(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return stat.StartTime, nil
+}
+
+func (p *procProcessProvider) RequestClose(pid uint32) error {
+	return unix.Kill(int(pid), unix.SIGTERM)
+}
+
+func (p *procProcessProvider) Terminate(pid uint32) error {
+	return unix.Kill(int(pid), unix.SIGKILL)
+}
+
+func (p *procProcessProvider) Suspend(pid uint32) error {
+	return unix.Kill(int(pid), unix.SIGSTOP)
+}
+
+func (p *procProcessProvider) Resume(pid uint32) error {
+	return unix.Kill(int(pid), unix.SIGCONT)
+}
+
+// Alive checks the state field of /proc/<pid>/stat. A killed process stays
+// a zombie until its parent reaps it, but it no longer runs.
+func (p *procProcessProvider) Alive(pid uint32) bool {
+	raw, err := os.ReadFile(filepath.Join(p.root, strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return false
+	}
+	closing := bytes.LastIndexByte(raw, ')')
+	if closing < 0 {
+		return false
+	}
+	fields := strings.Fields(string(raw[closing+1:]))
+	return len(fields) > 0 && fields[0] != "Z" && fields[0] != "X"
+}
+
+// readStat parses /proc/<pid>/stat for the name, parent and start time.
+func (p *procProcessProvider) readStat(pid uint32) (Process, error) {
+	raw, err := os.ReadFile(filepath.Join(p.root, strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return Process{}, err
+	}
+
+	// The name is in parentheses and may itself contain spaces or ')'
+	open := bytes.IndexByte(raw, '(')
+	closing := bytes.LastIndexByte(raw, ')')
+	if open < 0 || closing < open {
+		return Process{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	// Fields after the name start at field 3 (state)
+	fields := strings.Fields(string(raw[closing+1:]))
+	if len(fields) < 20 {
+		return Process{}, fmt.Errorf("short stat for pid %d", pid)
+	}
+
+	proc := Process{PID: pid, Name: string(raw[open+1 : closing])}
+	if ppid, err := strconv.ParseUint(fields[1], 10, 32); err == nil {
+		proc.PPID = uint32(ppid)
+	}
+	if ticks, err := strconv.ParseInt(fields[19], 10, 64); err == nil {
+		if boot := p.boot(); !boot.IsZero() {
+			proc.StartTime = boot.Add(time.Duration(ticks) * time.Second / clockTicks)
+		}
+	}
+	return proc, nil
+}
+
+// exePath resolves /proc/<pid>/exe. It is empty for kernel threads and for
+// other users' processes when we are not root.
+func (p *procProcessProvider) exePath(pid uint32) string {
+	path, err := os.Readlink(filepath.Join(p.root, strconv.Itoa(int(pid)), "exe"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(path, " (deleted)")
+}
+
+// boot returns the system boot time from the btime line of /proc/stat.
+func (p *procProcessProvider) boot() time.Time {
+	p.bootOnce.Do(func() {
+		f, err := os.Open(filepath.Join(p.root, "stat"))
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if secs, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+				if n, err := strconv.ParseInt(strings.TrimSpace(secs), 10, 64); err == nil {
+					p.bootTime = time.Unix(n, 0)
+				}
+				return
+			}
+		}
+	})
+	return p.bootTime
+}
@@ -0,0 +1,25 @@
+//go:build !windows && !linux
+
+package watchdog
+
+import "time"
+
+// unsupportedProcessProvider fails every call, so the enforcer idles
+// instead of refusing to build.
+type unsupportedProcessProvider struct{}
+
+func newSystemProcessProvider() ProcessProvider {
+	return unsupportedProcessProvider{}
+}
+
+func (unsupportedProcessProvider) List() ([]Process, error)      { return nil, ErrUnsupportedPlatform }
+func (unsupportedProcessProvider) Inspect(p *Process) error      { return ErrUnsupportedPlatform }
+func (unsupportedProcessProvider) RequestClose(pid uint32) error { return ErrUnsupportedPlatform }
+func (unsupportedProcessProvider) Terminate(pid uint32) error    { return ErrUnsupportedPlatform }
+func (unsupportedProcessProvider) Suspend(pid uint32) error      { return ErrUnsupportedPlatform }
+func (unsupportedProcessProvider) Resume(pid uint32) error       { return ErrUnsupportedPlatform }
+func (unsupportedProcessProvider) Alive(pid uint32) bool         { return false }
+
+func (unsupportedProcessProvider) StartTime(pid uint32) (time.Time, error) {
+	return time.Time{}, ErrUnsupportedPlatform
+}
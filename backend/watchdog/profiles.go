@@ -0,0 +1,82 @@
+package watchdog
+
+import (
+	"focus-lock/backend/protection"
+	"focus-lock/backend/storage"
+	"sort"
+	"strings"
+)
+
+// profileKey identifies a set of profiles, to notice when it changes.
+func profileKey(profiles []storage.Profile) string {
+	ids := make([]string, len(profiles))
+	for i, p := range profiles {
+		ids[i] = p.ID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// blockedRulesFor merges the app rules of profiles, adding name rules for
+// the VPN clients if any of them blocks VPNs. Each rule carries its action,
+// its profile's if it has none. Where profiles share a rule, the first
+// one's settings win.
+func blockedRulesFor(profiles []storage.Profile) []storage.AppRule {
+	var rules []storage.AppRule
+	var vpn *storage.Profile
+	for i := range profiles {
+		p := &profiles[i]
+		for _, r := range p.AppRules {
+			r.Action = p.RuleAction(r)
+			rules = append(rules, r)
+		}
+		if vpn == nil && p.BlockCommonVPN {
+			vpn = p
+		}
+	}
+	if vpn != nil {
+		for _, exe := range protection.GetVPNExecutables() {
+			r := storage.NameRule(exe)
+			r.Action = vpn.EffectiveAction()
+			rules = append(rules, r)
+		}
+	}
+
+	seen := make(map[string]bool)
+	out := []storage.AppRule{}
+	for _, r := range rules {
+		if !seen[r.Key()] {
+			seen[r.Key()] = true
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// blockedSitesFor merges the site lists of profiles, adding the VPN
+// provider domains if any of them blocks VPNs.
+func blockedSitesFor(profiles []storage.Profile) []string {
+	var sites []string
+	vpn := false
+	for _, p := range profiles {
+		sites = append(sites, p.BlockedSites...)
+		vpn = vpn || p.BlockCommonVPN
+	}
+	if vpn {
+		sites = append(sites, protection.GetVPNDomains()...)
+	}
+	return dedupe(sites)
+}
+
+func dedupe(items []string) []string {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, item := range items {
+		key := strings.ToLower(item)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, item)
+		}
+	}
+	return out
+}
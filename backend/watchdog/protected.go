@@ -0,0 +1,68 @@
+package watchdog
+
+import (
+	"focus-lock/backend/storage"
+	"os"
+	"strings"
+)
+
+// allowlist is the processes that are never ended, whatever rule matches:
+// the OS shell and core processes, Focus Lock itself (the UI and the
+// ghost) and the user's exceptions.
+type allowlist struct {
+	selfPID    uint32
+	selfPaths  map[string]bool // Lower-case paths of our executables
+	selfHash   string          // The ghost is a copy of the UI executable
+	exceptions *ruleSet
+}
+
+// newAllowlist protects this process, its executable and the ghost's, and
+// the processes matched by exceptions.
+func newAllowlist(ghostExePath string, exceptions []storage.AppRule, hashes *fileHashes) *allowlist {
+	a := &allowlist{
+		selfPID:    uint32(os.Getpid()),
+		selfPaths:  make(map[string]bool),
+		exceptions: compileRules(exceptions),
+	}
+	if exe, err := os.Executable(); err == nil {
+		a.selfPaths[strings.ToLower(exe)] = true
+		if sum, err := hashes.sum(exe); err == nil {
+			a.selfHash = sum
+		}
+	}
+	if ghostExePath != "" {
+		a.selfPaths[strings.ToLower(ghostExePath)] = true
+	}
+	return a
+}
+
+// protects returns why proc must be left alone, or "" if it may be ended.
+// Path-based checks are skipped when proc has no path.
+func (a *allowlist) protects(proc Process, hashes *fileHashes) string {
+	switch {
+	case proc.PID == a.selfPID:
+		return "Focus Lock itself"
+	case proc.PID <= 4:
+		return "system process" // Idle, System, init
+	case protectedNames[strings.ToLower(proc.Name)] && inSystemDir(proc.Path):
+		// A name alone is not enough: a blocked app could be renamed to
+		// one, and hide its path to pass
+		return "protected system process"
+	}
+
+	if proc.Path != "" {
+		if a.selfPaths[strings.ToLower(proc.Path)] {
+			return "Focus Lock executable"
+		}
+		if a.selfHash != "" {
+			if sum, err := hashes.sum(proc.Path); err == nil && sum == a.selfHash {
+				return "copy of the Focus Lock executable"
+			}
+		}
+	}
+
+	if m := a.exceptions.match(proc, hashes); m != nil {
+		return "exception: " + m.String()
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package watchdog
+
+import "strings"
+
+// protectedNames are init, the session and display servers and the common
+// desktop shells. Killing them ends the user's session. They are only
+// protected when they run from a system directory (see inSystemDir).
+var protectedNames = map[string]bool{
+	"systemd":              true,
+	"init":                 true,
+	"dbus-daemon":          true,
+	"dbus-broker":          true,
+	"systemd-logind":       true,
+	"xorg":                 true,
+	"xwayland":             true,
+	"gdm":                  true,
+	"gdm3":                 true,
+	"sddm":                 true,
+	"lightdm":              true,
+	"gnome-shell":          true,
+	"gnome-session":        true,
+	"plasmashell":          true,
+	"kwin_x11":             true,
+	"kwin_wayland":         true,
+	"xfce4-session":        true,
+	"xfwm4":                true,
+	"cinnamon":             true,
+	"mutter":               true,
+	"pipewire":             true,
+	"pulseaudio":           true,
+	"polkitd":              true,
+	"networkmanager":       true,
+	"gnome-session-binary": true,
+	"gnome-session-b":      true, // Truncated to 15 bytes in /proc/<pid>/stat
+}
+
+// systemDirs hold the executables of the protected processes. Only root
+// can write to them.
+var systemDirs = []string{"/usr/bin/", "/usr/sbin/", "/usr/lib/", "/usr/lib64/", "/usr/libexec/", "/bin/", "/sbin/", "/lib/", "/lib64/"}
+
+// inSystemDir reports whether path is under one of the systemDirs, as
+// /usr/lib/systemd/systemd is.
+func inSystemDir(path string) bool {
+	for _, dir := range systemDirs {
+		if strings.HasPrefix(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantinable reports whether the executable of proc, ended for m, may
+// be quarantined: only one a rule matched itself, and never a system file.
+// Processes ended for their launcher or for what they relaunch can be
+// anything, a shell or a service host included.
+func quarantinable(proc Process, m *ruleMatch) bool {
+	return proc.Path != "" && m.direct() && !inSystemDir(proc.Path)
+}
@@ -0,0 +1,76 @@
+//go:build !windows
+
+package watchdog
+
+import (
+	"focus-lock/backend/clock"
+	"focus-lock/backend/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtectedNameNeedsSystemPath(t *testing.T) {
+	hashes := newFileHashes()
+	allow := newAllowlist("", nil, hashes)
+	tests := []struct {
+		path      string
+		protected bool
+	}{
+		{"/usr/bin/gnome-shell", true},
+		{"", false}, // Path not readable: the name alone proves nothing
+		{"/home/user/.local/bin/gnome-shell", false},
+		{"/tmp/usr/bin/gnome-shell", false},
+	}
+	for _, tt := range tests {
+		proc := Process{PID: 4242, Name: "gnome-shell", Path: tt.path}
+		if got := allow.protects(proc, hashes) != ""; got != tt.protected {
+			t.Errorf("%q: protected = %v, want %v", tt.path, got, tt.protected)
+		}
+	}
+}
+
+func TestQuarantineOnlyDirectMatches(t *testing.T) {
+	rule := &appRule{}
+	direct := &ruleMatch{rule: rule, field: "path", value: "/opt/game/game"}
+	tests := []struct {
+		name string
+		proc Process
+		m    *ruleMatch
+		want bool
+	}{
+		{"direct match", Process{Path: "/opt/game/game"}, direct, true},
+		{"launched by a match", Process{Path: "/opt/game/helper"}, launcherMatch(direct, Process{Name: "game"}), false},
+		{"relaunches a match", Process{Path: "/usr/local/bin/updater"}, &ruleMatch{rule: rule, field: fieldRelaunched}, false},
+		{"system file", Process{Path: "/usr/bin/bash"}, direct, false},
+		{"path unknown", Process{}, direct, false},
+	}
+	for _, tt := range tests {
+		if got := quarantinable(tt.proc, tt.m); got != tt.want {
+			t.Errorf("%s: quarantinable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSystemFilesNeverQuarantined(t *testing.T) {
+	store, dir := testStore(t, clock.NewFake(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)))
+	if err := store.UpdateAtomic(func(cfg *storage.Config) { cfg.RelaunchPolicy.Quarantine = true }); err != nil {
+		t.Fatal(err)
+	}
+	term := newTerminator(NewFakeProcessProvider(), store, newFileHashes())
+	m := &ruleMatch{rule: &appRule{}, field: "path"}
+
+	// Paths that do not exist, so that nothing is lost if this fails: a
+	// rename would be tried, fail and be logged
+	for _, path := range []string{"/usr/bin/focus-lock-test", "/usr/lib/focus-lock/test", "/sbin/focus-lock-test"} {
+		term.escalate(Process{PID: 4242, Name: "focus-lock-test", Path: path}, m, stageQuarantine)
+	}
+	if files, err := store.Quarantine().List(); err != nil || len(files) != 0 {
+		t.Fatalf("quarantined = %+v, %v", files, err)
+	}
+	if log, _ := os.ReadFile(filepath.Join(dir, "debug.log")); strings.Contains(string(log), "quarantine") {
+		t.Fatalf("tried to quarantine a system file:\n%s", log)
+	}
+}
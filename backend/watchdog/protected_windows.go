@@ -0,0 +1,85 @@
+//go:build windows
+
+package watchdog
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+// protectedNames are the shell and the processes Windows cannot run
+// without. Killing most of them logs the user out or bugchecks. They are
+// only protected when they run from a system directory (see inSystemDir).
+var protectedNames = map[string]bool{
+	"system":            true,
+	"registry":          true,
+	"smss.exe":          true,
+	"csrss.exe":         true,
+	"wininit.exe":       true,
+	"winlogon.exe":      true,
+	"services.exe":      true,
+	"lsass.exe":         true,
+	"svchost.exe":       true,
+	"dwm.exe":           true,
+	"fontdrvhost.exe":   true,
+	"explorer.exe":      true,
+	"sihost.exe":        true,
+	"ctfmon.exe":        true,
+	"conhost.exe":       true,
+	"dllhost.exe":       true,
+	"runtimebroker.exe": true,
+	"logonui.exe":       true,
+	"userinit.exe":      true,
+	"taskhostw.exe":     true,
+	"audiodg.exe":       true,
+	"spoolsv.exe":       true,
+}
+
+// systemDirs are the Windows directory, System32 and SysWOW64, asked from
+// the system rather than read from %SystemRoot%, which the user can set.
+var systemDirs = sync.OnceValue(func() []string {
+	var dirs []string
+	if dir, err := windows.GetSystemWindowsDirectory(); err == nil {
+		dirs = append(dirs, dir, filepath.Join(dir, "SysWOW64"))
+	}
+	if dir, err := windows.GetSystemDirectory(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+})
+
+// underSystemDir reports whether path is anywhere inside the Windows
+// directory, which holds nothing that may be renamed.
+func underSystemDir(path string) bool {
+	for _, dir := range systemDirs() {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// inSystemDir reports whether path is an executable directly in one of the
+// systemDirs. Subdirectories do not count: some of them, such as
+// System32\spool\drivers\color, are writable by users.
+func inSystemDir(path string) bool {
+	dir := filepath.Dir(path)
+	for _, sys := range systemDirs() {
+		if strings.EqualFold(dir, filepath.Clean(sys)) {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantinable reports whether the executable of proc, ended for m, may
+// be quarantined: only one a rule matched itself, and nothing under the
+// Windows directory, protected or not. Processes ended for their launcher
+// or for what they relaunch can be anything, a shell or a service host
+// included.
+func quarantinable(proc Process, m *ruleMatch) bool {
+	return proc.Path != "" && m.direct() && !underSystemDir(proc.Path)
+}
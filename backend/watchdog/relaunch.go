@@ -0,0 +1,204 @@
+package watchdog
+
+import (
+	"fmt"
+	"focus-lock/backend/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Relaunch loop detection. An app killed relaunchLoopKills times within
+// relaunchWindow is being restarted by something (an updater, a launcher,
+// a service), and killing it once more does not help.
+const (
+	relaunchWindow    = time.Minute
+	relaunchLoopKills = 5
+)
+
+// quarantineSuffix is appended to the name of a quarantined executable.
+const quarantineSuffix = ".focuslock-quarantine"
+
+// Escalation stages of a relaunch loop. Each stage is reached after
+// another relaunchLoopKills kills.
+const (
+	stageWarn       = 1 // Warn the user and, if the policy says so, end the parent
+	stageQuarantine = 2 // Quarantine the executable, if the policy says so
+)
+
+// relaunchTracker counts kills per executable to spot relaunch loops. It
+// is used by the enforcer loop only.
+type relaunchTracker struct {
+	byExe map[string]*relaunchState
+}
+
+type relaunchState struct {
+	kills []time.Time // Within relaunchWindow, oldest first
+	stage int         // Escalation reached; 0 while not looping
+	since int         // Kills since the last escalation
+}
+
+func newRelaunchTracker() *relaunchTracker {
+	return &relaunchTracker{byExe: make(map[string]*relaunchState)}
+}
+
+// relaunchKey identifies an executable: by path where known, since
+// respawned copies share it, else by name.
+func relaunchKey(proc Process) string {
+	if proc.Path != "" {
+		return strings.ToLower(proc.Path)
+	}
+	return strings.ToLower(proc.Name)
+}
+
+// note counts a kill of proc at now. It reports whether the executable is
+// in a relaunch loop, and the stage to escalate to now, if any.
+func (r *relaunchTracker) note(proc Process, now time.Time) (looping bool, escalate int) {
+	key := relaunchKey(proc)
+	s := r.byExe[key]
+	if s == nil {
+		s = &relaunchState{}
+		r.byExe[key] = s
+	}
+
+	kept := s.kills[:0]
+	for _, t := range s.kills {
+		if now.Sub(t) < relaunchWindow {
+			kept = append(kept, t)
+		}
+	}
+	s.kills = append(kept, now)
+	if len(s.kills) == 1 {
+		s.stage, s.since = 0, 0 // Quiet for a whole window: the loop is over
+	}
+	if len(s.kills) < relaunchLoopKills && s.stage == 0 {
+		return false, 0
+	}
+
+	s.since++
+	if s.stage == 0 || s.since >= relaunchLoopKills {
+		s.stage++
+		s.since = 0
+		return true, s.stage
+	}
+	return true, 0
+}
+
+// prune drops executables not killed within the last window.
+func (r *relaunchTracker) prune(now time.Time) {
+	for key, s := range r.byExe {
+		if len(s.kills) == 0 || now.Sub(s.kills[len(s.kills)-1]) >= relaunchWindow {
+			delete(r.byExe, key)
+		}
+	}
+}
+
+// escalate acts on a relaunch loop of proc, which m matched, as far as the
+// relaunch policy allows.
+func (t *terminator) escalate(proc Process, m *ruleMatch, stage int) {
+	policy := t.store.Snapshot().RelaunchPolicy
+	switch stage {
+	case stageWarn:
+		msg := fmt.Sprintf("%s keeps being relaunched: ended %d times within %s", proc.Name, relaunchLoopKills, relaunchWindow)
+		if policy.EndParent {
+			if parent := t.endParent(proc, m); parent != "" {
+				msg += "; ending " + parent + ", which relaunches it"
+			}
+		}
+		t.warn(proc, msg)
+	case stageQuarantine:
+		if !policy.Quarantine || !quarantinable(proc, m) {
+			return
+		}
+		if err := t.quarantine(proc.Path); err != nil {
+			debugLog(fmt.Sprintf("Cannot quarantine %s: %s", proc.Path, err.Error()))
+			return
+		}
+		t.warn(proc, fmt.Sprintf("%s is still being relaunched: %s is quarantined until the session ends", proc.Name, proc.Path))
+	}
+}
+
+// endParent ends the process that launched proc, unless it is protected.
+// It returns the parent's description, or "" if it was left alone.
+func (t *terminator) endParent(proc Process, m *ruleMatch) string {
+	if proc.PPID == 0 {
+		return ""
+	}
+	parent := Process{PID: proc.PPID}
+	if err := t.procs.Inspect(&parent); err != nil || parent.Path == "" || !launchedBy(proc, parent) {
+		return ""
+	}
+	parent.Name = filepath.Base(parent.Path)
+	if t.allow != nil && t.allow.protects(parent, t.hashes) != "" {
+		debugLog(fmt.Sprintf("Not ending %s [PID: %d], which relaunches %s: protected", parent.Name, parent.PID, proc.Name))
+		return ""
+	}
+	t.end(parent, &ruleMatch{
+		rule:  m.rule,
+		field: fieldRelaunched,
+		value: fmt.Sprintf("%s [PID: %d] (%s %q)", proc.Name, proc.PID, m.field, m.value),
+	})
+	return fmt.Sprintf("%s [PID: %d]", parent.Name, parent.PID)
+}
+
+// quarantine renames the executable at path so that it cannot be started.
+// It is recorded first, so that it is put back even if this process dies.
+func (t *terminator) quarantine(path string) error {
+	added, err := t.store.Quarantine().Add(storage.QuarantinedFile{
+		Path:    path,
+		MovedTo: path + quarantineSuffix,
+		Since:   t.clk.Now(),
+	})
+	if err != nil || !added {
+		return err // Not added: the other enforcer has quarantined it
+	}
+	if err := os.Rename(path, path+quarantineSuffix); err != nil {
+		_ = t.store.Quarantine().Remove(path)
+		return err
+	}
+	return nil
+}
+
+// releaseQuarantine puts back every quarantined executable. Those that
+// cannot be moved yet are kept for the next try.
+func (t *terminator) releaseQuarantine() {
+	files, err := t.store.Quarantine().Take()
+	if err != nil {
+		debugLog("Cannot read quarantined files: " + err.Error())
+		return
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.Path); err == nil {
+			// Reinstalled meanwhile; keep the new file, leave ours
+			debugLog(fmt.Sprintf("Not restoring %s: the path is taken, the old file stays at %s", f.Path, f.MovedTo))
+			continue
+		}
+		if err := os.Rename(f.MovedTo, f.Path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			debugLog(fmt.Sprintf("Restoring %s failed: %s", f.Path, err.Error()))
+			_, _ = t.store.Quarantine().Add(f)
+			continue
+		}
+		debugLog("Restored " + f.Path)
+	}
+}
+
+// warn tells the user about something the enforcer cannot fix by killing.
+func (t *terminator) warn(proc Process, msg string) {
+	debugLog("WARNING: " + msg)
+	err := t.store.Audit().Record(storage.AuditEntry{
+		Time:      t.clk.Now(),
+		Action:    storage.ActionWarn,
+		App:       proc.Name,
+		PID:       proc.PID,
+		StartTime: proc.StartTime,
+		Path:      proc.Path,
+		Reason:    msg,
+	})
+	if err != nil {
+		debugLog("Audit log write failed: " + err.Error())
+	}
+}
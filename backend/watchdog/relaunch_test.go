@@ -0,0 +1,229 @@
+package watchdog
+
+import (
+	"fmt"
+	"focus-lock/backend/clock"
+	"focus-lock/backend/storage"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRelaunchTrackerNote(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	game := Process{Name: "game", Path: "/opt/game/game"}
+	type noted struct {
+		looping bool
+		stage   int
+	}
+
+	r := newRelaunchTracker()
+	now := start
+	kill := func(proc Process, gap time.Duration) noted {
+		now = now.Add(gap)
+		looping, stage := r.note(proc, now)
+		return noted{looping, stage}
+	}
+
+	// A kill every 15s keeps four in the window: no loop
+	for i := 0; i < 10; i++ {
+		if got := kill(game, 15*time.Second); got != (noted{}) {
+			t.Fatalf("kill %d every 15s: %+v, want no loop", i+1, got)
+		}
+	}
+
+	// A kill every second: the fifth in the window starts the loop, and
+	// every fifth after it escalates once more
+	r = newRelaunchTracker()
+	var got []noted
+	for i := 0; i < 10; i++ {
+		got = append(got, kill(game, time.Second))
+	}
+	want := []noted{{}, {}, {}, {}, {true, stageWarn}, {true, 0}, {true, 0}, {true, 0}, {true, 0}, {true, stageQuarantine}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("kills every second = %+v, want %+v", got, want)
+	}
+
+	// Other executables are counted apart
+	if got := kill(Process{Name: "chat", Path: "/opt/chat/chat"}, time.Second); got != (noted{}) {
+		t.Fatalf("first kill of another app: %+v", got)
+	}
+
+	// A quiet window ends the loop
+	if got := kill(game, relaunchWindow); got != (noted{}) {
+		t.Fatalf("kill after a quiet window: %+v, want the loop over", got)
+	}
+	r.prune(now.Add(relaunchWindow))
+	if len(r.byExe) != 0 {
+		t.Fatalf("pruned tracker still holds %v", r.byExe)
+	}
+}
+
+func TestRelaunchEscalation(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	rule := &appRule{AppRule: storage.AppRule{Type: storage.RuleName, Value: "game", Termination: &storage.Termination{}}}
+
+	tests := []struct {
+		policy      storage.RelaunchPolicy
+		parentEnded bool
+		quarantined bool
+		warnings    int
+	}{
+		{storage.RelaunchPolicy{}, false, false, 1},
+		{storage.RelaunchPolicy{EndParent: true}, true, false, 1},
+		{storage.RelaunchPolicy{Quarantine: true}, false, true, 2},
+		{storage.RelaunchPolicy{EndParent: true, Quarantine: true}, true, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%+v", tt.policy), func(t *testing.T) {
+			clk := clock.NewFake(start)
+			store, _ := testStore(t, clk)
+			if err := store.UpdateAtomic(func(cfg *storage.Config) { cfg.RelaunchPolicy = tt.policy }); err != nil {
+				t.Fatal(err)
+			}
+			bin := t.TempDir()
+			game := writeExe(t, bin, "game", "game image")
+			updater := writeExe(t, bin, "updater", "updater image")
+			fake := NewFakeProcessProvider(Process{PID: 10, Name: "updater", Path: updater, StartTime: start})
+			term := newTerminator(fake, store, newFileHashes())
+			term.setAllowlist(newAllowlist("", nil, term.hashes))
+
+			// The updater respawns the game every second
+			var warnings []string
+			for pid := uint32(100); pid < 100+2*relaunchLoopKills; pid++ {
+				clk.Advance(time.Second)
+				proc := Process{PID: pid, PPID: 10, Name: "game", Path: game, StartTime: clk.Now()}
+				fake.Start(proc)
+				term.end(proc, &ruleMatch{rule: rule, field: "name", value: "game"})
+				settle(t, term)
+
+				entries, err := store.Audit().Entries(time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				warnings = warnings[:0]
+				for _, e := range entries {
+					if e.Action == storage.ActionWarn {
+						warnings = append(warnings, e.Reason)
+					}
+				}
+				// The first warning comes with the fifth kill
+				if pid == 100+relaunchLoopKills-2 && len(warnings) != 0 {
+					t.Fatalf("warned after %d kills: %q", pid-99, warnings)
+				}
+				if pid == 100+relaunchLoopKills-1 && len(warnings) != 1 {
+					t.Fatalf("warnings after %d kills = %q, want one", pid-99, warnings)
+				}
+			}
+
+			if ended := slices.Contains(fake.Killed(), 10); ended != tt.parentEnded {
+				t.Errorf("updater ended = %v, want %v", ended, tt.parentEnded)
+			}
+			_, err := os.Stat(game)
+			if moved := os.IsNotExist(err); moved != tt.quarantined {
+				t.Errorf("game moved away = %v, want %v", moved, tt.quarantined)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("warnings = %q, want %d", warnings, tt.warnings)
+			}
+
+			// The session ending puts it back
+			term.resumeAll()
+			if _, err := os.Stat(game); err != nil {
+				t.Fatalf("game not restored: %v", err)
+			}
+			if files, err := store.Quarantine().List(); err != nil || len(files) != 0 {
+				t.Fatalf("still quarantined: %+v, %v", files, err)
+			}
+		})
+	}
+}
+
+func TestQuarantineRestore(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	store, _ := testStore(t, clk)
+	term := newTerminator(NewFakeProcessProvider(), store, newFileHashes())
+	bin := t.TempDir()
+	game := writeExe(t, bin, "game", "game image")
+	chat := writeExe(t, bin, "chat", "chat image")
+	missing := filepath.Join(bin, "missing")
+
+	for _, path := range []string{game, chat} {
+		if err := term.quarantine(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Quarantined already, e.g. by the other enforcer
+	if err := term.quarantine(game); err != nil {
+		t.Fatalf("second quarantine: %v", err)
+	}
+	// Nothing to rename: not recorded either
+	if err := term.quarantine(missing); err == nil {
+		t.Fatal("quarantined a missing file")
+	}
+	files, err := store.Quarantine().List()
+	if err != nil || len(files) != 2 || !files[0].Since.Equal(start) {
+		t.Fatalf("quarantined = %+v, %v, want game and chat", files, err)
+	}
+	for _, path := range []string{game, chat} {
+		if _, err := os.Stat(path + quarantineSuffix); err != nil {
+			t.Fatalf("%s not moved: %v", path, err)
+		}
+	}
+
+	// chat was reinstalled meanwhile: the new one stays
+	writeExe(t, bin, "chat", "new chat image")
+	term.releaseQuarantine()
+
+	if data, err := os.ReadFile(game); err != nil || string(data) != "game image" {
+		t.Errorf("game = %q, %v, want it restored", data, err)
+	}
+	if data, err := os.ReadFile(chat); err != nil || string(data) != "new chat image" {
+		t.Errorf("chat = %q, %v, want the reinstalled one", data, err)
+	}
+	if _, err := os.Stat(chat + quarantineSuffix); err != nil {
+		t.Errorf("quarantined chat removed: %v", err)
+	}
+	if files, err := store.Quarantine().List(); err != nil || len(files) != 0 {
+		t.Errorf("still recorded: %+v, %v", files, err)
+	}
+}
+
+func TestProtectedNeverQuarantined(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	store, _ := testStore(t, clk)
+	if err := store.UpdateAtomic(func(cfg *storage.Config) {
+		cfg.RelaunchPolicy = storage.RelaunchPolicy{EndParent: true, Quarantine: true}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	tool := writeExe(t, bin, "tool", "tool image")
+	fake := NewFakeProcessProvider()
+	term := newTerminator(fake, store, newFileHashes())
+	exception := storage.AppRule{Type: storage.RulePathGlob, Value: tool}
+	term.setAllowlist(newAllowlist("", []storage.AppRule{exception}, term.hashes))
+	rule := &appRule{AppRule: storage.AppRule{Type: storage.RuleName, Value: "tool", Termination: &storage.Termination{}}}
+
+	// An excepted app that a rule matches, relaunched every second
+	for pid := uint32(100); pid < 100+3*relaunchLoopKills; pid++ {
+		clk.Advance(time.Second)
+		proc := Process{PID: pid, Name: "tool", Path: tool, StartTime: clk.Now()}
+		fake.Start(proc)
+		term.end(proc, &ruleMatch{rule: rule, field: "name", value: "tool"})
+		settle(t, term)
+	}
+	if got := fake.Killed(); len(got) != 0 {
+		t.Fatalf("killed protected processes %v", got)
+	}
+	if _, err := os.Stat(tool); err != nil {
+		t.Fatalf("protected executable moved: %v", err)
+	}
+	if files, err := store.Quarantine().List(); err != nil || len(files) != 0 {
+		t.Fatalf("quarantined = %+v, %v", files, err)
+	}
+}
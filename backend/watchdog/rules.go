@@ -0,0 +1,224 @@
+package watchdog
+
+import (
+	"fmt"
+	"focus-lock/backend/storage"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// appRule is a storage.AppRule prepared for matching.
+type appRule struct {
+	storage.AppRule
+	glob string         // Lower-case pattern of a glob rule
+	re   *regexp.Regexp // Compiled regex rule
+}
+
+// ruleMatch is why a process matched: the rule, and which field of the
+// process matched it with what value. Every kill decision logs it.
+type ruleMatch struct {
+	rule  *appRule
+	field string // name, path, image name, sha256, product name, file description
+	value string
+}
+
+// Fields of matches that were not made by the process itself but by the
+// one that launched it or that it relaunches.
+const (
+	fieldLauncher   = "launcher"   // See launcherMatch
+	fieldRelaunched = "relaunched" // See terminator.endParent
+)
+
+// direct reports whether the process itself matched the rule, rather than
+// being ended for what launched it or what it relaunches.
+func (m *ruleMatch) direct() bool {
+	return m.field != fieldLauncher && m.field != fieldRelaunched
+}
+
+func (m *ruleMatch) String() string {
+	return fmt.Sprintf("%s rule %q matched %s %q", m.rule.Type, m.rule.Value, m.field, m.value)
+}
+
+// ruleSet is a list of app rules, indexed so that the fast loop only pays
+// for what it can check cheaply. It holds both blocklists and exceptions.
+type ruleSet struct {
+	names  map[string]*appRule // Lower-case exe names, with and without .exe
+	paths  []*appRule          // Glob and regex rules
+	hashes map[string]*appRule // Lower-case hex SHA-256
+	named  []*appRule          // Name rules, for the deep metadata check
+
+	// launchers is set if a rule also covers what its matches launch, so
+	// new processes' ancestors have to be checked.
+	launchers bool
+}
+
+// compileRules indexes rules. Rules that do not compile are logged and
+// skipped; Store.Update refuses them, so only configs written by older
+// builds can have any.
+func compileRules(rules []storage.AppRule) *ruleSet {
+	rs := &ruleSet{
+		names:  make(map[string]*appRule),
+		hashes: make(map[string]*appRule),
+	}
+	for _, r := range rules {
+		rule := &appRule{AppRule: r}
+		if r.EffectiveScope() != storage.ScopeProcess {
+			rs.launchers = true
+		}
+		switch r.Type {
+		case storage.RuleName:
+			name := strings.ToLower(r.Value)
+			rs.names[name] = rule
+			if !strings.HasSuffix(name, ".exe") {
+				rs.names[name+".exe"] = rule
+			}
+			rs.named = append(rs.named, rule)
+		case storage.RulePathGlob:
+			rule.glob = strings.ToLower(r.Value)
+			if _, err := filepath.Match(rule.glob, ""); err != nil {
+				debugLog("Skipping app rule: " + err.Error())
+				continue
+			}
+			rs.paths = append(rs.paths, rule)
+		case storage.RulePathRegex:
+			re, err := r.Regexp()
+			if err != nil {
+				debugLog("Skipping app rule: " + err.Error())
+				continue
+			}
+			rule.re = re
+			rs.paths = append(rs.paths, rule)
+		case storage.RuleSHA256:
+			rs.hashes[strings.ToLower(r.Value)] = rule
+		default:
+			debugLog("Skipping app rule of unknown type " + string(r.Type))
+		}
+	}
+	return rs
+}
+
+func (rs *ruleSet) empty() bool {
+	return len(rs.names) == 0 && len(rs.paths) == 0 && len(rs.hashes) == 0
+}
+
+// matchName checks the name rules against an executable name.
+func (rs *ruleSet) matchName(field, name string) *ruleMatch {
+	if rule := rs.names[strings.ToLower(name)]; rule != nil {
+		return &ruleMatch{rule: rule, field: field, value: name}
+	}
+	return nil
+}
+
+// matchPath checks the glob and regex rules against a full executable path.
+func (rs *ruleSet) matchPath(path string) *ruleMatch {
+	if path == "" {
+		return nil
+	}
+	lower := strings.ToLower(path)
+	for _, rule := range rs.paths {
+		if rule.re != nil {
+			if rule.re.MatchString(path) {
+				return &ruleMatch{rule: rule, field: "path", value: path}
+			}
+		} else if ok, _ := filepath.Match(rule.glob, lower); ok {
+			return &ruleMatch{rule: rule, field: "path", value: path}
+		}
+	}
+	return nil
+}
+
+// matchCheap checks what needs no file access: the name, and the path if
+// the provider listed it.
+func (rs *ruleSet) matchCheap(proc Process) *ruleMatch {
+	if m := rs.matchName("name", proc.Name); m != nil {
+		return m
+	}
+	return rs.matchPath(proc.Path)
+}
+
+// match checks every rule type, hashing the executable if there are hash
+// rules. proc must have been inspected.
+func (rs *ruleSet) match(proc Process, hashes *fileHashes) *ruleMatch {
+	if m := rs.matchCheap(proc); m != nil {
+		return m
+	}
+	if proc.Path == "" {
+		return nil
+	}
+	// The listed name can differ from the image's, e.g. for long names
+	if m := rs.matchName("image name", filepath.Base(proc.Path)); m != nil {
+		return m
+	}
+	if len(rs.hashes) == 0 {
+		return nil
+	}
+	sum, err := hashes.sum(proc.Path)
+	if err != nil {
+		return nil
+	}
+	if rule := rs.hashes[sum]; rule != nil {
+		return &ruleMatch{rule: rule, field: "sha256", value: sum}
+	}
+	return nil
+}
+
+// matchMetadata checks the name rules against version metadata, each in
+// its own match mode.
+func (rs *ruleSet) matchMetadata(productName, fileDescription string) *ruleMatch {
+	for _, rule := range rs.named {
+		needle := strings.TrimSuffix(strings.ToLower(rule.Value), ".exe")
+		for _, f := range []struct{ field, value string }{
+			{"product name", productName},
+			{"file description", fileDescription},
+		} {
+			if matchText(rule.EffectiveMatch(), strings.ToLower(f.value), needle) {
+				return &ruleMatch{rule: rule, field: f.field, value: f.value}
+			}
+		}
+	}
+	return nil
+}
+
+// matchText compares a lower-case metadata field with a lower-case name.
+func matchText(mode storage.MatchMode, field, name string) bool {
+	if field == "" || name == "" {
+		return false
+	}
+	switch mode {
+	case storage.MatchExact:
+		return field == name
+	case storage.MatchPrefix:
+		return strings.HasPrefix(field, name)
+	case storage.MatchContains:
+		return strings.Contains(field, name)
+	default:
+		return containsWord(field, name)
+	}
+}
+
+// containsWord reports whether name appears in s with no letter or digit
+// directly before or after it: "team" matches "team viewer" but neither
+// "steam" nor "teams".
+func containsWord(s, name string) bool {
+	for offset := 0; offset < len(s); {
+		i := strings.Index(s[offset:], name)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(name)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
@@ -0,0 +1,135 @@
+package watchdog
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"focus-lock/backend/clock"
+	"focus-lock/backend/storage"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleMatch(t *testing.T) {
+	bin := t.TempDir()
+	game := writeExe(t, bin, "game", "game image")
+	gameSum := fmt.Sprintf("%x", sha256.Sum256([]byte("game image")))
+
+	tests := []struct {
+		name  string
+		rule  storage.AppRule
+		proc  Process
+		field string // Empty for no match
+	}{
+		{"name", storage.NameRule("game"), Process{Name: "game"}, "name"},
+		{"name in another case", storage.NameRule("Game.EXE"), Process{Name: "game.exe"}, "name"},
+		{".exe optional in the rule", storage.NameRule("game"), Process{Name: "game.exe"}, "name"},
+		{".exe required in the name", storage.NameRule("game.exe"), Process{Name: "game"}, ""},
+		{"image name", storage.NameRule("game"), Process{Name: "gam~1", Path: game}, "image name"},
+		{"glob", storage.AppRule{Type: storage.RulePathGlob, Value: `/opt/*/game`}, Process{Name: "x", Path: "/opt/Games/GAME"}, "path"},
+		{"glob, other directory", storage.AppRule{Type: storage.RulePathGlob, Value: `/opt/*/game`}, Process{Name: "x", Path: "/usr/games/game"}, ""},
+		{"regex", storage.AppRule{Type: storage.RulePathRegex, Value: `games/[a-z]+$`}, Process{Name: "x", Path: "/opt/Games/Game"}, "path"},
+		{"regex, no match", storage.AppRule{Type: storage.RulePathRegex, Value: `games/[a-z]+$`}, Process{Name: "x", Path: "/opt/Games/game2"}, ""},
+		{"sha256", storage.AppRule{Type: storage.RuleSHA256, Value: strings.ToUpper(gameSum)}, Process{Name: "notes", Path: game}, "sha256"},
+		{"sha256, other image", storage.AppRule{Type: storage.RuleSHA256, Value: strings.Repeat("0", 64)}, Process{Name: "notes", Path: game}, ""},
+		{"no path, no hash", storage.AppRule{Type: storage.RuleSHA256, Value: gameSum}, Process{Name: "notes"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := compileRules([]storage.AppRule{tt.rule}).match(tt.proc, newFileHashes())
+			switch {
+			case m == nil && tt.field != "":
+				t.Fatalf("no match, want one on %s", tt.field)
+			case m != nil && m.field != tt.field:
+				t.Fatalf("matched: %s, want field %q", m, tt.field)
+			}
+		})
+	}
+}
+
+func TestMatchMetadata(t *testing.T) {
+	tests := []struct {
+		mode        storage.MatchMode
+		rule        string
+		product     string
+		description string
+		field       string // Empty for no match
+	}{
+		{storage.MatchExact, "steam", "Steam", "", "product name"},
+		{storage.MatchExact, "steam.exe", "Steam", "", "product name"},
+		{storage.MatchExact, "steam", "Steam Client", "", ""},
+		{storage.MatchPrefix, "steam", "Steam Client", "", "product name"},
+		{storage.MatchPrefix, "client", "Steam Client", "", ""},
+		{"", "team", "Team Viewer", "", "product name"},
+		{storage.MatchWord, "team", "Steam", "", ""},
+		{storage.MatchWord, "team", "", "Teams", ""},
+		{storage.MatchWord, "team", "", "Remote control (team viewer)", "file description"},
+		{storage.MatchContains, "team", "Steam", "", "product name"},
+		{storage.MatchContains, "team", "", "", ""},
+	}
+	for _, tt := range tests {
+		rule := storage.NameRule(tt.rule)
+		rule.Match = tt.mode
+		m := compileRules([]storage.AppRule{rule}).matchMetadata(tt.product, tt.description)
+		got := ""
+		if m != nil {
+			got = m.field
+		}
+		if got != tt.field {
+			t.Errorf("%s rule %q on %q/%q: matched %q, want %q", rule.EffectiveMatch(), tt.rule, tt.product, tt.description, got, tt.field)
+		}
+	}
+}
+
+func TestRuleScopes(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	processes := []Process{
+		{PID: 10, Name: "launcher", Path: "/opt/launcher", StartTime: start},
+		{PID: 11, PPID: 10, Name: "game", Path: "/opt/game", StartTime: start.Add(time.Minute)},
+		{PID: 12, PPID: 11, Name: "helper", Path: "/opt/helper", StartTime: start.Add(2 * time.Minute)},
+		{PID: 20, Name: "editor", Path: "/opt/editor", StartTime: start},
+	}
+
+	tests := []struct {
+		scope storage.RuleScope
+		swept []uint32 // Killed by a sweep
+		// Killed when the launcher and the helper start
+		launcherStarted, helperStarted []uint32
+	}{
+		{storage.ScopeProcess, []uint32{10}, []uint32{10}, nil},
+		{storage.ScopeTree, []uint32{10, 11, 12}, []uint32{10}, []uint32{12}},
+		{storage.ScopeLaunched, []uint32{11, 12}, nil, []uint32{12}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scope), func(t *testing.T) {
+			rule := storage.AppRule{Type: storage.RuleName, Value: "launcher", Scope: tt.scope, Termination: &storage.Termination{}}
+			rules := compileRules([]storage.AppRule{rule})
+			run := func(enforce func(*FakeProcessProvider, *terminator, *storage.Store)) []uint32 {
+				store, _ := testStore(t, clock.NewFake(start))
+				fake := NewFakeProcessProvider(processes...)
+				term := newTerminator(fake, store, newFileHashes())
+				enforce(fake, term, store)
+				settle(t, term)
+				return sorted(fake.Killed())
+			}
+			started := func(pid uint32) func(*FakeProcessProvider, *terminator, *storage.Store) {
+				return func(fake *FakeProcessProvider, term *terminator, store *storage.Store) {
+					enforceStarted(fake, term, store, pid, rules, newFileHashes())
+				}
+			}
+
+			if got := run(func(fake *FakeProcessProvider, term *terminator, store *storage.Store) {
+				enforceFast(fake, term, rules, store)
+			}); !slices.Equal(got, tt.swept) {
+				t.Errorf("sweep killed %v, want %v", got, tt.swept)
+			}
+			if got := run(started(10)); !slices.Equal(got, tt.launcherStarted) {
+				t.Errorf("launcher start killed %v, want %v", got, tt.launcherStarted)
+			}
+			if got := run(started(12)); !slices.Equal(got, tt.helperStarted) {
+				t.Errorf("helper start killed %v, want %v", got, tt.helperStarted)
+			}
+		})
+	}
+}
@@ -1,220 +1,250 @@
 package watchdog
 
 import (
+	"errors"
 	"fmt"
+	"focus-lock/backend/datadir"
 	"focus-lock/backend/storage"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
-	"unsafe"
-
-	"golang.org/x/sys/windows"
 
 	"focus-lock/backend/blocking/hosts"
 	"focus-lock/backend/protection"
 )
 
-// Windows API constants and types
-const (
-	TH32CS_SNAPPROCESS = 0x00000002
-)
-
-// ProcessEntry32 structure
-type ProcessEntry32 struct {
-	Size            uint32
-	CntUsage        uint32
-	ProcessID       uint32
-	DefaultHeapID   uintptr
-	ModuleID        uint32
-	CntThreads      uint32
-	ParentProcessID uint32
-	PriClassBase    int32
-	Flags           uint32
-	ExeFile         [windows.MAX_PATH]uint16
-}
-
 func debugLog(msg string) {
-	configDir, _ := os.UserConfigDir()
-	logPath := filepath.Join(configDir, "FocusLock", "debug.log")
+	logPath, err := datadir.Path("debug.log")
+	if err != nil {
+		return
+	}
 	f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	defer f.Close()
 	f.WriteString(time.Now().Format(time.RFC3339) + " " + msg + "\n")
 }
 
-// IsScheduleActive checks if any enabled schedule matches the current time
-func IsScheduleActive(schedules []storage.Schedule) bool {
-	now := time.Now()
-	currentDay := now.Format("Mon")    // "Mon", "Tue", ...
-	currentTime := now.Format("15:04") // "HH:MM"
-
+// ActiveSchedules returns the enabled schedules whose window contains now.
+func ActiveSchedules(schedules []storage.Schedule, now time.Time) []storage.Schedule {
+	var active []storage.Schedule
 	for _, s := range schedules {
-		if !s.Enabled {
-			continue
-		}
-
-		// Check Day
-		dayMatch := false
-		for _, d := range s.Days {
-			if d == currentDay {
-				dayMatch = true
-				break
-			}
-		}
-		if !dayMatch {
-			continue
-		}
-
-		// Check Time Range
-		// Simple string comparison works for 24h "HH:MM" format
-		if currentTime >= s.StartTime && currentTime < s.EndTime {
-			return true
+		if s.ActiveAt(now) {
+			active = append(active, s)
 		}
 	}
-	return false
+	return active
 }
 
+// enforcementFields are the config fields whose change must take effect
+// immediately rather than on the next slow tick.
+var enforcementFields = []string{
+	"profiles", "active_profile_id", "session_profile_id",
+	"schedules", "lock_end_time", "paused_until", "exceptions",
+}
+
+// statsCompactionInterval is how often the ghost rolls up statistics.
+const statsCompactionInterval = 10 * time.Minute
+
+// Snapshot intervals of the fast loop. With process start events the
+// snapshot is only a sweep for events that were dropped.
+const (
+	pollInterval  = 500 * time.Millisecond
+	sweepInterval = 3 * time.Second
+)
+
 // StartEnforcer runs deeply in the background. It monitors the lock time and schedules.
 func StartEnforcer(store *storage.Store, isGhost bool) {
+	StartEnforcerWith(store, isGhost, NewSystemProcessProvider(), NewSystemProcessEventSource(), nil)
+}
+
+// StartEnforcerWith is StartEnforcer on the given process provider and
+// start event source. Once stop is closed it lets running termination
+// ladders finish and returns; a nil stop runs it for good.
+// Tests pass a FakeProcessProvider and a FakeProcessEventSource.
+func StartEnforcerWith(store *storage.Store, isGhost bool, procs ProcessProvider, events ProcessEventSource, stop <-chan struct{}) {
 	debugLog(fmt.Sprintf("Enforcer Watchdog Started (Ghost=%v)", isGhost))
 
-	// Main Polling Ticker (Aggressive for coverage)
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
+	// The store's clock, so that a fake clock in tests drives both
+	clk := store.Clock()
+	hashes := newFileHashes()
+	term := newTerminator(procs, store, hashes)
+	scan := newProcCache(procs, newMetadataCache(NewSystemMetadataReader(), clk.Now))
+
+	// Process start events, if the platform has them. Without them the
+	// fast loop polls aggressively for coverage.
+	starts, err := events.Start()
+	fastInterval := sweepInterval
+	if err != nil {
+		debugLog("Process start events unavailable, polling: " + err.Error())
+		starts = nil
+		fastInterval = pollInterval
+	} else {
+		defer events.Close()
+	}
+
+	// Main Polling Ticker
+	ticker := clk.NewTicker(fastInterval)
+	defer func() { ticker.Stop() }()
 
 	// Update Loop: Save usage & Anti-Cheat (Deep Check)
-	slowTicker := time.NewTicker(5 * time.Second)
+	slowTicker := clk.NewTicker(5 * time.Second)
 	defer slowTicker.Stop()
 
-	// Helper to refresh cache
-	refreshCache := func() ([]string, map[string]bool, error) {
-		if err := store.Load(); err != nil {
-			return nil, nil, err
-		}
-		apps := store.Data.BlockedApps
-		if store.Data.BlockCommonVPN {
-			apps = append(apps, protection.GetVPNExecutables()...)
-		}
-
-		// Build map for O(1) lookup
-		lookup := make(map[string]bool)
-		for _, app := range apps {
-			name := strings.ToLower(app)
-			lookup[name] = true
-			if !strings.HasSuffix(name, ".exe") {
-				lookup[name+".exe"] = true
-			}
-		}
-		return apps, lookup, nil
-	}
+	// Profiles the cache was built for. Schedules start and end between
+	// config changes, so the fast loop rebuilds when this changes.
+	var cachedProfiles string
 
-	cachedBlockedApps, cachedLookup, _ := refreshCache()
+	// Helper to rebuild the cache from a desired state of cfg
+	buildCache := func(cfg storage.Config, state DesiredState) *ruleSet {
+		cachedProfiles = profileKey(state.Profiles)
+		term.setAllowlist(newAllowlist(cfg.GhostExePath, state.Exceptions, hashes))
 
-	// Initialize File Watcher
-	configPath := store.GetFilePath()
-	var lastModTime time.Time
-	if info, err := os.Stat(configPath); err == nil {
-		lastModTime = info.ModTime()
+		// Index the rules for O(1) name lookup
+		return compileRules(state.Rules)
 	}
 
-	// Initial check to block immediately if needed
+	// Subscribe before the first load so no change is missed in between
+	changes, cancelChanges := store.Subscribe()
+	defer cancelChanges()
+
+	// The subscription reloads the store in the background, so the loop
+	// only reads snapshots of it
 	store.Load()
-	if !store.Data.LockEndTime.IsZero() && time.Now().Before(store.Data.LockEndTime) {
-		blockSites(store)
-	} else if IsScheduleActive(store.Data.Schedules) {
-		blockSites(store)
+	cfg := store.Snapshot()
+	state := Evaluate(cfg, clk.Now())
+	cachedRules := buildCache(cfg, state)
+
+	// Initial check to block immediately if needed. Processes left
+	// suspended by an enforcer that died are resumed once nothing is
+	// enforced; until then they stay suspended.
+	if state.Enforce {
+		blockSites(store, state.Sites)
+	} else {
+		term.resumeAll()
 	}
 
-	defer hosts.Unblock()
+	defer func() { UnblockSites(store, clk.Now()) }()
+
+	var lastStatsCompaction time.Time
 
 	for {
 		select {
-		case <-ticker.C:
-			// fast loop
-
-			// 0. Check for Config Changes (Immediate Reaction)
-			if info, err := os.Stat(configPath); err == nil {
-				// Use !Equal to catch any modification (sometimes time resolution can be tricky)
-				if !info.ModTime().Equal(lastModTime) {
-					lastModTime = info.ModTime()
-					debugLog("Config file changed. Reloading cache...")
-					newApps, newLookup, err := refreshCache()
-					if err == nil {
-						cachedBlockedApps, cachedLookup = newApps, newLookup
-						// Force block sites immediately (Flush DNS)
-						// Also re-checks lock status inside blockSites/enforce
-						store.Load() // Ensure store.Data is latest for below checks
-						if !store.Data.LockEndTime.IsZero() && time.Now().Before(store.Data.LockEndTime) {
-							blockSites(store)
-						} else if IsScheduleActive(store.Data.Schedules) {
-							blockSites(store)
-						}
-					}
-				}
+		case <-stop:
+			// Suspensions of a session that is still on are left to the
+			// other enforcer, which resumes them when it ends
+			if !Evaluate(store.Snapshot(), clk.Now()).Enforce {
+				term.resumeAll()
 			}
+			term.wait()
+			_ = store.FlushKills()
+			return
+
+		case start, ok := <-starts:
+			if !ok {
+				// Source failed: fall back to polling
+				debugLog("Process start events stopped, polling")
+				starts = nil
+				ticker.Stop()
+				ticker = clk.NewTicker(pollInterval)
+				continue
+			}
+			cfg := store.Snapshot()
+			state := Evaluate(cfg, clk.Now())
+			if !state.Enforce {
+				continue
+			}
+			if profileKey(state.Profiles) != cachedProfiles {
+				cachedRules = buildCache(cfg, state)
+			}
+			enforceStarted(procs, term, store, start.PID, cachedRules, hashes)
 
-			// RELOAD Config on fast loop? No, too expensive.
-			// But we need to know if we should be enforcing.
-
-			// For Manual Lock, we trust the in-memory state or lightweight check?
-			// We MUST check time. So we use the loaded store data.
-
-			// 1. Check Locked State
-			manualActive := !store.Data.LockEndTime.IsZero() && time.Now().Before(store.Data.LockEndTime)
-
-			// 2. Check Schedule State
-			// Schedule needs current time, which changes.
-			// However schedule definitions (Schedules list) change rarely.
-			// We use cached store data for schedule definitions until slow tick reloads.
-			scheduleActive := IsScheduleActive(store.Data.Schedules)
-
-			shouldEnforce := manualActive || scheduleActive
-
-			// 3. Check Pause
-			if !store.Data.PausedUntil.IsZero() && time.Now().Before(store.Data.PausedUntil) {
-				shouldEnforce = false
+		case ev := <-changes:
+			// Config Changes (Immediate Reaction). The store has already
+			// reloaded, so its snapshot is current.
+			if !ev.Changed(enforcementFields...) {
+				continue
+			}
+			debugLog("Config changed. Rebuilding cache...")
+			cfg := store.Snapshot()
+			state := Evaluate(cfg, clk.Now())
+			cachedRules = buildCache(cfg, state)
+
+			// Force block sites immediately (Flush DNS)
+			if state.Enforce {
+				blockSites(store, state.Sites)
+			} else {
+				// Stopped or paused: give suspended apps back right away
+				term.resumeAll()
 			}
 
-			if shouldEnforce {
-				enforceFast(cachedLookup, store)
+		case <-ticker.C():
+			// fast loop
+
+			// RELOAD Config on fast loop? No, too expensive.
+			// The snapshot is refreshed by change events, so it is current;
+			// only the time has moved on.
+			cfg := store.Snapshot()
+			state := Evaluate(cfg, clk.Now())
+
+			if state.Enforce {
+				// A schedule with another profile may have just started
+				if profileKey(state.Profiles) != cachedProfiles {
+					cachedRules = buildCache(cfg, state)
+				}
+				enforceFast(procs, term, cachedRules, store)
 			} else {
 				// If we just exited a lock state, we should unblock (Hosts).
 				// But doing it here every 500ms is spammy.
 				// We rely on SlowLoop to handle state transitions or just leave it until SlowLoop cleans up.
 			}
 
-		case <-slowTicker.C:
+		case <-slowTicker.C():
 			// SLOW LOOP - Reload Config & Deep Check
 
-			// 1. Reload Config
-			newApps, newLookup, err := refreshCache()
-			if err != nil {
+			// 1. Reload Config (backstop in case a change notification was missed)
+			if err := store.Load(); err != nil {
 				debugLog("Config reload failed: " + err.Error())
-			} else {
-				cachedBlockedApps, cachedLookup = newApps, newLookup
 			}
 
-			// 2. Recalculate State with fresh data
-			manualActive := !store.Data.LockEndTime.IsZero() && time.Now().Before(store.Data.LockEndTime)
+			// A rewritten change journal is a tamper signal
+			checkJournal(store)
+
+			now := clk.Now()
 
+			// 2. Recalculate State with fresh data
 			// NTP Check logic could go here, but for now we trust local time for simplicity in V1 schedule
-			// For Manual Lock, we still respect the monotonic expiration if we were tracking it,
-			// but we simplify here to just check valid LockEndTime.
+			cfg := store.Snapshot()
+			state := Evaluate(cfg, now)
+			cachedRules = buildCache(cfg, state)
+
+			// Open and close session records to match the lock state
+			syncSessions(store, state, now)
 
-			scheduleActive := IsScheduleActive(store.Data.Schedules)
-			shouldEnforce := manualActive || scheduleActive
+			// Write the kills of the last few seconds in one go
+			if err := store.FlushKills(); err != nil {
+				debugLog("Stats write failed: " + err.Error())
+			}
+
+			// Roll up statistics past their retention (Ghost only, so the
+			// two processes do not both rewrite the stats file)
+			if isGhost && now.Sub(lastStatsCompaction) >= statsCompactionInterval {
+				lastStatsCompaction = now
+				if err := store.CompactStats(lastStatsCompaction); err != nil {
+					debugLog("Stats compaction failed: " + err.Error())
+				}
+			}
 
 			// 3. Check Pause
-			if !store.Data.PausedUntil.IsZero() && time.Now().Before(store.Data.PausedUntil) {
+			if state.Paused {
 				debugLog("Emergency Unlocked (Paused). Unblocking hosts.")
-				hosts.Unblock()
+				UnblockSites(store, now)
+				term.resumeAll()
 				continue
 			}
 
-			if shouldEnforce {
+			if state.Enforce {
 				// 4. Update Remaining Duration (Only for Manual Lock)
-				if manualActive {
-					updatedRemaining := time.Until(store.Data.LockEndTime)
+				if state.ManualActive {
+					updatedRemaining := cfg.LockEndTime.Sub(now)
 					if updatedRemaining < 0 {
 						updatedRemaining = 0
 					}
@@ -226,292 +256,223 @@ func StartEnforcer(store *storage.Store, isGhost bool) {
 				}
 
 				// 5. Deep Enforce
-				enforceDeep(cachedBlockedApps, store)
-				blockSites(store)
+				term.prune()
+				enforceDeep(procs, scan, term, cachedRules, hashes)
+				blockSites(store, state.Sites)
 			} else {
-				// Not enforcing. Ensure Unblock.
-				hosts.Unblock()
+				// Not enforcing. Ensure Unblock, and resume what was
+				// suspended (also before the ghost exits below).
+				UnblockSites(store, now)
+				term.resumeAll()
 
 				// Cleanup expired manual lock
-				if !store.Data.LockEndTime.IsZero() && time.Now().After(store.Data.LockEndTime) {
-					store.Data.LockEndTime = time.Time{}
-					store.Data.RemainingDuration = 0
-					store.Save()
+				if state.LockExpired {
+					store.UpdateAtomic(func(cfg *storage.Config) {
+						cfg.LockEndTime = time.Time{}
+						cfg.RemainingDuration = 0
+					})
+					state = Evaluate(store.Snapshot(), now)
 				}
 
 				// If we are the Ghost process, check if we should exit.
 				// Only exit if there's NO manual lock AND NO enabled schedules at all.
 				// (If schedules exist, we stay alive to enforce them when they become active)
-				if isGhost {
-					hasEnabledSchedules := false
-					for _, s := range store.Data.Schedules {
-						if s.Enabled {
-							hasEnabledSchedules = true
-							break
-						}
-					}
-
-					manualLockPresent := !store.Data.LockEndTime.IsZero()
-
-					if !manualLockPresent && !hasEnabledSchedules {
-						debugLog("Nothing to enforce and no schedules. Ghost process exiting.")
-						// NOTE: We intentionally do NOT delete the scheduled task here.
-						// The task should persist so that future manual/scheduled sessions
-						// work without re-running the admin setup script.
-						protection.SetCritical(false)
-						os.Exit(0)
-					}
-					// Otherwise, Ghost stays alive waiting for next schedule window
+				if isGhost && !state.HasWork {
+					debugLog("Nothing to enforce and no schedules. Ghost process exiting.")
+					// NOTE: We intentionally do NOT delete the scheduled task here.
+					// The task should persist so that future manual/scheduled sessions
+					// work without re-running the admin setup script.
+					protection.SetCritical(false)
+					_ = store.FlushKills()
+					os.Exit(0)
 				}
+				// Otherwise, Ghost stays alive waiting for next schedule window
 			}
 		}
 	}
 }
 
-func blockSites(store *storage.Store) {
-	sites := store.Data.BlockedSites
-	if store.Data.BlockCommonVPN {
-		sites = append(sites, protection.GetVPNDomains()...)
-	}
-	if len(sites) > 0 {
-		if err := hosts.Block(sites); err != nil {
-			debugLog(fmt.Sprintf("Failed to block sites: %v", err))
-		}
+// checkJournal reports a broken change journal. The store penalizes each
+// break once, however often it is found.
+func checkJournal(store *storage.Store) {
+	if err := store.VerifyJournal(); errors.Is(err, storage.ErrJournalTampered) {
+		debugLog("TAMPER: " + err.Error())
+		store.ReportJournalBroken(err)
 	}
 }
 
-// enforceFast uses O(1) map lookup for filenames
-func enforceFast(blockedMap map[string]bool, store *storage.Store) {
-	if len(blockedMap) == 0 {
+// blockSites writes the effective site list to the hosts file. Our section
+// missing although the last write left it in place means someone else
+// removed it.
+func blockSites(store *storage.Store, sites []string) {
+	if len(sites) == 0 {
 		return
 	}
-
-	snapshot, err := windows.CreateToolhelp32Snapshot(TH32CS_SNAPPROCESS, 0)
+	removed := false
+	err := store.UpdateHosts(func(_ *storage.Config, blocked bool) (bool, error) {
+		if blocked {
+			if present, err := hosts.IsBlocked(); err == nil && !present {
+				removed = true
+			}
+		}
+		return true, hosts.Block(sites)
+	})
 	if err != nil {
-		return // Silent fail for speed
+		debugLog(fmt.Sprintf("Failed to block sites: %v", err))
 	}
-	defer windows.CloseHandle(snapshot)
+	if removed {
+		debugLog("TAMPER: Focus Lock section removed from hosts file")
+		store.ReportTamper(storage.TamperHostsBlockRemoved, "FOCUS LOCK section missing from hosts file")
+	}
+}
 
-	var procEntry ProcessEntry32
-	procEntry.Size = uint32(unsafe.Sizeof(procEntry))
+// UnblockSites removes our section from the hosts file unless the config
+// on disk still asks for it, e.g. a schedule window outlasting a stopped
+// manual lock, or a session the other process has just started.
+func UnblockSites(store *storage.Store, now time.Time) error {
+	return store.UpdateHosts(func(cfg *storage.Config, blocked bool) (bool, error) {
+		if state := Evaluate(*cfg, now); state.Enforce && len(state.Sites) > 0 {
+			return blocked, nil
+		}
+		return false, hosts.Unblock()
+	})
+}
 
-	if err := Process32First(snapshot, &procEntry); err != nil {
+// enforceFast uses O(1) map lookup for filenames, plus the path rules where
+// the snapshot carries paths
+func enforceFast(procs ProcessProvider, term *terminator, rules *ruleSet, store *storage.Store) {
+	if rules.empty() {
 		return
 	}
 
-	for {
-		exeName := windows.UTF16ToString(procEntry.ExeFile[:])
+	processes, err := procs.List()
+	if err != nil {
+		return // Silent fail for speed
+	}
 
+	// Reload Config BEFORE the first kill to check for Emergency Unlock
+	checked, paused := false, false
+	endMatches(processes, func(proc *Process) *ruleMatch {
 		// Check against map (O(1))
-		if blockedMap[strings.ToLower(exeName)] {
-			// CRITICAL FIX: Reload Config BEFORE killing to check for Emergency Unlock
-			// This prevents race condition where we overwrite the pause command with old data.
-			store.Load()
-			if !store.Data.PausedUntil.IsZero() && time.Now().Before(store.Data.PausedUntil) {
-				return // Stop enforcing if paused
-			}
-
-			killProcess(procEntry.ProcessID, exeName, store)
+		m := rules.matchCheap(*proc)
+		if m != nil && !checked {
+			checked = true
+			paused = pausedOnDisk(store)
 		}
-
-		if err := Process32Next(snapshot, &procEntry); err != nil {
-			break
+		if paused {
+			return nil // Stop enforcing if paused
 		}
+		return m
+	}, term)
+}
+
+// pausedOnDisk reloads the config and reports whether enforcement is
+// paused. The fast paths call it before killing: the change event for a
+// pause the other process has just saved can lag behind by a poll interval,
+// and killing in that window would ignore the pause.
+func pausedOnDisk(store *storage.Store) bool {
+	if err := store.Load(); err != nil {
+		debugLog("Config reload failed: " + err.Error())
 	}
+	return Evaluate(store.Snapshot(), store.Clock().Now()).Paused
 }
 
-// enforceDeep uses partial string matching on metadata (Slower)
-func enforceDeep(blockedApps []string, store *storage.Store) {
-	if len(blockedApps) == 0 {
+// enforceStarted checks a process that has just started against every rule,
+// and its ancestors against the rules that cover what they launch. It is
+// the event-driven counterpart of enforceFast.
+func enforceStarted(procs ProcessProvider, term *terminator, store *storage.Store, pid uint32, rules *ruleSet, hashes *fileHashes) {
+	if rules.empty() {
 		return
 	}
 
-	snapshot, err := windows.CreateToolhelp32Snapshot(TH32CS_SNAPPROCESS, 0)
-	if err != nil {
-		debugLog("Snapshot error: " + err.Error())
+	proc := Process{PID: pid}
+	if err := procs.Inspect(&proc); err != nil || proc.Path == "" {
+		return // Already gone, or not ours to read; the sweep covers the rest
+	}
+	proc.Name = filepath.Base(proc.Path)
+	if m := rules.match(proc, hashes); m != nil && m.rule.EffectiveScope() != storage.ScopeLaunched {
+		if !pausedOnDisk(store) {
+			term.end(proc, m)
+		}
 		return
 	}
-	defer windows.CloseHandle(snapshot)
-
-	var procEntry ProcessEntry32
-	procEntry.Size = uint32(unsafe.Sizeof(procEntry))
-
-	if err := Process32First(snapshot, &procEntry); err != nil {
+	if !rules.launchers {
 		return
 	}
 
-	for {
-		exeName := windows.UTF16ToString(procEntry.ExeFile[:])
-
-		// We only need to check DEEP if the name itself DOES NOT match.
-		// If name matches, Fast Loop catches it (or we catch it here too, no harm).
-		// But for efficiency, we assume Fast Loop does its job.
-
-		// Do we check ALL processes? Yes.
-
-		// Metadata check
-		fullPath := getProcessPath(procEntry.ProcessID)
-		if fullPath != "" {
-			prodName, fileDesc := getFileMetadata(fullPath)
-			// Normalize
-			prodName = strings.ToLower(prodName)
-			fileDesc = strings.ToLower(fileDesc)
-
-			for _, blocked := range blockedApps {
-				blockedClean := strings.TrimSuffix(strings.ToLower(blocked), ".exe")
-
-				if (prodName != "" && strings.Contains(prodName, blockedClean)) ||
-					(fileDesc != "" && strings.Contains(fileDesc, blockedClean)) {
-
-					killProcess(procEntry.ProcessID, exeName, store)
-					break // Killed
-				}
-			}
+	// Walk up the parent chain for a launcher whose children are blocked
+	child := proc
+	for depth := 0; child.PPID != 0 && depth < maxTreeDepth; depth++ {
+		parent := Process{PID: child.PPID}
+		if err := procs.Inspect(&parent); err != nil || parent.Path == "" || !launchedBy(child, parent) {
+			return
 		}
-
-		if err := Process32Next(snapshot, &procEntry); err != nil {
-			break
+		parent.Name = filepath.Base(parent.Path)
+		if m := rules.match(parent, hashes); m != nil && m.rule.EffectiveScope() != storage.ScopeProcess {
+			if !pausedOnDisk(store) {
+				term.end(proc, launcherMatch(m, parent))
+			}
+			return
 		}
+		child = parent
 	}
 }
 
-func killProcess(pid uint32, name string, store *storage.Store) {
-	// Open process with Terminate rights
-	handle, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, pid)
-	if err != nil {
-		debugLog("OpenProcess failed for " + name + ": " + err.Error())
+// enforceDeep checks every rule against the full path and image hash, and
+// name rules against the executable metadata in their match mode (Slower).
+// What it reads is cached in scan, so a process is only read in full once.
+func enforceDeep(procs ProcessProvider, scan *procCache, term *terminator, rules *ruleSet, hashes *fileHashes) {
+	if rules.empty() {
 		return
 	}
-	defer windows.CloseHandle(handle)
-
-	// Terminate
-	if err := windows.TerminateProcess(handle, 1); err == nil {
-		debugLog(fmt.Sprintf("Process terminated: %s [PID: %d]", name, pid))
-		store.IncrementKillCount(name)
-	} else {
-		debugLog(fmt.Sprintf("TerminateProcess failed for %s: %s", name, err.Error()))
-	}
-}
 
-// Wrapper for Process32First/Next since they are not in x/sys/windows directly or slightly different signatures
-// Actually they SHOULD be in x/sys/windows, but sometimes under different names or need manual load.
-// Let's check if they exist. Usually CreateToolhelp32Snapshot is there.
-// Process32First might accept *ProcessEntry32.
-
-// To be safe, I will implement the syscall wrapper manually for Process32First/Next to avoid dependency hell if the version differs.
-var (
-	kernel32                       = windows.NewLazySystemDLL("kernel32.dll")
-	version                        = windows.NewLazySystemDLL("version.dll")
-	procProcess32First             = kernel32.NewProc("Process32FirstW")
-	procProcess32Next              = kernel32.NewProc("Process32NextW")
-	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
-	procGetFileVersionInfoSizeW    = version.NewProc("GetFileVersionInfoSizeW")
-	procGetFileVersionInfoW        = version.NewProc("GetFileVersionInfoW")
-	procVerQueryValueW             = version.NewProc("VerQueryValueW")
-)
-
-// getFileMetadata returns Product Name or File Description for a given executable path
-func getFileMetadata(path string) (string, string) {
-	// Get size of version info
-	ptrPath, err := windows.UTF16PtrFromString(path)
+	processes, err := procs.List()
 	if err != nil {
-		return "", ""
-	}
-
-	var handle uint32 // This handle is not used by GetFileVersionInfoSizeW, it's an output parameter for GetFileVersionInfo.
-	size, _, _ := procGetFileVersionInfoSizeW.Call(uintptr(unsafe.Pointer(ptrPath)), uintptr(unsafe.Pointer(&handle)))
-	if size == 0 {
-		return "", ""
-	}
-
-	// Allocate buffer
-	data := make([]byte, size)
-	ret, _, _ := procGetFileVersionInfoW.Call(
-		uintptr(unsafe.Pointer(ptrPath)),
-		0,
-		size,
-		uintptr(unsafe.Pointer(&data[0])),
-	)
-	if ret == 0 {
-		return "", ""
+		debugLog("Snapshot error: " + err.Error())
+		return
 	}
 
-	// Helper to query string value
-	query := func(key string) string {
-		var transBlock *struct {
-			LangID  uint16
-			CharSet uint16
+	// Do we check ALL processes? Yes. Renamed executables only show up in
+	// their path, hash or metadata.
+	endMatches(processes, func(proc *Process) *ruleMatch {
+		if err := scan.inspect(proc); err != nil || proc.Path == "" {
+			return nil
 		}
-		var transLen uint32
-		subBlockTr, _ := windows.UTF16PtrFromString("\\VarFileInfo\\Translation")
-		// Query language
-		ret, _, _ := procVerQueryValueW.Call(
-			uintptr(unsafe.Pointer(&data[0])),
-			uintptr(unsafe.Pointer(subBlockTr)),
-			uintptr(unsafe.Pointer(&transBlock)),
-			uintptr(unsafe.Pointer(&transLen)),
-		)
-
-		langCodes := []string{"040904b0"} // Default US English
-		if ret != 0 && transLen >= 4 {
-			// Add found language, prioritizing it
-			langCodes = append([]string{fmt.Sprintf("%04x%04x", transBlock.LangID, transBlock.CharSet)}, langCodes...)
+		if m := rules.match(*proc, hashes); m != nil {
+			return m
 		}
 
-		for _, code := range langCodes {
-			subBlock, _ := windows.UTF16PtrFromString(fmt.Sprintf("\\StringFileInfo\\%s\\%s", code, key))
-			var valPtr uintptr
-			var valLen uint32
-			ret, _, _ = procVerQueryValueW.Call(
-				uintptr(unsafe.Pointer(&data[0])),
-				uintptr(unsafe.Pointer(subBlock)),
-				uintptr(unsafe.Pointer(&valPtr)),
-				uintptr(unsafe.Pointer(&valLen)),
-			)
-			if ret != 0 && valLen > 0 {
-				return windows.UTF16PtrToString((*uint16)(unsafe.Pointer(valPtr)))
-			}
-		}
-		return ""
-	}
-
-	return query("ProductName"), query("FileDescription")
-}
-
-func getProcessPath(pid uint32) string {
-	hProcess, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
-	if err != nil {
-		return ""
-	}
-	defer windows.CloseHandle(hProcess)
-
-	buf := make([]uint16, windows.MAX_PATH)
-	size := uint32(len(buf))
-	// QueryFullProcessImageNameW(hProcess, 0, &buf, &size)
-	ret, _, _ := procQueryFullProcessImageNameW.Call(
-		uintptr(hProcess),
-		0, // dwFlags: 0 for default (Win32 path format)
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(unsafe.Pointer(&size)),
-	)
-	if ret == 0 {
-		return ""
-	}
-	return windows.UTF16ToString(buf[:size])
+		// Metadata check, in each rule's match mode
+		meta := scan.metadata(*proc)
+		return rules.matchMetadata(meta.ProductName, meta.FileDescription)
+	}, term)
+	scan.retain(processes)
 }
 
-func Process32First(snapshot windows.Handle, pe *ProcessEntry32) error {
-	r1, _, err := procProcess32First.Call(uintptr(snapshot), uintptr(unsafe.Pointer(pe)))
-	if r1 == 1 { // TRUE
-		return nil
-	}
-	return err
-}
+// endMatches ends the processes of a snapshot that match, and everything
+// launched by those whose rule's scope covers it, found on the snapshot's
+// process tree. The tree needs start times, which are read only then.
+func endMatches(processes []Process, match func(*Process) *ruleMatch, term *terminator) {
+	var tree *procTree // Built on the first match that needs it
+	for i := range processes {
+		proc := &processes[i]
+		m := match(proc)
+		if m == nil {
+			continue
+		}
 
-func Process32Next(snapshot windows.Handle, pe *ProcessEntry32) error {
-	r1, _, err := procProcess32Next.Call(uintptr(snapshot), uintptr(unsafe.Pointer(pe)))
-	if r1 == 1 { // TRUE
-		return nil
+		scope := m.rule.EffectiveScope()
+		if scope != storage.ScopeProcess {
+			if tree == nil {
+				fillStartTimes(term.procs, processes)
+				tree = newProcTree(processes)
+			}
+			for _, child := range tree.descendants(proc.PID) {
+				term.end(child, launcherMatch(m, *proc))
+			}
+		}
+		if scope != storage.ScopeLaunched {
+			term.end(*proc, m)
+		}
 	}
-	return err
 }
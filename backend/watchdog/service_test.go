@@ -0,0 +1,477 @@
+package watchdog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"focus-lock/backend/clock"
+	"focus-lock/backend/datadir"
+	"focus-lock/backend/storage"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStore returns a store in a temp dir on a fake clock, and the dir.
+// debugLog writes there too.
+func testStore(t *testing.T, clk *clock.Fake) (*storage.Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := datadir.ParseArgs([]string{datadir.FlagDataDir, dir}); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewStoreWithBackup(dir, storage.NewMemoryBackupStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetClock(clk)
+	return store, dir
+}
+
+func TestBrokenJournalPenalizedOnce(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	store, dir := testStore(t, clk)
+
+	end := start.Add(3 * time.Hour)
+	if err := store.UpdateAtomic(func(cfg *storage.Config) { cfg.LockEndTime = end }); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateAtomic(func(cfg *storage.Config) { cfg.GhostTaskName = "task" }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the first entry
+	path := filepath.Join(dir, "config.json.journal")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := bytes.Replace(data, []byte(`"source":"`), []byte(`"source":"forged-`), 1)
+	if err := os.WriteFile(path, forged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// One slow loop every 5s for two hours, far past the tamper log's
+	// dedup window
+	for i := 0; i < 2*60*12; i++ {
+		checkJournal(store)
+		clk.Advance(5 * time.Second)
+	}
+
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	extended := store.Snapshot().LockEndTime.Sub(end)
+	if want := time.Duration(storage.DefaultTamperPolicy().ExtendLockMinutes) * time.Minute; extended != want {
+		t.Fatalf("lock extended by %s, want %s once", extended, want)
+	}
+	events, err := store.TamperEvents()
+	if err != nil || len(events) != 1 {
+		t.Fatalf("tamper events = %+v, err = %v, want one", events, err)
+	}
+}
+
+// settle waits until no termination ladder is running.
+func settle(t *testing.T, term *terminator) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		term.mu.Lock()
+		n := len(term.pending)
+		term.mu.Unlock()
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("termination ladders still running")
+}
+
+// writeExe creates a file to stand in for an executable.
+func writeExe(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnforceLoops(t *testing.T) {
+	bin := t.TempDir()
+	game := writeExe(t, bin, "game", "game image")
+	renamed := writeExe(t, bin, "notes", "game image") // A copy of game under another name
+	launcher := writeExe(t, bin, "launcher", "launcher image")
+	editor := writeExe(t, bin, "editor", "editor image")
+	gameSum := fmt.Sprintf("%x", sha256.Sum256([]byte("game image")))
+
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	processes := []Process{
+		{PID: 100, Name: "game", Path: game, StartTime: start},
+		{PID: 101, Name: "notes", Path: renamed, StartTime: start},
+		{PID: 200, Name: "launcher", Path: launcher, StartTime: start},
+		{PID: 201, PPID: 200, Name: "game", Path: game, StartTime: start.Add(time.Minute)},
+		{PID: 300, Name: "editor", Path: editor, StartTime: start},
+	}
+	forceKill := &storage.Termination{}
+	rule := func(typ storage.RuleType, value string, mod func(*storage.AppRule)) storage.AppRule {
+		r := storage.AppRule{Type: typ, Value: value, Termination: forceKill}
+		if mod != nil {
+			mod(&r)
+		}
+		return r
+	}
+	scope := func(s storage.RuleScope) func(*storage.AppRule) {
+		return func(r *storage.AppRule) { r.Scope = s }
+	}
+	action := func(a storage.Action) func(*storage.AppRule) {
+		return func(r *storage.AppRule) { r.Action = a }
+	}
+
+	tests := []struct {
+		name       string
+		rules      []storage.AppRule
+		exceptions []storage.AppRule
+		deep       bool
+
+		killed    []uint32
+		suspended []uint32
+		audited   []storage.Action
+	}{
+		{name: "name, fast", rules: []storage.AppRule{rule(storage.RuleName, "game", nil)}, killed: []uint32{100, 201}},
+		{name: "name, deep", rules: []storage.AppRule{rule(storage.RuleName, "game", nil)}, deep: true, killed: []uint32{100, 201}},
+		// The fast loop only sees names, paths come with the deep scan
+		{name: "glob, fast", rules: []storage.AppRule{rule(storage.RulePathGlob, filepath.Join(bin, "l*"), nil)}},
+		{name: "glob, deep", rules: []storage.AppRule{rule(storage.RulePathGlob, filepath.Join(bin, "l*"), nil)}, deep: true, killed: []uint32{200}},
+		{name: "hash finds the renamed copy", rules: []storage.AppRule{rule(storage.RuleSHA256, gameSum, nil)}, deep: true, killed: []uint32{100, 101, 201}},
+		{name: "tree", rules: []storage.AppRule{rule(storage.RuleName, "launcher", scope(storage.ScopeTree))}, killed: []uint32{201, 200}},
+		{name: "launched only", rules: []storage.AppRule{rule(storage.RuleName, "launcher", scope(storage.ScopeLaunched))}, killed: []uint32{201}},
+		{name: "suspend", rules: []storage.AppRule{rule(storage.RuleName, "editor", action(storage.ActionSuspend))}, suspended: []uint32{300}, audited: []storage.Action{storage.ActionSuspend}},
+		{name: "notify", rules: []storage.AppRule{rule(storage.RuleName, "editor", action(storage.ActionNotify))}, audited: []storage.Action{storage.ActionNotify}},
+		{name: "log", rules: []storage.AppRule{rule(storage.RuleName, "editor", action(storage.ActionLog))}, deep: true, audited: []storage.Action{storage.ActionLog}},
+		{
+			name:       "exception",
+			rules:      []storage.AppRule{rule(storage.RuleName, "game", nil)},
+			exceptions: []storage.AppRule{rule(storage.RulePathGlob, filepath.Join(bin, "game"), nil)},
+			killed:     []uint32{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			store, _ := testStore(t, clk)
+			fake := NewFakeProcessProvider(processes...)
+			hashes := newFileHashes()
+			term := newTerminator(fake, store, hashes)
+			term.setAllowlist(newAllowlist("", tt.exceptions, hashes))
+			rules := compileRules(tt.rules)
+
+			if tt.deep {
+				scan := newProcCache(fake, newMetadataCache(NewSystemMetadataReader(), clk.Now))
+				enforceDeep(fake, scan, term, rules, hashes)
+			} else {
+				enforceFast(fake, term, rules, store)
+			}
+			settle(t, term)
+
+			if got := fake.Killed(); !slices.Equal(sorted(got), sorted(tt.killed)) {
+				t.Errorf("killed = %v, want %v", got, tt.killed)
+			}
+			for _, p := range processes {
+				if want := slices.Contains(tt.suspended, p.PID); fake.Suspended(p.PID) != want {
+					t.Errorf("PID %d suspended = %v, want %v", p.PID, !want, want)
+				}
+			}
+			entries, err := store.Audit().Entries(time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var audited []storage.Action
+			for _, e := range entries {
+				audited = append(audited, e.Action)
+			}
+			if !slices.Equal(audited, tt.audited) {
+				t.Errorf("audited = %v, want %v", audited, tt.audited)
+			}
+			if err := store.FlushKills(); err != nil {
+				t.Fatal(err)
+			}
+			if totals, _ := store.Stats().Totals(); sum(totals.KillCounts) != len(tt.killed) {
+				t.Errorf("kills counted = %v, want %d", totals.KillCounts, len(tt.killed))
+			}
+		})
+	}
+}
+
+func sorted(pids []uint32) []uint32 {
+	out := slices.Clone(pids)
+	slices.Sort(out)
+	return out
+}
+
+func sum(counts map[string]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// runService runs the enforcer until the returned func or the test's
+// cleanup stops it; both wait for it to return.
+func runService(t *testing.T, store *storage.Store, procs ProcessProvider, events ProcessEventSource) (stop func()) {
+	t.Helper()
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StartEnforcerWith(store, false, procs, events, quit)
+	}()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// eventually calls step, if any, until cond holds.
+func eventually(t *testing.T, what string, step func(), cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+		if step != nil {
+			step()
+		}
+	}
+	t.Fatal("timed out waiting for " + what)
+}
+
+// lockWith starts a manual lock of a profile with rules until end.
+func lockWith(t *testing.T, store *storage.Store, end time.Time, rules ...storage.AppRule) {
+	t.Helper()
+	err := store.UpdateAtomic(func(cfg *storage.Config) {
+		cfg.Profiles = []storage.Profile{{ID: "work", Name: "Work", AppRules: slices.Clone(rules)}}
+		cfg.ActiveProfileID = "work"
+		cfg.SessionProfileID = "work"
+		cfg.LockEndTime = end
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceEndsStartedProcess(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	game := writeExe(t, t.TempDir(), "game", "game image")
+	rule := storage.AppRule{Type: storage.RuleName, Value: "game", Termination: &storage.Termination{}}
+
+	tests := []struct {
+		name        string
+		startErr    error
+		closeSource bool
+		tick        time.Duration // Clock steps needed for the kill; zero for none
+	}{
+		{name: "start event"},
+		{name: "no events, polling", startErr: fmt.Errorf("unsupported"), tick: pollInterval},
+		{name: "events failed, polling", closeSource: true, tick: pollInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			store, _ := testStore(t, clk)
+			lockWith(t, store, start.Add(time.Hour), rule)
+			fake := NewFakeProcessProvider(Process{PID: 1, Name: "init", StartTime: start})
+			events := NewFakeProcessEventSource()
+			events.StartErr = tt.startErr
+			runService(t, store, fake, events)
+			if tt.closeSource {
+				events.Close()
+			}
+
+			fake.Start(Process{PID: 100, Name: "game", Path: game, StartTime: clk.Now()})
+			events.Emit(ProcessStart{PID: 100})
+			var step func()
+			if tt.tick > 0 {
+				step = func() { clk.Advance(tt.tick) }
+			}
+			eventually(t, "the kill", step, func() bool { return len(fake.Killed()) > 0 })
+
+			if got := fake.Killed(); !slices.Equal(got, []uint32{100}) {
+				t.Errorf("killed = %v, want [100]", got)
+			}
+			if got := fake.CloseRequested(); len(got) != 0 {
+				t.Errorf("asked to close = %v, want a force-kill", got)
+			}
+		})
+	}
+}
+
+func TestServiceFollowsClock(t *testing.T) {
+	// Wednesday
+	at := func(hhmm string) time.Time {
+		tm, _ := clockOn(time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC), hhmm)
+		return tm
+	}
+	rule := storage.AppRule{Type: storage.RuleName, Value: "game", Termination: &storage.Termination{}}
+	window := func(cfg *storage.Config) {
+		cfg.Schedules = []storage.Schedule{{ID: "s", Days: []string{"Wed"}, StartTime: "09:00", EndTime: "10:00", Enabled: true}}
+	}
+	lock := func(until string) func(*storage.Config) {
+		return func(cfg *storage.Config) { cfg.LockEndTime = at(until) }
+	}
+	paused := func(cfg *storage.Config) {
+		cfg.LockEndTime = at("11:00")
+		cfg.PausedUntil = at("10:00")
+	}
+	windowClosed := func(store *storage.Store) bool {
+		open, err := store.Sessions().OpenSessions()
+		return err == nil && len(open) == 0
+	}
+	lockCleared := func(store *storage.Store) bool {
+		return store.Snapshot().LockEndTime.IsZero()
+	}
+
+	tests := []struct {
+		name     string
+		config   func(*storage.Config)
+		from     time.Time
+		boundary time.Time
+		// over, if set, tells when enforcement has stopped at the
+		// boundary. Otherwise it starts there.
+		over func(*storage.Store) bool
+	}{
+		{name: "window opens", config: window, from: at("08:59"), boundary: at("09:00")},
+		{name: "pause ends", config: paused, from: at("09:59"), boundary: at("10:00")},
+		{name: "window closes", config: window, from: at("09:59"), boundary: at("10:00"), over: windowClosed},
+		{name: "lock ends", config: lock("10:00"), from: at("09:59"), boundary: at("10:00"), over: lockCleared},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(tt.from)
+			store, _ := testStore(t, clk)
+			err := store.UpdateAtomic(func(cfg *storage.Config) {
+				cfg.Profiles = []storage.Profile{{ID: "work", Name: "Work", AppRules: []storage.AppRule{rule}}}
+				cfg.ActiveProfileID = "work"
+				tt.config(cfg)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			game := writeExe(t, t.TempDir(), "game", "game image")
+			fake := NewFakeProcessProvider(Process{PID: 100, Name: "game", Path: game, StartTime: clk.Now()})
+			events := NewFakeProcessEventSource()
+			runService(t, store, fake, events)
+			second := func() { clk.Advance(time.Second) }
+			killed := func(pid uint32) bool { return slices.Contains(fake.Killed(), pid) }
+
+			if tt.over == nil {
+				eventually(t, "the kill", second, func() bool { return killed(100) })
+				if clk.Now().Before(tt.boundary) {
+					t.Fatalf("killed at %s, before %s", clk.Now(), tt.boundary)
+				}
+				return
+			}
+
+			// Killed while the session runs; once it is over, a new start
+			// is left alone
+			eventually(t, "the kill", second, func() bool { return killed(100) && !tt.over(store) })
+			eventually(t, "the session to end", second, func() bool { return tt.over(store) })
+			if clk.Now().Before(tt.boundary) {
+				t.Fatalf("session over at %s, before %s", clk.Now(), tt.boundary)
+			}
+			fake.Start(Process{PID: 101, Name: "game", Path: game, StartTime: clk.Now()})
+			events.Emit(ProcessStart{PID: 101})
+			for i := 0; i < 30; i++ {
+				second()
+				time.Sleep(time.Millisecond)
+			}
+			if killed(101) {
+				t.Fatal("killed after the session")
+			}
+		})
+	}
+}
+
+func TestSuspendedResumedOnce(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	bin := t.TempDir()
+	editor := writeExe(t, bin, "editor", "editor image")
+	chat := writeExe(t, bin, "chat", "chat image")
+	pids := []uint32{300, 301}
+	rules := []storage.AppRule{
+		{Type: storage.RuleName, Value: "editor", Action: storage.ActionSuspend},
+		{Type: storage.RuleName, Value: "chat", Action: storage.ActionSuspend},
+	}
+	endLock := func(t *testing.T, store *storage.Store) {
+		if err := store.UpdateAtomic(func(cfg *storage.Config) { cfg.LockEndTime = time.Time{} }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		// end ends the session and the enforcer that suspended the
+		// processes, in some order
+		end func(t *testing.T, clk *clock.Fake, store *storage.Store, fake *FakeProcessProvider, stop func())
+	}{
+		{"session ends", func(t *testing.T, clk *clock.Fake, store *storage.Store, fake *FakeProcessProvider, stop func()) {
+			endLock(t, store)
+			eventually(t, "the resume", nil, func() bool { return !fake.Suspended(300) && !fake.Suspended(301) })
+			// Every slow loop resumes what is left; nothing is
+			for i := 0; i < 4; i++ {
+				clk.Advance(5 * time.Second)
+				time.Sleep(time.Millisecond)
+			}
+			stop()
+		}},
+		{"stopped as the session ends", func(t *testing.T, clk *clock.Fake, store *storage.Store, fake *FakeProcessProvider, stop func()) {
+			endLock(t, store)
+			stop()
+		}},
+		{"stopped during the session", func(t *testing.T, clk *clock.Fake, store *storage.Store, fake *FakeProcessProvider, stop func()) {
+			stop()
+			if !fake.Suspended(300) || !fake.Suspended(301) {
+				t.Fatal("resumed while the session runs")
+			}
+			// The next enforcer to run resumes them once the session is over
+			endLock(t, store)
+			runService(t, store, fake, NewFakeProcessEventSource())()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			store, _ := testStore(t, clk)
+			lockWith(t, store, start.Add(time.Hour), rules...)
+			fake := NewFakeProcessProvider(
+				Process{PID: 300, Name: "editor", Path: editor, StartTime: start},
+				Process{PID: 301, Name: "chat", Path: chat, StartTime: start},
+			)
+			events := NewFakeProcessEventSource()
+			stop := runService(t, store, fake, events)
+			for _, pid := range pids {
+				events.Emit(ProcessStart{PID: pid})
+			}
+			eventually(t, "the suspensions", nil, func() bool { return fake.Suspended(300) && fake.Suspended(301) })
+
+			tt.end(t, clk, store, fake, stop)
+
+			for _, pid := range pids {
+				if n := fake.Resumes(pid); n != 1 {
+					t.Errorf("PID %d resumed %d times, want once", pid, n)
+				}
+			}
+			if left, err := store.Suspended().List(); err != nil || len(left) != 0 {
+				t.Errorf("still recorded as suspended: %+v, %v", left, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package watchdog
+
+import (
+	"errors"
+	"focus-lock/backend/storage"
+	"time"
+)
+
+// syncSessions keeps the session history in step with the lock state. It
+// closes sessions whose lock or schedule window is over and opens one for
+// each schedule window that has started. Manual sessions are opened by the
+// UI when the lock starts. Both the UI and the ghost run this; the session
+// store ignores the duplicate.
+func syncSessions(store *storage.Store, state DesiredState, now time.Time) {
+	open, err := store.Sessions().OpenSessions()
+	if err != nil {
+		debugLog("Session history unavailable: " + err.Error())
+		return
+	}
+
+	cfg := store.Snapshot()
+	activeIDs := make(map[string]bool)
+	for _, s := range state.ActiveSchedules {
+		activeIDs[s.ID] = true
+	}
+
+	for _, sess := range open {
+		end := now
+		switch sess.Trigger {
+		case storage.TriggerManual:
+			if state.ManualActive {
+				continue
+			}
+			// Expired while no enforcer was running (e.g. machine off)
+			if !cfg.LockEndTime.IsZero() && cfg.LockEndTime.Before(now) {
+				end = cfg.LockEndTime
+			}
+		case storage.TriggerSchedule:
+			if activeIDs[sess.ScheduleID] {
+				continue
+			}
+			if !sess.PlannedEnd.IsZero() && sess.PlannedEnd.Before(now) {
+				end = sess.PlannedEnd
+			}
+		}
+
+		if err := store.EndSession(sess.ID, end); err != nil && !errors.Is(err, storage.ErrSessionNotOpen) {
+			debugLog("Failed to end session: " + err.Error())
+		}
+	}
+
+	for _, s := range state.ActiveSchedules {
+		profile := cfg.ResolveProfile(s.ProfileID)
+		_, err := store.Sessions().Begin(storage.Session{
+			Trigger:    storage.TriggerSchedule,
+			ScheduleID: s.ID,
+			ProfileID:  profile.ID,
+			Apps:       profile.BlockedAppNames(),
+			Start:      now,
+			PlannedEnd: scheduleEnd(s, now),
+		})
+		if err != nil {
+			debugLog("Failed to start session: " + err.Error())
+		}
+	}
+}
+
+// scheduleEnd returns the end of today's window of s.
+func scheduleEnd(s storage.Schedule, now time.Time) time.Time {
+	end, ok := clockOn(now, s.EndTime)
+	if !ok {
+		return now
+	}
+	return end
+}
@@ -0,0 +1,71 @@
+package watchdog
+
+import (
+	"focus-lock/backend/clock"
+	"focus-lock/backend/storage"
+	"testing"
+	"time"
+)
+
+func TestSyncSessionsCreditsActualTime(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	planned := start.Add(2 * time.Hour)
+	tests := []struct {
+		name     string
+		trigger  string
+		lockEnd  time.Time     // Config after the session started
+		unlocked bool          // Emergency unlock during the session
+		now      time.Duration // When the enforcer next looks, after start
+		want     time.Duration // Time credited
+	}{
+		{"stopped early", storage.TriggerManual, time.Time{}, false, 30 * time.Minute, 30 * time.Minute},
+		{"emergency unlocked, then stopped", storage.TriggerManual, time.Time{}, true, 45 * time.Minute, 45 * time.Minute},
+		{"ran to the end", storage.TriggerManual, planned, false, 2 * time.Hour, 2 * time.Hour},
+		// The enforcer crashed or the machine was off when the lock ran out
+		{"manual lock over after a crash", storage.TriggerManual, planned, false, 7 * time.Hour, 2 * time.Hour},
+		{"schedule window over after a crash", storage.TriggerSchedule, time.Time{}, false, 7 * time.Hour, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			store, _ := testStore(t, clk)
+			sess, err := store.Sessions().Begin(storage.Session{
+				Trigger:    tt.trigger,
+				ScheduleID: "gone", // No such schedule any more
+				Apps:       []string{"game.exe"},
+				Start:      start,
+				PlannedEnd: planned,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.unlocked {
+				if err := store.Sessions().RecordEmergencyUnlock(start.Add(10 * time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.UpdateAtomic(func(cfg *storage.Config) { cfg.LockEndTime = tt.lockEnd }); err != nil {
+				t.Fatal(err)
+			}
+
+			clk.Set(start.Add(tt.now))
+			now := clk.Now()
+			syncSessions(store, Evaluate(store.Snapshot(), now), now)
+
+			open, err := store.Sessions().OpenSessions()
+			if err != nil || len(open) != 0 {
+				t.Fatalf("open sessions = %+v, err = %v, want none", open, err)
+			}
+			ended, err := store.Sessions().Query(time.Time{}, time.Time{})
+			if err != nil || len(ended) != 1 || ended[0].ID != sess.ID {
+				t.Fatalf("sessions = %+v, err = %v", ended, err)
+			}
+			if got := ended[0].End.Sub(start); got != tt.want {
+				t.Errorf("ended after %s, want %s", got, tt.want)
+			}
+			if got := time.Duration(store.GetBlockedDuration()["game.exe"]) * time.Second; got != tt.want {
+				t.Errorf("credited %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
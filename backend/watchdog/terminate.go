@@ -0,0 +1,278 @@
+package watchdog
+
+import (
+	"fmt"
+	"focus-lock/backend/clock"
+	"focus-lock/backend/storage"
+	"sync"
+	"time"
+)
+
+// Timing of the termination ladder. TerminateProcess and SIGKILL return
+// before the process is gone, so even a force-kill is followed by a wait.
+const (
+	exitPollInterval = 100 * time.Millisecond
+	killExitTimeout  = 2 * time.Second
+)
+
+// terminator carries out the action of the rule a process matched. Kills
+// follow the termination ladder: ask politely, wait out the grace period,
+// then force-kill. Ladders run in their own goroutine so the grace period
+// does not hold up the loops. Apps caught in a relaunch loop are
+// force-killed straight away, and the loop is escalated.
+type terminator struct {
+	procs  ProcessProvider
+	store  *storage.Store
+	clk    clock.Clock
+	hashes *fileHashes
+
+	// Set and read by the enforcer loop only
+	allow   *allowlist
+	spared  map[uint32]bool      // Protected PIDs already logged
+	handled map[uint32]time.Time // Suspended, notified or logged PIDs, with their start times
+	loops   *relaunchTracker
+
+	mu      sync.Mutex
+	pending map[uint32]bool // PIDs whose ladder is still running
+	ladders sync.WaitGroup
+}
+
+func newTerminator(procs ProcessProvider, store *storage.Store, hashes *fileHashes) *terminator {
+	return &terminator{
+		procs:   procs,
+		store:   store,
+		clk:     store.Clock(),
+		hashes:  hashes,
+		spared:  make(map[uint32]bool),
+		handled: make(map[uint32]time.Time),
+		loops:   newRelaunchTracker(),
+		pending: make(map[uint32]bool),
+	}
+}
+
+// setAllowlist replaces the processes that are never ended.
+func (t *terminator) setAllowlist(a *allowlist) {
+	t.allow = a
+	t.spared = make(map[uint32]bool)
+}
+
+// end applies the action of m's rule to proc, unless proc is protected or
+// already dealt with: a ladder is running for it, so the loops can keep
+// matching the process during its grace period, or it was suspended,
+// notified or logged before.
+func (t *terminator) end(proc Process, m *ruleMatch) {
+	action := m.rule.EffectiveAction()
+	t.mu.Lock()
+	running := t.pending[proc.PID]
+	t.mu.Unlock()
+	if running || t.spared[proc.PID] {
+		return
+	}
+	if _, ok := t.handled[proc.PID]; ok && action != storage.ActionKill {
+		return
+	}
+
+	// The path is needed by the allowlist; the start time tells which
+	// process this is, in case the PID is reused while we wait
+	if proc.Path == "" || proc.StartTime.IsZero() {
+		_ = t.procs.Inspect(&proc)
+	}
+	if t.allow != nil {
+		if why := t.allow.protects(proc, t.hashes); why != "" {
+			debugLog(fmt.Sprintf("Not ending %s [PID: %d] (%s): %s", proc.Name, proc.PID, m, why))
+			t.spared[proc.PID] = true
+			return
+		}
+	}
+	switch action {
+	case storage.ActionSuspend:
+		t.suspend(proc, m)
+		return
+	case storage.ActionNotify, storage.ActionLog:
+		t.handled[proc.PID] = proc.StartTime
+		debugLog(fmt.Sprintf("Not ending %s [PID: %d] (%s only): %s", proc.Name, proc.PID, action, m))
+		t.audit(proc, m, action)
+		return
+	}
+	term := m.rule.Ladder()
+	looping, stage := t.loops.note(proc, t.clk.Now())
+	if looping {
+		// A fresh respawn has no state to save, and logging every kill
+		// of a loop only floods the log
+		term = storage.Termination{}
+	} else {
+		debugLog(fmt.Sprintf("Ending %s [PID: %d]: %s", proc.Name, proc.PID, m))
+	}
+
+	t.mu.Lock()
+	t.pending[proc.PID] = true
+	t.mu.Unlock()
+	if stage > 0 {
+		t.escalate(proc, m, stage)
+	}
+
+	t.ladders.Add(1)
+	go func() {
+		defer t.ladders.Done()
+		defer func() {
+			t.mu.Lock()
+			delete(t.pending, proc.PID)
+			t.mu.Unlock()
+		}()
+		outcome := t.run(proc, term)
+		if !looping {
+			debugLog(fmt.Sprintf("Process %s [PID: %d]: %s", proc.Name, proc.PID, outcome))
+		}
+		t.store.IncrementKillCount(proc.Name, outcome)
+	}()
+}
+
+// wait blocks until every running ladder has finished.
+func (t *terminator) wait() {
+	t.ladders.Wait()
+}
+
+// suspend freezes proc until resumeAll. It is recorded first, so that it
+// is resumed even if this process dies, and only one of the enforcers
+// suspends it.
+func (t *terminator) suspend(proc Process, m *ruleMatch) {
+	added, err := t.store.Suspended().Add(storage.SuspendedProcess{
+		PID:       proc.PID,
+		Name:      proc.Name,
+		StartTime: proc.StartTime,
+		Since:     t.clk.Now(),
+	})
+	if err != nil {
+		// Never suspend what might not be resumed
+		debugLog(fmt.Sprintf("Cannot record suspension of %s: %s", proc.Name, err.Error()))
+		return
+	}
+	t.handled[proc.PID] = proc.StartTime
+	if !added {
+		return // The other enforcer has suspended it
+	}
+
+	if err := t.procs.Suspend(proc.PID); err != nil {
+		debugLog(fmt.Sprintf("Suspend failed for %s: %s", proc.Name, err.Error()))
+		_ = t.store.Suspended().Remove(proc.PID)
+		return
+	}
+	debugLog(fmt.Sprintf("Suspending %s [PID: %d]: %s", proc.Name, proc.PID, m))
+	t.audit(proc, m, storage.ActionSuspend)
+}
+
+// resumeAll continues every process either enforcer suspended, puts back
+// quarantined executables, and forgets what this one handled. The enforcer
+// calls it whenever nothing is enforced, so a session ending, a pause or
+// the ghost exiting all resume.
+func (t *terminator) resumeAll() {
+	t.handled = make(map[uint32]time.Time)
+	t.loops = newRelaunchTracker()
+	t.releaseQuarantine()
+
+	suspended, err := t.store.Suspended().Take()
+	if err != nil {
+		debugLog("Cannot read suspended processes: " + err.Error())
+		return
+	}
+	for _, rec := range suspended {
+		proc := Process{PID: rec.PID, Name: rec.Name, StartTime: rec.StartTime}
+		if t.exited(proc) {
+			continue // Killed meanwhile; the PID may be someone else's now
+		}
+		if err := t.procs.Resume(proc.PID); err != nil {
+			debugLog(fmt.Sprintf("Resume failed for %s [PID: %d]: %s", proc.Name, proc.PID, err.Error()))
+			continue
+		}
+		debugLog(fmt.Sprintf("Resumed %s [PID: %d]", proc.Name, proc.PID))
+	}
+}
+
+// prune forgets handled processes that have exited, so that a process
+// reusing one of their PIDs is handled afresh, and relaunch loops that
+// have ended.
+func (t *terminator) prune() {
+	t.loops.prune(t.clk.Now())
+	for pid, start := range t.handled {
+		if t.exited(Process{PID: pid, StartTime: start}) {
+			delete(t.handled, pid)
+		}
+	}
+}
+
+// audit records a match that was acted on without killing.
+func (t *terminator) audit(proc Process, m *ruleMatch, action storage.Action) {
+	err := t.store.Audit().Record(storage.AuditEntry{
+		Time:      t.clk.Now(),
+		Action:    action,
+		App:       proc.Name,
+		PID:       proc.PID,
+		StartTime: proc.StartTime,
+		Path:      proc.Path,
+		Reason:    m.String(),
+	})
+	if err != nil {
+		debugLog("Audit log write failed: " + err.Error())
+	}
+}
+
+// run climbs the ladder and reports whether and how the process exited.
+func (t *terminator) run(proc Process, term storage.Termination) storage.KillOutcome {
+	if grace := term.GracePeriod(); grace > 0 {
+		if err := t.procs.RequestClose(proc.PID); err == nil {
+			debugLog(fmt.Sprintf("Asked %s [PID: %d] to close, waiting %s", proc.Name, proc.PID, grace))
+			if t.waitExit(proc, grace) {
+				return storage.OutcomeClosed
+			}
+		} else {
+			debugLog(fmt.Sprintf("Cannot ask %s to close (%s), killing", proc.Name, err.Error()))
+		}
+	}
+
+	if err := t.procs.Terminate(proc.PID); err != nil {
+		if t.exited(proc) {
+			return storage.OutcomeClosed // Went away by itself meanwhile
+		}
+		debugLog(fmt.Sprintf("Terminate failed for %s: %s", proc.Name, err.Error()))
+		return storage.OutcomeSurvived
+	}
+	if t.waitExit(proc, killExitTimeout) {
+		return storage.OutcomeKilled
+	}
+	return storage.OutcomeSurvived
+}
+
+// waitExit polls until proc has exited or timeout has passed.
+func (t *terminator) waitExit(proc Process, timeout time.Duration) bool {
+	if t.exited(proc) {
+		return true
+	}
+	deadline := t.clk.Now().Add(timeout)
+	ticker := t.clk.NewTicker(exitPollInterval)
+	defer ticker.Stop()
+	for range ticker.C() {
+		if t.exited(proc) {
+			return true
+		}
+		if !t.clk.Now().Before(deadline) {
+			return false
+		}
+	}
+	return false
+}
+
+// exited reports whether proc is gone. A live PID with another start time
+// belongs to a new process, so ours has exited too.
+func (t *terminator) exited(proc Process) bool {
+	if !t.procs.Alive(proc.PID) {
+		return true
+	}
+	if proc.StartTime.IsZero() {
+		return false
+	}
+	start, err := t.procs.StartTime(proc.PID)
+	if err != nil {
+		return false // Alive says it is there; assume it is still ours
+	}
+	return !start.IsZero() && !start.Equal(proc.StartTime)
+}
@@ -0,0 +1,78 @@
+package watchdog
+
+import (
+	"focus-lock/backend/clock"
+	"focus-lock/backend/storage"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTerminationLadder(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	graceful := func(seconds int) storage.Termination {
+		return storage.Termination{Graceful: true, GraceSeconds: seconds}
+	}
+
+	tests := []struct {
+		name   string
+		term   storage.Termination
+		closes bool // The app closes when asked
+
+		asked   bool
+		killed  bool
+		grace   time.Duration // Waited before the kill
+		outcome storage.KillOutcome
+	}{
+		{name: "force-kill", term: storage.Termination{}, killed: true, outcome: storage.OutcomeKilled},
+		{name: "closes when asked", term: graceful(10), closes: true, asked: true, outcome: storage.OutcomeClosed},
+		{name: "ignores the request", term: graceful(10), asked: true, killed: true, grace: 10 * time.Second, outcome: storage.OutcomeKilled},
+		{name: "grace capped", term: graceful(600), asked: true, killed: true, grace: storage.MaxGraceSeconds * time.Second, outcome: storage.OutcomeKilled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			store, _ := testStore(t, clk)
+			fake := NewFakeProcessProvider(Process{PID: 100, Name: "game", StartTime: start})
+			fake.ClosesOnRequest = tt.closes
+			term := newTerminator(fake, store, newFileHashes())
+
+			done := make(chan storage.KillOutcome, 1)
+			go func() { done <- term.run(Process{PID: 100, Name: "game", StartTime: start}, tt.term) }()
+
+			// Step through the grace period; the kill must not come before
+			// its end, nor before the request to close
+			var outcome storage.KillOutcome
+			var killedAt time.Time
+			eventually(t, "the ladder", func() { clk.Advance(exitPollInterval) }, func() bool {
+				if killedAt.IsZero() && len(fake.Killed()) > 0 {
+					killedAt = clk.Now()
+					if tt.asked && len(fake.CloseRequested()) == 0 {
+						t.Error("killed before being asked to close")
+					}
+				}
+				select {
+				case outcome = <-done:
+					return true
+				default:
+					return false
+				}
+			})
+
+			if outcome != tt.outcome {
+				t.Errorf("outcome = %s, want %s", outcome, tt.outcome)
+			}
+			if got := slices.Equal(fake.CloseRequested(), []uint32{100}); got != tt.asked {
+				t.Errorf("asked to close = %v, want %v", fake.CloseRequested(), tt.asked)
+			}
+			if got := slices.Equal(fake.Killed(), []uint32{100}); got != tt.killed {
+				t.Errorf("killed = %v, want %v", fake.Killed(), tt.killed)
+			}
+			if tt.killed {
+				if waited := killedAt.Sub(start); waited < tt.grace || waited > tt.grace+time.Second {
+					t.Errorf("killed after %s, want %s", waited, tt.grace)
+				}
+			}
+		})
+	}
+}
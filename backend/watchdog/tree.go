@@ -0,0 +1,81 @@
+package watchdog
+
+import "fmt"
+
+// maxTreeDepth bounds walks up and down the process tree. PIDs are reused,
+// so a stale parent PID can point anywhere, even into a cycle.
+const maxTreeDepth = 64
+
+// procTree is the parent/child structure of one process snapshot.
+type procTree struct {
+	byPID    map[uint32]Process
+	children map[uint32][]uint32
+}
+
+func newProcTree(processes []Process) *procTree {
+	t := &procTree{
+		byPID:    make(map[uint32]Process, len(processes)),
+		children: make(map[uint32][]uint32),
+	}
+	for _, p := range processes {
+		t.byPID[p.PID] = p
+	}
+	for _, p := range processes {
+		if parent, ok := t.byPID[p.PPID]; ok && p.PPID != p.PID && launchedBy(p, parent) {
+			t.children[p.PPID] = append(t.children[p.PPID], p.PID)
+		}
+	}
+	return t
+}
+
+// launchedBy reports whether parent can have started p. A parent that
+// started after p holds a reused PID of p's real, exited parent. Without
+// both start times that cannot be ruled out, so the answer is no: a stale
+// parent PID must not get an unrelated process ended.
+func launchedBy(p, parent Process) bool {
+	return !p.StartTime.IsZero() && !parent.StartTime.IsZero() && !parent.StartTime.After(p.StartTime)
+}
+
+// fillStartTimes reads the start times that the snapshot lacks (Windows
+// snapshots have none), so that newProcTree can tell real parents from
+// reused PIDs. Processes that cannot be read keep a zero time.
+func fillStartTimes(procs ProcessProvider, processes []Process) {
+	for i := range processes {
+		if processes[i].StartTime.IsZero() {
+			processes[i].StartTime, _ = procs.StartTime(processes[i].PID)
+		}
+	}
+}
+
+// descendants returns everything pid launched, directly or not, deepest
+// first, so children go before the process that would respawn them.
+func (t *procTree) descendants(pid uint32) []Process {
+	var out []Process
+	seen := map[uint32]bool{pid: true}
+	var walk func(pid uint32, depth int)
+	walk = func(pid uint32, depth int) {
+		if depth > maxTreeDepth {
+			return
+		}
+		for _, child := range t.children[pid] {
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			walk(child, depth+1)
+			out = append(out, t.byPID[child])
+		}
+	}
+	walk(pid, 0)
+	return out
+}
+
+// launcherMatch is the match of a process that was ended because an
+// ancestor matched a rule covering what it launches.
+func launcherMatch(m *ruleMatch, launcher Process) *ruleMatch {
+	return &ruleMatch{
+		rule:  m.rule,
+		field: fieldLauncher,
+		value: fmt.Sprintf("%s [PID: %d] (%s %q)", launcher.Name, launcher.PID, m.field, m.value),
+	}
+}
@@ -0,0 +1,33 @@
+package watchdog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcTreeSkipsReusedParentPIDs(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	fake := NewFakeProcessProvider(
+		Process{PID: 10, Name: "launcher.exe", StartTime: start},
+		Process{PID: 11, PPID: 10, Name: "game.exe", StartTime: start.Add(time.Minute)},
+		// Started before PID 10 existed: its real parent has exited
+		Process{PID: 12, PPID: 10, Name: "editor.exe", StartTime: start.Add(-time.Hour)},
+		// Start time not readable
+		Process{PID: 13, PPID: 10, Name: "service.exe"},
+	)
+
+	// Snapshots without start times give no tree at all
+	processes, err := fake.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := newProcTree(processes).descendants(10); len(got) != 0 {
+		t.Fatalf("descendants without start times = %v, want none", got)
+	}
+
+	fillStartTimes(fake, processes)
+	got := newProcTree(processes).descendants(10)
+	if len(got) != 1 || got[0].PID != 11 {
+		t.Fatalf("descendants = %v, want only PID 11", got)
+	}
+}
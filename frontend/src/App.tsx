@@ -1,6 +1,7 @@
 import { useState, useEffect, useMemo } from 'react';
 import { AddApp, RemoveApp, StartFocus, GetConfig, SetBlockedApps, GetInstalledApps, GetTopBlockedApps, AddBlockedSite, RemoveBlockedSite, SetBlockCommonVPN, ImportSettings } from "../wailsjs/go/bridge/App";
 import { storage, sysinfo } from "../wailsjs/go/models";
+import { EventsOn } from "../wailsjs/runtime/runtime";
 import { FocusActive } from "./components/FocusActive";
 import { AppLayout } from "./components/AppLayout";
 
@@ -28,7 +29,21 @@ function App() {
 
     useEffect(() => {
         refresh();
-        const interval = setInterval(refresh, 2000); // Poll for updates
+        const offConfigChanged = EventsOn("config:changed", refresh); // Pushed by the backend on every config change
+        // Rules with the notify action leave the app running and tell the user instead
+        const offNotify = EventsOn("enforcement:notify", (entry: { app: string }) => {
+            new Notification("Blocked App Running", {
+                body: `${entry.app} is on your blocklist. Close it to stay focused.`,
+                requireInteraction: false,
+            });
+        });
+        // Warnings from the enforcer, e.g. an app that keeps being relaunched
+        const offWarning = EventsOn("enforcement:warning", (entry: { reason: string }) => {
+            new Notification("Focus Lock Warning", {
+                body: entry.reason,
+                requireInteraction: true,
+            });
+        });
 
         // Fetch installed apps initially to populate names/icons
         GetInstalledApps().then(setInstalledApps).catch(console.error);
@@ -41,7 +56,11 @@ function App() {
             Notification.requestPermission();
         }
 
-        return () => clearInterval(interval);
+        return () => {
+            offConfigChanged();
+            offNotify();
+            offWarning();
+        };
     }, []);
 
     const appMap = useMemo(() => {
@@ -178,7 +197,7 @@ function App() {
         try {
             const { h, m } = pendingSession;
             const totalSeconds = (h * 3600) + (m * 60);
-            await StartFocus(totalSeconds);
+            await StartFocus(totalSeconds, "");
 
             // Success!
             setShowConfirm(false);
@@ -39,6 +39,6 @@ export function SetBlockCommonVPN(arg1:boolean):Promise<void>;
 
 export function SetBlockedApps(arg1:Array<string>):Promise<void>;
 
-export function StartFocus(arg1:number):Promise<void>;
+export function StartFocus(arg1:number,arg2:string):Promise<void>;
 
 export function StopFocus():Promise<void>;
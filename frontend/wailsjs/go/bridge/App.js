@@ -74,8 +74,8 @@ export function SetBlockedApps(arg1) {
   return window['go']['bridge']['App']['SetBlockedApps'](arg1);
 }
 
-export function StartFocus(arg1) {
-  return window['go']['bridge']['App']['StartFocus'](arg1);
+export function StartFocus(arg1, arg2) {
+  return window['go']['bridge']['App']['StartFocus'](arg1, arg2);
 }
 
 export function StopFocus() {
@@ -4,6 +4,7 @@ import (
 	"embed"
 	"fmt"
 	"focus-lock/backend/bridge"
+	"focus-lock/backend/datadir"
 	"focus-lock/backend/protection"
 	"focus-lock/backend/storage"
 	"focus-lock/backend/watchdog"
@@ -20,6 +21,19 @@ import (
 var assets embed.FS
 
 func main() {
+	// Resolve the data directory before anything touches it. Flags are
+	// stripped so the mode checks below see the same arguments as before.
+	args, err := datadir.ParseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	// The ghost is always given its directory (see datadir.ChildArgs), so
+	// FOCUSLOCK_HOME cannot point it at another, unlocked config.
+	if len(args) > 0 && args[0] == "--enforce" {
+		datadir.IgnoreEnv()
+	}
+
 	// Enable Anti-Termination Protection
 	// This prevents the user from killing the process via Task Manager
 	if err := protection.ProtectProcess(); err != nil {
@@ -30,16 +44,17 @@ func main() {
 	// 1. Check for "--enforce" flag (Ghost Mode)
 	// We check this FIRST because the Ghost process runs in the background and
 	// should not be blocked by the single-instance mutex of the UI.
-	if len(os.Args) > 1 && os.Args[1] == "--enforce" {
+	if len(args) > 0 && args[0] == "--enforce" {
 		// Headless Mode
 		store, err := storage.NewStore()
 		if err != nil {
 			return
 		}
+		store.SetSource(storage.SourceGhost)
 
 		// Ensure only one Ghost runs (Single Instance)
 		// This prevents zombie processes from piling up if the UI crashes/restarts
-		mutexName, _ := windows.UTF16PtrFromString("Global\\FocusLockGhost")
+		mutexName, _ := windows.UTF16PtrFromString("Global\\FocusLockGhost" + datadir.InstanceSuffix())
 		handle, err := windows.CreateMutex(nil, true, mutexName)
 		if err == nil && windows.GetLastError() == windows.ERROR_ALREADY_EXISTS {
 			// Another ghost is active. We can safely exit.
@@ -49,10 +64,11 @@ func main() {
 		_ = handle // Leak the handle so it stays held until process exit
 
 		// DEBUG LOG: Confirm startup
-		configDir, _ := os.UserConfigDir()
-		f, _ := os.OpenFile(configDir+"\\FocusLock\\ghost_debug.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		f.WriteString(fmt.Sprintf("Ghost started at %s with PID %d\n", time.Now().Format(time.RFC3339), os.Getpid()))
-		f.Close()
+		if logPath, err := datadir.Path("ghost_debug.log"); err == nil {
+			f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			f.WriteString(fmt.Sprintf("Ghost started at %s with PID %d\n", time.Now().Format(time.RFC3339), os.Getpid()))
+			f.Close()
+		}
 
 		// Enable Critical Process Status (BSOD if killed)
 		if err := protection.SetCritical(true); err != nil {
@@ -72,7 +88,7 @@ func main() {
 
 	// 2. Single Instance Lock (UI Mode Only)
 	// We use a named mutex to ensure only one instance of the UI runs.
-	mutexName, _ := windows.UTF16PtrFromString("Global\\FocusLockMutex")
+	mutexName, _ := windows.UTF16PtrFromString("Global\\FocusLockMutex" + datadir.InstanceSuffix())
 	handle, err := windows.CreateMutex(nil, true, mutexName)
 	if err != nil {
 		// If error (access denied etc), we just continue, but...
@@ -92,10 +108,10 @@ func main() {
 	// Keep handle open until process exits
 	// defer windows.CloseHandle(handle) // implied on exit
 
-	if len(os.Args) > 1 && os.Args[1] == "--test-spawn" {
+	if len(args) > 0 && args[0] == "--test-spawn" {
 		app := bridge.NewApp()
 		fmt.Println("Starting focus for 1 minute (Headless Test)...")
-		if err := app.StartFocus(1); err != nil {
+		if err := app.StartFocus(1, ""); err != nil {
 			fmt.Println("Error starting focus:", err)
 		} else {
 			fmt.Println("Focus started successfully. Check for hidden process.")
@@ -115,6 +131,7 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.Startup,
+		OnShutdown:       app.Shutdown,
 		Bind: []interface{}{
 			app,
 		},